@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// resolveModel resolves spec through the configured aliases and splits the
+// result into provider and model. The provider is empty if the spec names a
+// model without a provider prefix.
+func (c *Config) resolveModel(spec string) (Provider, string) {
+	for range len(c.Aliases) + 1 {
+		target, ok := c.Aliases[spec]
+		if !ok {
+			break
+		}
+		spec = target
+	}
+	return parseModelSpec(spec)
+}
+
+// validateAliases rejects alias cycles and aliases whose target is neither
+// another alias nor a provider/model reference.
+func validateAliases(aliases map[string]string) error {
+	for name := range aliases {
+		chain := []string{name}
+		current := name
+		for {
+			target := aliases[current]
+			if _, isAlias := aliases[target]; isAlias {
+				for _, seen := range chain {
+					if seen == target {
+						return fmt.Errorf("alias cycle: %s -> %s", strings.Join(chain, " -> "), target)
+					}
+				}
+				chain = append(chain, target)
+				current = target
+				continue
+			}
+			if provider, _ := parseModelSpec(target); provider == "" {
+				return fmt.Errorf("alias '%s' points to '%s', which is neither an alias nor a provider/model reference", current, target)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// aliasesFor returns the aliases that resolve to provider/model, sorted.
+func (c *Config) aliasesFor(provider Provider, model string) []string {
+	var names []string
+	for name := range c.Aliases {
+		if p, m := c.resolveModel(name); p == provider && m == model {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// gatherSources collects the files given with -f, the pages given with
+// --url and the output of the --exec commands as context sources for the
+// prompt.
+func gatherSources(config *Config, opts *options) ([]contextSource, error) {
+	var sources []contextSource
+	for _, path := range opts.files {
+		content, err := readAttachment(path)
+		if err != nil {
+			return nil, err
+		}
+		content = tabularInput(path, content, opts)
+		if opts.verbose || opts.dryRun {
+			notef("Attached %s: %s text\n", path, formatBytes(len(content)))
+		}
+		sources = append(sources, contextSource{Name: path, Content: content})
+	}
+
+	if len(opts.urls) > 0 {
+		pages, err := fetchURLs(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, pages...)
+	}
+
+	if len(opts.execs) > 0 {
+		outputs, err := runExecCommands(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, outputs...)
+	}
+	return sources, nil
+}
+
+// readAttachment returns the text of a -f file. PDFs are reduced to their
+// text layer; other binary files are rejected.
+func readAttachment(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	if bytes.HasPrefix(data, []byte("%PDF-")) || strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return extractPDFText(path, data)
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("%s is a binary file and can't be attached", path)
+	}
+	return string(data), nil
+}
+
+// extractPDFText returns the text of every page, each preceded by a page
+// marker so answers can refer to pages. PDFs without a text layer, such as
+// scans or encrypted files, are an error.
+func extractPDFText(path string, data []byte) (string, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		if errors.Is(err, pdf.ErrInvalidPassword) {
+			return "", fmt.Errorf("%s: PDF is encrypted, no extractable text", path)
+		}
+		return "", fmt.Errorf("%s: failed to read PDF: %w", path, err)
+	}
+
+	var b strings.Builder
+	found := false
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to read page %d: %w", path, i, err)
+		}
+		text = strings.TrimSpace(text)
+		if text != "" {
+			found = true
+		}
+		fmt.Fprintf(&b, "[Page %d]\n%s\n\n", i, text)
+	}
+
+	if !found {
+		return "", fmt.Errorf("%s: no extractable text (scanned or image-only PDF?)", path)
+	}
+	return strings.TrimSpace(b.String()) + "\n", nil
+}
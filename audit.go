@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditLogMaxBytes = 10 << 20
+	// auditLogBackups is how many rotated audit logs (<path>.1 ... <path>.N)
+	// are kept.
+	auditLogBackups = 5
+)
+
+// auditRecord is one line in the audit log.
+type auditRecord struct {
+	Time         time.Time       `json:"time"`
+	Provider     Provider        `json:"provider"`
+	Model        string          `json:"model"`
+	PromptSHA256 string          `json:"prompt_sha256"`
+	Bytes        int             `json:"bytes"`
+	Messages     []OpenAIMessage `json:"messages,omitempty"`
+}
+
+// auditRequest appends req to the configured audit log before it is sent.
+// If the log can't be written the request must not be sent.
+func auditRequest(req *chatRequest) error {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	if config.AuditLog == "" || (req.Provider.isLocal() && !config.AuditLogLocal) {
+		return nil
+	}
+
+	prompt, err := json.Marshal(req.Messages)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(prompt)
+	record := auditRecord{
+		Time:         time.Now().UTC(),
+		Provider:     req.Provider,
+		Model:        req.Model,
+		PromptSHA256: hex.EncodeToString(sum[:]),
+		Bytes:        len(prompt),
+	}
+	if config.AuditLogContent {
+		record.Messages = req.Messages
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	maxBytes := config.AuditLogMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultAuditLogMaxBytes
+	}
+	if err := appendRotating(expandHome(config.AuditLog), data, maxBytes); err != nil {
+		return fmt.Errorf("failed to write audit log, request not sent: %w", err)
+	}
+	return nil
+}
+
+// appendRotating appends data to the log at path, which is only ever opened
+// for appending and readable by the owner alone. If the log would grow beyond
+// maxBytes it is rotated to <path>.1 first.
+func appendRotating(path string, data []byte, maxBytes int64) error {
+	return withFileLock(path, func() error {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 && info.Size()+int64(len(data)) > maxBytes {
+			for i := auditLogBackups - 1; i >= 1; i-- {
+				os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+			}
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, rest)
+	}
+	return path
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultBatchParallel = 4
+
+// batchItem is one line of the batch output.
+type batchItem struct {
+	Line   int    `json:"line"` // 1-based line number in the input
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchResult is the answer to one unique request.
+type batchResult struct {
+	output string
+	err    error
+}
+
+// batchStateRecord is one completed request in a --batch-state file.
+type batchStateRecord struct {
+	Key    string `json:"key"`
+	Output string `json:"output"`
+}
+
+// batchCommand runs the instruction once per input line and writes the
+// results as JSON lines in input order. It fails with exitFailure if any
+// input did.
+func batchCommand(args []string, opts *options) error {
+	inputFile := ""
+	stateFile := ""
+	parallel := defaultBatchParallel
+	dedupe := true
+	var instruction []string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-i", "--input":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s flag requires a filename argument", args[i])
+			}
+			inputFile = args[i+1]
+			i++
+		case "--parallel":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--parallel flag requires a number")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid --parallel value: %s", args[i+1])
+			}
+			parallel = n
+			i++
+		case "--batch-state":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--batch-state flag requires a filename argument")
+			}
+			stateFile = args[i+1]
+			i++
+		case "--no-dedupe":
+			dedupe = false
+		default:
+			instruction = append(instruction, args[i])
+		}
+	}
+
+	lines, err := readBatchInputs(inputFile)
+	if err != nil {
+		return err
+	}
+	if err := ensureConfigExists(); err != nil {
+		return err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := validateOptions(config, opts); err != nil {
+		return err
+	}
+
+	// files and pages are read once and shared by all inputs
+	sources, err := gatherSources(config, opts)
+	if err != nil {
+		return err
+	}
+
+	// assemble all requests up front so identical ones can be sent once
+	items := make([]batchItem, 0, len(lines))
+	keys := make([]string, 0, len(lines))
+	requests := make(map[string]*chatRequest)
+	var order []string
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		input := userInput{Prompt: strings.Join(instruction, " "), Piped: line, Sources: sources}
+		prompt, err := preProcessPrompt(config, composePrompt(config, opts, input))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		req, source := buildRequest(config, opts, prompt)
+
+		key := requestKey(req)
+		if !dedupe {
+			key += ":" + strconv.Itoa(i)
+		}
+		if _, ok := requests[key]; !ok {
+			requests[key] = req
+			order = append(order, key)
+			if opts.dryRun && len(order) == 1 {
+				printDryRun(req, source)
+			}
+		}
+		items = append(items, batchItem{Line: i + 1, Input: line})
+		keys = append(keys, key)
+	}
+
+	if opts.dryRun {
+		fmt.Printf("\n%d inputs, %d unique prompts would be sent\n", len(items), len(order))
+		return nil
+	}
+
+	// requests completed by an earlier run are not sent again
+	unique := len(order)
+	resumed := 0
+	results := make(map[string]batchResult)
+	if stateFile != "" {
+		done, err := loadBatchState(stateFile)
+		if err != nil {
+			return err
+		}
+		var pending []string
+		for _, key := range order {
+			if output, ok := done[key]; ok {
+				results[key] = batchResult{output: output}
+			} else {
+				pending = append(pending, key)
+			}
+		}
+		resumed = len(order) - len(pending)
+		if resumed > 0 {
+			fmt.Fprintf(os.Stderr, "Resuming: %d of %d prompts already completed\n", resumed, len(order))
+		}
+		order = pending
+	}
+
+	opts.batch = true
+	runBatch(order, requests, parallel, stateFile, results, opts)
+
+	var out strings.Builder
+	failed := 0
+	for i := range items {
+		result := results[keys[i]]
+		if result.err != nil {
+			items[i].Error = result.err.Error()
+			failed++
+		} else {
+			items[i].Output = result.output
+		}
+		data, err := json.Marshal(items[i])
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+
+	// -o names with placeholders get a file per answer, filled in with the
+	// item's input and model; the others get the JSON lines
+	var perItem, whole []string
+	for _, name := range opts.outputFiles {
+		if outputPlaceholderPattern.MatchString(name) {
+			perItem = append(perItem, name)
+		} else {
+			whole = append(whole, name)
+		}
+	}
+	for i, item := range items {
+		if len(perItem) == 0 || item.Error != "" {
+			continue
+		}
+		req := requests[keys[i]]
+		itemOpts := *opts
+		itemOpts.outputFiles = perItem
+		itemOpts.prompt = item.Input
+		itemOpts.answered = &answerStats{provider: req.Provider, model: req.Model}
+		if err := writeAnswer(item.Output, &itemOpts); err != nil {
+			return fmt.Errorf("line %d: %w", item.Line, err)
+		}
+	}
+	if err := writeOutput(out.String(), whole); err != nil {
+		return err
+	}
+
+	if dedupe {
+		fmt.Fprintf(os.Stderr, "%d inputs, %d unique prompts, %d duplicates served from memory", len(items), unique, len(items)-unique)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d inputs, %d requests", len(items), unique)
+	}
+	if resumed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d resumed from state", resumed)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d failed", failed)
+	}
+	fmt.Fprintln(os.Stderr)
+	if failed > 0 {
+		// the errors are in the output and the summary already
+		return &exitError{code: exitFailure}
+	}
+	return nil
+}
+
+// runBatch sends the requests with up to parallel workers and stores the
+// answers in results. With a state file, each successful answer is appended
+// to it as soon as it arrives.
+func runBatch(order []string, requests map[string]*chatRequest, parallel int, stateFile string, results map[string]batchResult, opts *options) {
+	bar := startProgress(len(order))
+	defer bar.finish()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	queue := make(chan string)
+	for range min(parallel, len(order)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				req := requests[key]
+				result, err := sendRequest(req, opts)
+				output, cost := "", 0.0
+				if err != nil {
+					notef("Error: %v\n", err)
+				} else {
+					output = result.Content
+					cost = completionCost(req, result)
+					if stateFile != "" {
+						if err := appendJSONLine(stateFile, batchStateRecord{Key: key, Output: output}); err != nil {
+							notef("Warning: failed to update batch state: %v\n", err)
+						}
+					}
+				}
+				bar.complete(cost)
+				mu.Lock()
+				results[key] = batchResult{output: output, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range order {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// loadBatchState reads the completed requests from a state file. A missing
+// file means nothing has been completed yet.
+func loadBatchState(path string) (map[string]string, error) {
+	done := make(map[string]string)
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return done, nil
+		}
+		return nil, fmt.Errorf("failed to open batch state: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record batchStateRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // a line cut off by a crash
+		}
+		done[record.Key] = record.Output
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch state: %w", err)
+	}
+	return done, nil
+}
+
+// readBatchInputs reads the input lines from file or, if file is empty, from
+// stdin.
+func readBatchInputs(file string) ([]string, error) {
+	var r io.Reader
+	switch {
+	case file != "":
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open batch input: %w", err)
+		}
+		defer f.Close()
+		r = f
+	case isPiped():
+		r = os.Stdin
+	default:
+		return nil, fmt.Errorf("batch needs input lines: use -i <file> or pipe them in")
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch input: %w", err)
+	}
+	return lines, nil
+}
+
+// requestKey identifies identical requests.
+func requestKey(req *chatRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBatchOutputNamesAndFailures(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt := req.Messages[len(req.Messages)-1].Content
+		if strings.Contains(prompt, "broken") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": "bad input"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "about " + prompt[strings.LastIndex(prompt, "\n")+1:]}, "finish_reason": "stop"}},
+		})
+	}))
+	defer provider.Close()
+	defer func(url string) { openAIBaseURL = url }(openAIBaseURL)
+	openAIBaseURL = provider.URL
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "test")
+	if err := saveConfig(&Config{Provider: OpenAI, Model: "gpt-5-mini"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("red apples\nbroken line\ngreen pears\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdout := captureStdout(t)
+	opts := &options{outputFiles: []string{filepath.Join(dir, "answers", "{model}-{slug}.md")}}
+
+	err := batchCommand([]string{"-i", input, "Describe:"}, opts)
+
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != exitFailure {
+		t.Errorf("err = %v, want exit code %d for the failed line", err, exitFailure)
+	}
+	for name, want := range map[string]string{
+		"gpt-5-mini-red-apples.md":  "about red apples",
+		"gpt-5-mini-green-pears.md": "about green pears",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "answers", name))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "answers")); len(entries) != 2 {
+		t.Errorf("%d files written, want one per answer", len(entries))
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], `"error"`) {
+		t.Errorf("stdout = %q, want the three JSON lines", lines)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultBenchPrompt = "Write a haiku about the sea."
+
+// benchResult holds the measurements for one model.
+type benchResult struct {
+	Provider     Provider `json:"provider"`
+	Model        string   `json:"model"`
+	Runs         int      `json:"runs"`
+	Failures     int      `json:"failures"`
+	MedianMS     int64    `json:"median_ms"`
+	P95MS        int64    `json:"p95_ms"`
+	TokensPerSec float64  `json:"tokens_per_sec"`
+	WarmupMS     int64    `json:"warmup_ms,omitempty"`
+	// FirstMS is the latency of the first timed run, which pays for
+	// connection setup unless the warm-up already did.
+	FirstMS int64 `json:"first_ms"`
+	// Connections is how many connections the timed runs opened; the rest
+	// reused a pooled connection.
+	Connections int    `json:"connections"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// benchCommand runs a prompt against several models and reports latency and
+// throughput.
+func benchCommand(args []string, opts *options) error {
+	specs := opts.models
+	prompt := defaultBenchPrompt
+	runs := 5
+	jsonOutput := opts.json
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--prompt":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--prompt flag requires an argument")
+			}
+			prompt = args[i+1]
+			i++
+		case "--runs":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--runs flag requires a number")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid --runs value: %s", args[i+1])
+			}
+			runs = n
+			i++
+		default:
+			return fmt.Errorf("unknown bench flag: %s", args[i])
+		}
+	}
+
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		if config.Model == "" {
+			return fmt.Errorf("no --model given and no model configured")
+		}
+		specs = append(specs, string(config.Provider)+"/"+config.Model)
+	}
+
+	messages := []OpenAIMessage{{Role: "user", Content: prompt}}
+
+	var results []benchResult
+	for _, spec := range specs {
+		provider, model := config.resolveModel(spec)
+		if provider == "" {
+			return fmt.Errorf("model %q must be an alias or provider/model (e.g. ollama/llama3.2)", spec)
+		}
+		if err := checkOffline(config, opts, provider); err != nil {
+			return err
+		}
+		if !jsonOutput {
+			fmt.Fprintf(os.Stderr, "Benchmarking [%s] %s (%d runs)...\n", provider, model, runs)
+		}
+		req := &chatRequest{Provider: provider, Model: model, Messages: messages, Temperature: opts.temperature, Tags: requestTags(opts), User: requestUser(config)}
+		results = append(results, benchModel(req, runs))
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tRUNS\tFAILED\tFIRST\tMEDIAN\tP95\tTOK/S\tCONNS\tWARM-UP")
+	for _, r := range results {
+		warmup := "-"
+		if r.WarmupMS > 0 {
+			warmup = formatMS(r.WarmupMS)
+		}
+		fmt.Fprintf(w, "[%s] %s\t%d\t%d\t%s\t%s\t%s\t%.1f\t%d\t%s\n",
+			r.Provider, r.Model, r.Runs, r.Failures, formatMS(r.FirstMS), formatMS(r.MedianMS), formatMS(r.P95MS), r.TokensPerSec, r.Connections, warmup)
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.LastError != "" {
+			fmt.Fprintf(os.Stderr, "[%s] %s last error: %s\n", r.Provider, r.Model, r.LastError)
+		}
+	}
+	return nil
+}
+
+// benchModel runs the measurement for a single model. Ollama models get an
+// untimed warm-up run first so model loading doesn't skew the latencies.
+func benchModel(req *chatRequest, runs int) benchResult {
+	result := benchResult{Provider: req.Provider, Model: req.Model, Runs: runs}
+
+	if req.Provider == Ollama {
+		start := time.Now()
+		if _, err := executeRequest(req, nil); err != nil {
+			result.LastError = err.Error()
+		}
+		result.WarmupMS = time.Since(start).Milliseconds()
+	}
+
+	var latencies []time.Duration
+	var tokens int
+	var generation time.Duration
+	dialed := connectionsOpened.Load()
+	for i := range runs {
+		start := time.Now()
+		resp, err := executeRequest(req, nil)
+		elapsed := time.Since(start)
+		if i == 0 {
+			result.FirstMS = elapsed.Milliseconds()
+		}
+		if err != nil {
+			result.Failures++
+			result.LastError = err.Error()
+			continue
+		}
+		latencies = append(latencies, elapsed)
+
+		tokens += resp.CompletionTokens
+		if resp.EvalDuration > 0 {
+			generation += resp.EvalDuration
+		} else {
+			generation += elapsed
+		}
+	}
+
+	result.Connections = int(connectionsOpened.Load() - dialed)
+
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		result.MedianMS = percentile(latencies, 50).Milliseconds()
+		result.P95MS = percentile(latencies, 95).Milliseconds()
+	}
+	if generation > 0 {
+		result.TokensPerSec = float64(tokens) / generation.Seconds()
+	}
+	return result
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func formatMS(ms int64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", float64(ms)/1000)
+	}
+	return fmt.Sprintf("%dms", ms)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ModelCapabilities describes what a model supports. Unset fields are
+// unknown.
+type ModelCapabilities struct {
+	Vision        *bool `json:"vision,omitempty"`
+	Tools         *bool `json:"tools,omitempty"`
+	JSONMode      *bool `json:"json_mode,omitempty"`
+	ContextWindow int   `json:"context_window,omitempty"` // in tokens
+}
+
+func supports(b bool) *bool {
+	return &b
+}
+
+// builtinCapabilities lists the built-in OpenAI models.
+var builtinCapabilities = map[string]ModelCapabilities{
+	"openai/gpt-5-nano": {Vision: supports(true), Tools: supports(true), JSONMode: supports(true), ContextWindow: 400_000},
+	"openai/gpt-5-mini": {Vision: supports(true), Tools: supports(true), JSONMode: supports(true), ContextWindow: 400_000},
+	"openai/gpt-5.2":    {Vision: supports(true), Tools: supports(true), JSONMode: supports(true), ContextWindow: 400_000},
+}
+
+// ollamaFamilyCapabilities lists common Ollama model families. A model
+// belongs to the longest family its name starts with, e.g.
+// "llama3.2-vision:11b" to "llama3.2-vision". Every Ollama model can
+// answer in JSON, since Ollama constrains the output itself.
+var ollamaFamilyCapabilities = map[string]ModelCapabilities{
+	"llama3.1":        {Vision: supports(false), Tools: supports(true)},
+	"llama3.2":        {Vision: supports(false), Tools: supports(true)},
+	"llama3.2-vision": {Vision: supports(true), Tools: supports(false)},
+	"llama3.3":        {Vision: supports(false), Tools: supports(true)},
+	"llava":           {Vision: supports(true), Tools: supports(false)},
+	"qwen2.5":         {Vision: supports(false), Tools: supports(true)},
+	"qwen2.5vl":       {Vision: supports(true), Tools: supports(false)},
+	"qwen3":           {Vision: supports(false), Tools: supports(true)},
+	"mistral":         {Vision: supports(false), Tools: supports(true)},
+	"gemma2":          {Vision: supports(false), Tools: supports(false)},
+	"gemma3":          {Vision: supports(true), Tools: supports(false)},
+	"phi3":            {Vision: supports(false), Tools: supports(false)},
+	"phi4":            {Vision: supports(false), Tools: supports(false)},
+	"deepseek-r1":     {Vision: supports(false), Tools: supports(false)},
+}
+
+// override sets the fields that other knows.
+func (c *ModelCapabilities) override(other ModelCapabilities) {
+	if other.Vision != nil {
+		c.Vision = other.Vision
+	}
+	if other.Tools != nil {
+		c.Tools = other.Tools
+	}
+	if other.JSONMode != nil {
+		c.JSONMode = other.JSONMode
+	}
+	if other.ContextWindow > 0 {
+		c.ContextWindow = other.ContextWindow
+	}
+}
+
+// applyOllamaShow adds what Ollama reports about a model. Older Ollama
+// versions report no capabilities.
+func (c *ModelCapabilities) applyOllamaShow(show *OllamaShowResponse) {
+	if show.Capabilities != nil {
+		c.Tools = supports(slices.Contains(show.Capabilities, "tools"))
+		c.Vision = supports(slices.Contains(show.Capabilities, "vision"))
+	}
+	if window := show.contextLength(); window > 0 {
+		c.ContextWindow = window
+	}
+}
+
+// summary lists the supported features, e.g. "vision, tools, json".
+func (c ModelCapabilities) summary() string {
+	var features []string
+	for _, feature := range capabilityFeatures {
+		if supported := feature.get(c); supported != nil && *supported {
+			features = append(features, feature.short)
+		}
+	}
+	return strings.Join(features, ", ")
+}
+
+// knownCapabilities returns what the built-in tables and model_capabilities
+// say about a model, without asking the provider. known is false if none
+// of them lists it.
+func knownCapabilities(config *Config, provider Provider, model string) (caps ModelCapabilities, known bool) {
+	spec := string(provider) + "/" + model
+	if builtin, ok := builtinCapabilities[spec]; ok {
+		caps, known = builtin, true
+	}
+	if provider == Ollama {
+		caps.JSONMode = supports(true)
+		if family := ollamaFamily(model); family != "" {
+			caps.override(ollamaFamilyCapabilities[family])
+			known = true
+		}
+	}
+	if caps.applyConfig(config, provider, model) {
+		known = true
+	}
+	return caps, known
+}
+
+// applyConfig adds model_capabilities from the configuration, where a
+// "provider/model" entry wins over a model entry. It reports whether there
+// was any.
+func (c *ModelCapabilities) applyConfig(config *Config, provider Provider, model string) bool {
+	found := false
+	for _, key := range []string{model, string(provider) + "/" + model} {
+		if configured, ok := config.ModelCapabilities[key]; ok {
+			c.override(configured)
+			found = true
+		}
+	}
+	return found
+}
+
+// modelCapabilities is knownCapabilities completed by what Ollama reports
+// about its models; model_capabilities still wins.
+func modelCapabilities(config *Config, provider Provider, model string) (ModelCapabilities, bool) {
+	caps, known := knownCapabilities(config, provider, model)
+	if provider != Ollama {
+		return caps, known
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	show, err := fetchOllamaShow(ctx, model)
+	if err != nil {
+		return caps, known
+	}
+	caps.applyOllamaShow(show)
+	caps.applyConfig(config, provider, model)
+	return caps, known || show.Capabilities != nil
+}
+
+// ollamaFamily returns the longest family of ollamaFamilyCapabilities the
+// model's name starts with, or "".
+func ollamaFamily(model string) string {
+	name, _, _ := strings.Cut(model, ":")
+	family := ""
+	for candidate := range ollamaFamilyCapabilities {
+		if strings.HasPrefix(name, candidate) && len(candidate) > len(family) {
+			family = candidate
+		}
+	}
+	return family
+}
+
+// capabilityFeature is a feature a request can need.
+type capabilityFeature struct {
+	name  string // for messages
+	short string // for listings
+	get   func(ModelCapabilities) *bool
+}
+
+var capabilityFeatures = []capabilityFeature{
+	{"vision", "vision", func(c ModelCapabilities) *bool { return c.Vision }},
+	{"tools", "tools", func(c ModelCapabilities) *bool { return c.Tools }},
+	{"JSON mode", "json", func(c ModelCapabilities) *bool { return c.JSONMode }},
+}
+
+// capabilityWarnings remembers the warnings about unknown capabilities
+// that were printed, so batch runs print each once.
+var capabilityWarnings sync.Map
+
+// checkCapabilities fails before sending if the model of req lacks a
+// feature the request needs, and names models that have it. If it is
+// unknown whether the model has it, only a warning is printed.
+func checkCapabilities(config *Config, req *chatRequest) error {
+	var needed []capabilityFeature
+	if len(req.Tools) > 0 {
+		needed = append(needed, capabilityFeatures[1])
+	}
+	if req.Format != nil {
+		needed = append(needed, capabilityFeatures[2])
+	}
+
+	caps, _ := modelCapabilities(config, req.Provider, req.Model)
+	for _, feature := range needed {
+		supported := feature.get(caps)
+		switch {
+		case supported == nil:
+			warning := fmt.Sprintf("it is unknown whether %s/%s supports %s; describe it in model_capabilities", req.Provider, req.Model, feature.name)
+			if _, warned := capabilityWarnings.LoadOrStore(warning, true); !warned {
+				notef("Warning: %s\n", warning)
+			}
+		case !*supported:
+			message := fmt.Sprintf("model %s does not support %s", req.Model, feature.name)
+			if alternatives := capableModels(config, feature, req.Model); len(alternatives) > 0 {
+				message += "; try " + strings.Join(alternatives, " or ")
+			}
+			return &exitError{code: exitUsage, err: fmt.Errorf("%s", message)}
+		}
+	}
+
+	if caps.ContextWindow > 0 && estimateMessageTokens(req.Messages) > caps.ContextWindow/2 {
+		// counted only for long prompts, since it may ask the provider
+		if tokens := countMessageTokens(req); tokens.n > caps.ContextWindow {
+			notef("Warning: the prompt of %s tokens exceeds the %s context window of %s\n", tokens, formatContextWindow(caps.ContextWindow), req.Model)
+		}
+	}
+	return nil
+}
+
+// capableModels names up to two installed Ollama models and one OpenAI
+// model known to support feature.
+func capableModels(config *Config, feature capabilityFeature, exclude string) []string {
+	var names []string
+	if installed, err := getInstalledModels(); err == nil {
+		for _, model := range installed {
+			caps, _ := knownCapabilities(config, Ollama, model)
+			if supported := feature.get(caps); model != exclude && supported != nil && *supported {
+				names = append(names, model)
+			}
+			if len(names) == 2 {
+				break
+			}
+		}
+	}
+	for _, model := range getOpenAIModels() {
+		caps, _ := knownCapabilities(config, OpenAI, model)
+		if supported := feature.get(caps); model != exclude && supported != nil && *supported {
+			return append(names, model)
+		}
+	}
+	return names
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogMaxAge is how old the built-in OpenAI catalog may get before it
+// is considered outdated.
+const catalogMaxAge = 180 * 24 * time.Hour
+
+// catalogDate is when the built-in OpenAI models (getOpenAIModels) and
+// their prices (openAIPrices) were last brought up to date. Change it
+// whenever they are.
+var catalogDate = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// catalogOutdated reports whether the built-in OpenAI catalog is older than
+// catalogMaxAge, so newer models are missing and prices may have changed.
+func catalogOutdated() bool {
+	return time.Since(catalogDate) > catalogMaxAge
+}
+
+// noteOutdatedCatalog tells the user once that the built-in OpenAI catalog
+// is outdated. That it was told is remembered per catalog, so upgrading to
+// an outdated release tells again; without a state directory it is never
+// told, since it would be on every run.
+var noteOutdatedCatalog = sync.OnceFunc(func() {
+	if !catalogOutdated() || stateDisabled() {
+		return
+	}
+	date := catalogDate.Format(time.DateOnly)
+	path := filepath.Join(getStateDir(), "cache", "catalog-noted")
+	if data, err := os.ReadFile(path); err == nil && string(data) == date {
+		return
+	}
+	notef("Note: the built-in OpenAI models and prices are from %s and may be outdated; 'ai-cli models --refresh' lists newer models your key can access, and upgrading ai-cli updates both\n", date)
+	if err := writeFileAtomic(path, []byte(date), 0600); err != nil {
+		notef("Warning: failed to remember the note: %v\n", err)
+	}
+})
+
+// printNewerOpenAIModels names the GPT models the API key can access that
+// are missing from an outdated built-in list, for "models --refresh". They
+// can be used with --model, but their cost isn't known.
+func printNewerOpenAIModels() {
+	if !catalogOutdated() || !hasOpenAIToken() {
+		return
+	}
+	accessible, err := fetchOpenAIModels()
+	if err != nil {
+		notef("Warning: failed to list the OpenAI models of your key: %v\n", err)
+		return
+	}
+	var newer []string
+	for _, model := range accessible {
+		if strings.HasPrefix(model, "gpt-") && !slices.Contains(getOpenAIModels(), model) {
+			newer = append(newer, model)
+		}
+	}
+	if len(newer) > 0 {
+		fmt.Printf("\nOpenAI models not in the built-in list of %s (no prices known, use them with --model openai/<model>):\n  %s\n",
+			catalogDate.Format(time.DateOnly), strings.Join(newer, ", "))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// citationInstruction makes the model name the attached files it refers
+// to, so the answer says where things are.
+const citationInstruction = "The attached files are marked with \"--- Source: <path> ---\" headers. Whenever the answer refers to one of them, name it by exactly that path."
+
+// citedPathPattern finds file paths in an answer, optionally followed by
+// a line number. Only paths ending in an extension of the attachments are
+// checked, so identifiers like fmt.Println don't count.
+var citedPathPattern = regexp.MustCompile(`[\w./-]+\.(\w+)(?::\d+)?`)
+
+// attachedFiles returns the files attached to the prompt with -f and as
+// #path references.
+func attachedFiles(opts *options, references []contextSource) []string {
+	files := slices.Clone(opts.files)
+	for _, reference := range references {
+		files = append(files, reference.Name)
+	}
+	return files
+}
+
+// uncitablePaths returns the file paths cited in answer that are none of
+// the attached files, ignoring code blocks. A path matches an attached
+// file if it is the same path or its base name.
+func uncitablePaths(answer string, files []string) []string {
+	extensions := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, file := range files {
+		extensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))] = true
+		known[filepath.Clean(file)] = true
+		known[filepath.Base(file)] = true
+	}
+
+	var unknown []string
+	inCode := false
+	for line := range strings.Lines(answer) {
+		if isFenceLine([]byte(line)) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range citedPathPattern.FindAllStringSubmatchIndex(line, -1) {
+			// the path of a URL follows the scheme's colon
+			if (m[0] > 0 && line[m[0]-1] == ':') || !extensions[strings.ToLower(line[m[2]:m[3]])] {
+				continue
+			}
+			path, _, _ := strings.Cut(line[m[0]:m[1]], ":")
+			path = strings.TrimPrefix(path, "./")
+			if !known[filepath.Clean(path)] && !slices.Contains(unknown, path) {
+				unknown = append(unknown, path)
+			}
+		}
+	}
+	return unknown
+}
+
+// warnUncitablePaths flags files the answer cites that weren't attached,
+// which the model likely made up.
+func warnUncitablePaths(answer string, files []string) {
+	if unknown := uncitablePaths(answer, files); len(unknown) > 0 {
+		notef("Warning: the answer cites files that weren't attached: %s\n", strings.Join(unknown, ", "))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUncitablePaths(t *testing.T) {
+	files := []string{"internal/server/handler.go", "./main.go", "docs/README.md"}
+	tests := []struct {
+		name   string
+		answer string
+		want   []string
+	}{
+		{name: "attached path", answer: "See internal/server/handler.go for the route.", want: nil},
+		{name: "base name", answer: "The bug is in handler.go:42.", want: nil},
+		{name: "dot slash prefix", answer: "Start in ./main.go and docs/README.md.", want: nil},
+		{name: "with line number", answer: "main.go:12 calls it.", want: nil},
+		{name: "made up path", answer: "Look at internal/server/router.go:10.", want: []string{"internal/server/router.go"}},
+		{name: "made up base name", answer: "Change util.go and util.go again.", want: []string{"util.go"}},
+		{name: "other extension", answer: "Edit config.yaml and run main.py.", want: nil},
+		{name: "case of the extension", answer: "See NOTES.MD.", want: []string{"NOTES.MD"}},
+		{name: "identifiers", answer: "Call fmt.Println and os.Exit.", want: nil},
+		{name: "URL", answer: "Read https://example.com/pkg/server.go first.", want: nil},
+		{name: "code block", answer: "Like this:\n```go\n// from other.go\nfunc f() {}\n```\nthen run it.", want: nil},
+		{name: "after a code block", answer: "```\nx\n```\nsee other.go", want: []string{"other.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uncitablePaths(tt.answer, files); !slices.Equal(got, tt.want) {
+				t.Errorf("uncitablePaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUncitablePathsWithoutAttachments(t *testing.T) {
+	// nothing attached, so no extension is checked
+	if got := uncitablePaths("See main.go and handler.go.", nil); got != nil {
+		t.Errorf("uncitablePaths = %q, want none", got)
+	}
+}
+
+func TestAttachedFiles(t *testing.T) {
+	opts := &options{files: []string{"main.go"}}
+	got := attachedFiles(opts, []contextSource{{Name: "docs/README.md"}})
+	if !slices.Equal(got, []string{"main.go", "docs/README.md"}) {
+		t.Errorf("attachedFiles = %q, want the -f files, then the references", got)
+	}
+	if len(opts.files) != 1 {
+		t.Errorf("attachedFiles changed opts.files to %q", opts.files)
+	}
+}
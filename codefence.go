@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// codeExtractor writes the content of the fenced code blocks of an answer
+// to w as the answer arrives, so --code can stream. A block is written from
+// its opening fence on and ends at a closing fence of the same kind that is
+// at least as long, so a ```` block may contain ``` lines. The indentation
+// of the opening fence is removed from the content lines. Blocks are
+// separated by a blank line.
+type codeExtractor struct {
+	w       io.Writer
+	line    []byte // the current line, up to its line break
+	written int    // how much of line was already written
+	fence   []byte // the opening fence of the current block, nil outside
+	indent  int    // the indentation of the opening fence
+	blocks  int
+	// before is the answer up to the first block. If there is none, it is
+	// written unchanged at the end.
+	before bytes.Buffer
+	err    error
+}
+
+func newCodeExtractor(w io.Writer) *codeExtractor {
+	return &codeExtractor{w: w}
+}
+
+func (e *codeExtractor) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && e.err == nil {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			e.line = append(e.line, p...)
+			break
+		}
+		e.line = append(e.line, p[:i]...)
+		e.endLine()
+		p = p[i+1:]
+	}
+	// content is written as it arrives, unless the line may be the
+	// closing fence
+	if e.fence != nil && e.err == nil && !e.mayBeFence(e.line) {
+		e.writeContent(false)
+	}
+	return n, e.err
+}
+
+// endLine handles the complete current line.
+func (e *codeExtractor) endLine() {
+	line := bytes.TrimSuffix(e.line, []byte("\r"))
+	trimmed := bytes.TrimLeft(line, " \t")
+	switch {
+	case e.fence == nil:
+		if fence := openingFence(trimmed); fence != nil {
+			e.fence, e.indent = fence, len(line)-len(trimmed)
+			if e.blocks++; e.blocks > 1 {
+				e.write([]byte("\n"))
+			}
+		} else if e.blocks == 0 {
+			e.before.Write(e.line)
+			e.before.WriteByte('\n')
+		}
+	case isClosingFence(trimmed, e.fence):
+		e.fence = nil
+	default:
+		e.writeContent(true)
+	}
+	e.line, e.written = e.line[:0], 0
+}
+
+// writeContent writes the part of the current content line that wasn't
+// written yet, without the fence's indentation.
+func (e *codeExtractor) writeContent(complete bool) {
+	skip := 0
+	for skip < e.indent && skip < len(e.line) && e.line[skip] == ' ' {
+		skip++
+	}
+	if start := max(skip, e.written); start < len(e.line) {
+		e.write(e.line[start:])
+	}
+	e.written = len(e.line)
+	if complete {
+		e.write([]byte("\n"))
+	}
+}
+
+// mayBeFence reports whether the incomplete line could still become the
+// closing fence of the current block.
+func (e *codeExtractor) mayBeFence(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, " \t")
+	rest := bytes.TrimLeft(trimmed, string(e.fence[0]))
+	return len(bytes.TrimRight(rest, " \t\r")) == 0
+}
+
+func (e *codeExtractor) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+// Close writes what is left: a last content line without a line break, or
+// the whole answer if it had no code block.
+func (e *codeExtractor) Close() error {
+	switch {
+	case e.blocks == 0:
+		e.write(e.before.Bytes())
+		e.write(e.line)
+	case e.fence != nil && len(e.line) > 0:
+		e.writeContent(false)
+	}
+	return e.err
+}
+
+// warning describes what --code couldn't do with the answer, or is "".
+func (e *codeExtractor) warning() string {
+	switch {
+	case e.blocks == 0:
+		return "the answer contains no code block, printing it unchanged"
+	case e.fence != nil:
+		return "the answer ended inside a code block, printing it as far as it got"
+	}
+	return ""
+}
+
+// openingFence returns the fence a line opens a code block with: three or
+// more backticks or tildes, optionally followed by an info string such as
+// the language. It returns nil for other lines.
+func openingFence(line []byte) []byte {
+	if len(line) == 0 || (line[0] != '`' && line[0] != '~') {
+		return nil
+	}
+	n := len(line) - len(bytes.TrimLeft(line, string(line[0])))
+	if n < 3 || (line[0] == '`' && bytes.IndexByte(line[n:], '`') >= 0) {
+		return nil
+	}
+	return bytes.Clone(line[:n])
+}
+
+// isClosingFence reports whether line closes a block opened with fence: a
+// run of the same character at least as long, and nothing after it.
+func isClosingFence(line, fence []byte) bool {
+	rest := bytes.TrimLeft(line, string(fence[0]))
+	return len(line)-len(rest) >= len(fence) && len(bytes.TrimSpace(rest)) == 0
+}
+
+// extractCode returns the content of the fenced code blocks in an answer,
+// separated by blank lines. Answers without code blocks are kept as they
+// are, and a block missing its closing fence is kept as far as it goes,
+// with a warning for both.
+func extractCode(answer string) string {
+	code, warning := codeOf(answer)
+	if warning != "" {
+		notef("Warning: %s\n", warning)
+	}
+	return code
+}
+
+// codeOf is extractCode without the warning.
+func codeOf(answer string) (code, warning string) {
+	var b strings.Builder
+	e := newCodeExtractor(&b)
+	e.Write([]byte(answer))
+	e.Close()
+	return b.String(), e.warning()
+}
@@ -0,0 +1,40 @@
+package main
+
+import "os"
+
+// ANSI styles for decorated output.
+const (
+	styleDim   = "2"
+	styleRed   = "31"
+	styleGreen = "32"
+	styleReset = "\033[0m"
+)
+
+// colorMode is the --color setting: "auto", "always" or "never".
+var colorMode = "auto"
+
+// useColor reports whether output to f is decorated: always with --color
+// always, never with --color never or NO_COLOR set, and otherwise only if
+// f is a terminal.
+func useColor(f *os.File) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// styled wraps text in the given ANSI style if output to f is decorated.
+// All colored output goes through here, so it can be turned off in one
+// place.
+func styled(f *os.File, style, text string) string {
+	if !useColor(f) {
+		return text
+	}
+	return "\033[" + style + "m" + text + styleReset
+}
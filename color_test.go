@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUseColor(t *testing.T) {
+	// a file is never a terminal, so "auto" leaves it plain
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		mode    string
+		noColor string
+		want    bool
+	}{
+		{mode: "auto", want: false},
+		{mode: "auto", noColor: "1", want: false},
+		{mode: "always", want: true},
+		{mode: "always", noColor: "1", want: true},
+		{mode: "never", want: false},
+		{mode: "never", noColor: "1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/NO_COLOR="+tt.noColor, func(t *testing.T) {
+			setColorMode(t, tt.mode)
+			t.Setenv("NO_COLOR", tt.noColor)
+			if got := useColor(f); got != tt.want {
+				t.Errorf("useColor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeverColorHasNoEscapes(t *testing.T) {
+	setColorMode(t, "never")
+	diff, _ := diffWords("the quick brown fox", "the slow brown dog")
+	outputs := map[string]string{
+		"styled":    styled(os.Stderr, styleDim, "model footer"),
+		"diffWords": diff,
+	}
+	for name, out := range outputs {
+		if strings.Contains(out, "\033") {
+			t.Errorf("%s output %q contains an escape sequence", name, out)
+		}
+	}
+	if diff, _ := diffWords("the quick fox", "the slow fox"); diff != "the [-quick-]{+slow+} fox" {
+		t.Errorf("diff = %q, want the changes marked without color", diff)
+	}
+}
+
+func TestAlwaysColorDecorates(t *testing.T) {
+	setColorMode(t, "always")
+	t.Setenv("NO_COLOR", "1")
+	if got := styled(os.Stderr, styleDim, "x"); got != "\033[2mx\033[0m" {
+		t.Errorf("styled = %q, want it dimmed", got)
+	}
+	if diff, _ := diffWords("a b", "a c"); !strings.Contains(diff, "\033["+styleRed+"mb") || !strings.Contains(diff, "\033["+styleGreen+"mc") {
+		t.Errorf("diff = %q, want the changes in red and green", diff)
+	}
+}
+
+func TestColorFlag(t *testing.T) {
+	for _, value := range []string{"auto", "always", "never"} {
+		opts, _, err := parseOptions([]string{"--color", value, "hi"})
+		if err != nil || opts.color != value {
+			t.Errorf("--color %s: color = %q, err = %v", value, opts.color, err)
+		}
+	}
+	if _, _, err := parseOptions([]string{"--color", "sometimes", "hi"}); err == nil {
+		t.Error("--color sometimes was accepted")
+	}
+}
+
+func setColorMode(t *testing.T, mode string) {
+	t.Helper()
+	previous := colorMode
+	colorMode = mode
+	t.Cleanup(func() { colorMode = previous })
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxDiffCells bounds the size of the word-level comparison table; longer
+// answers are compared line by line instead.
+const maxDiffCells = 4_000_000
+
+var diffTokenPattern = regexp.MustCompile(`\s+|\S+`)
+
+// compareCommand sends the same prompt to several models and prints their
+// answers one after another. With --diff, each answer after the first is
+// also shown as a word-level diff against the first one; with --json the
+// models are asked for JSON, which is compared structurally.
+func compareCommand(args []string, opts *options) error {
+	showDiff := false
+	var words []string
+	for _, arg := range args {
+		if arg == "--diff" {
+			showDiff = true
+		} else {
+			words = append(words, arg)
+		}
+	}
+	if len(opts.models) < 2 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("usage: ai-cli compare --model <a> --model <b> [--diff] [--json] \"prompt\"")}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	input := userInput{Prompt: strings.Join(words, " ")}
+	if isPiped() {
+		piped, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read piped input: %w", err)
+		}
+		input.Piped = strings.TrimSpace(string(piped))
+	}
+	if input.Prompt == "" && input.Piped == "" {
+		return fmt.Errorf("empty prompt")
+	}
+	if input.Sources, err = gatherSources(config, opts); err != nil {
+		return err
+	}
+	var references []contextSource
+	if input.Prompt, references, err = expandFileReferences(input.Prompt, opts); err != nil {
+		return err
+	}
+	input.Sources = append(input.Sources, references...)
+	prompt, err := preProcessPrompt(config, composePrompt(config, opts, input))
+	if err != nil {
+		return err
+	}
+	messages := buildMessages(config, opts, prompt)
+	format, err := opts.answerFormat()
+	if err != nil {
+		return err
+	}
+	jsonMode := format != nil
+
+	// answers are collected before anything is printed, so no streaming
+	// and no interactive recovery in between
+	sendOpts := *opts
+	sendOpts.batch = true
+
+	type answer struct {
+		label   string
+		content string
+	}
+	var answers []answer
+	for _, spec := range opts.models {
+		provider, model := config.resolveModel(spec)
+		if provider == "" {
+			return fmt.Errorf("model %q must be an alias or provider/model (e.g. ollama/llama3.2)", spec)
+		}
+		req := &chatRequest{Provider: provider, Model: model, Messages: slices.Clone(messages), Temperature: opts.temperature, Tags: requestTags(opts), User: requestUser(config)}
+		if jsonMode {
+			requestJSON(req, format)
+		}
+		label := fmt.Sprintf("[%s] %s", provider, model)
+		if opts.dryRun {
+			printDryRun(req, "--model flag")
+			continue
+		}
+
+		start := time.Now()
+		result, err := sendRequest(req, &sendOpts)
+		if err != nil {
+			notef("%s failed: %v\n", label, err)
+			continue
+		}
+		content := normalizeOutput(result.Content)
+		fmt.Printf("=== %s (%.1fs) ===\n%s\n", label, time.Since(start).Seconds(), content)
+		answers = append(answers, answer{label: label, content: content})
+	}
+	if !showDiff || len(answers) < 2 {
+		return nil
+	}
+
+	base := answers[0]
+	for _, other := range answers[1:] {
+		if jsonMode {
+			var a, b any
+			errA, errB := json.Unmarshal([]byte(stripJSONFence(base.content)), &a), json.Unmarshal([]byte(stripJSONFence(other.content)), &b)
+			if errA == nil && errB == nil {
+				var changes []string
+				same, total := diffJSON("$", a, b, &changes)
+				fmt.Printf("=== diff %s vs %s: %d%% of values equal ===\n", base.label, other.label, percent(same, total))
+				for _, change := range changes {
+					fmt.Println(change)
+				}
+				continue
+			}
+			notef("Warning: %s or %s is not valid JSON, comparing the text\n", base.label, other.label)
+		}
+		diff, similarity := diffWords(base.content, other.content)
+		fmt.Printf("=== diff %s vs %s: %d%% similar ===\n%s\n", base.label, other.label, similarity, diff)
+	}
+	return nil
+}
+
+// diffWords marks the words of a that are missing in b as deleted and those
+// only in b as inserted: in red and green, or as [-word-] and {+word+}
+// without color. It also returns how similar the texts are in percent.
+func diffWords(a, b string) (string, int) {
+	tokensA, tokensB := diffTokenPattern.FindAllString(a, -1), diffTokenPattern.FindAllString(b, -1)
+	if len(tokensA)*len(tokensB) > maxDiffCells {
+		tokensA, tokensB = strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n")
+	}
+	ops := diffTokens(tokensA, tokensB)
+
+	var out strings.Builder
+	same, total := 0, 0
+	for _, op := range ops {
+		blank := strings.TrimSpace(op.text) == ""
+		if !blank {
+			total++
+		}
+		switch {
+		case op.kind == '=':
+			out.WriteString(op.text)
+			if !blank {
+				same++
+			}
+		case blank:
+			// changed whitespace is shown once, from the new text
+			if op.kind == '+' {
+				out.WriteString(op.text)
+			}
+		case op.kind == '-':
+			out.WriteString(diffMark(styleRed, "[-", op.text, "-]"))
+		case op.kind == '+':
+			out.WriteString(diffMark(styleGreen, "{+", op.text, "+}"))
+		}
+	}
+	// matching words count for both texts
+	return out.String(), percent(2*same, total+same)
+}
+
+func diffMark(style, open, text, close string) string {
+	if useColor(os.Stdout) {
+		return styled(os.Stdout, style, text)
+	}
+	return open + text + close
+}
+
+// diffOp is a token of a diff: '=' in both texts, '-' only in the first
+// and '+' only in the second.
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffTokens computes a shortest edit script between a and b from their
+// longest common subsequence.
+func diffTokens(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{'=', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// diffJSON compares two decoded JSON values and appends a line for every
+// value that was removed (-), added (+) or changed (~), by its path such as
+// "$.items[2].name". It returns how many of the values are equal and how
+// many were compared.
+func diffJSON(path string, a, b any, changes *[]string) (same, total int) {
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			keys := slices.Sorted(maps.Keys(a))
+			for _, key := range slices.Sorted(maps.Keys(b)) {
+				if _, ok := a[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			for _, key := range keys {
+				s, t := diffJSONChild(path+"."+key, a, b, key, changes)
+				same, total = same+s, total+t
+			}
+			return same, total
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			for i := range max(len(a), len(b)) {
+				childPath := fmt.Sprintf("%s[%d]", path, i)
+				var s, t int
+				switch {
+				case i >= len(b):
+					*changes = append(*changes, diffMark(styleRed, "", "- "+childPath+": "+jsonText(a[i]), ""))
+					t = 1
+				case i >= len(a):
+					*changes = append(*changes, diffMark(styleGreen, "", "+ "+childPath+": "+jsonText(b[i]), ""))
+					t = 1
+				default:
+					s, t = diffJSON(childPath, a[i], b[i], changes)
+				}
+				same, total = same+s, total+t
+			}
+			return same, total
+		}
+	}
+
+	if jsonText(a) == jsonText(b) {
+		return 1, 1
+	}
+	*changes = append(*changes, fmt.Sprintf("~ %s: %s → %s", path, jsonText(a), jsonText(b)))
+	return 0, 1
+}
+
+// diffJSONChild compares the key of two objects, which may be missing in
+// either.
+func diffJSONChild(path string, a, b map[string]any, key string, changes *[]string) (int, int) {
+	valueA, inA := a[key]
+	valueB, inB := b[key]
+	switch {
+	case !inB:
+		*changes = append(*changes, diffMark(styleRed, "", "- "+path+": "+jsonText(valueA), ""))
+		return 0, 1
+	case !inA:
+		*changes = append(*changes, diffMark(styleGreen, "", "+ "+path+": "+jsonText(valueB), ""))
+		return 0, 1
+	}
+	return diffJSON(path, valueA, valueB, changes)
+}
+
+func jsonText(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func percent(part, whole int) int {
+	if whole == 0 {
+		return 100
+	}
+	return part * 100 / whole
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// assumedCompletionTokens is the answer length assumed for the cost
+// estimate of a request without --max-tokens.
+const assumedCompletionTokens = 1000
+
+// confirmCost asks before a single request whose estimated cost exceeds
+// cost_confirm_usd is sent, which catches a whole repository attached by
+// accident. The estimate covers the prompt and an answer of --max-tokens
+// or assumedCompletionTokens. Without a terminal the request is refused;
+// --yes sends it anyway. Local providers cost nothing and are never asked
+// about.
+func confirmCost(config *Config, req *chatRequest, opts *options) error {
+	if config.CostConfirmUSD <= 0 || opts.yes || opts.batch || req.Provider.isLocal() {
+		return nil
+	}
+	if _, ok := openAIPrices[req.Model]; !ok || req.Provider != OpenAI {
+		// without a price there is no estimate, so the prompt isn't counted
+		return nil
+	}
+	completion := req.MaxTokens
+	if completion <= 0 {
+		completion = assumedCompletionTokens
+	}
+	tokens := countMessageTokens(req)
+	cost := estimateCost(req.Provider, req.Model, tokens.n, completion)
+	if cost <= config.CostConfirmUSD {
+		return nil
+	}
+	estimate := fmt.Sprintf("est. $%.2f for %s prompt tokens", cost, tokens)
+
+	tty, err := openTerminal()
+	if err != nil || !isTerminal(os.Stderr) {
+		return &exitError{code: exitUsage, err: fmt.Errorf("the request to %s/%s (%s) exceeds cost_confirm_usd of $%.2f; use --yes to send it anyway",
+			req.Provider, req.Model, estimate, config.CostConfirmUSD)}
+	}
+	defer tty.Close()
+
+	notef("This request to %s/%s costs %s, above cost_confirm_usd of $%.2f — continue? [y/N]: ", req.Provider, req.Model, estimate, config.CostConfirmUSD)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("cancelled, nothing was sent")
+	}
+	return nil
+}
+
+// checkInputCost refuses a request whose prompt alone is estimated to cost
+// more than --max-input-cost. Unlike cost_confirm_usd it never asks and
+// --yes doesn't lift it. Models without a known price can't be checked and
+// are sent with a warning; local providers cost nothing.
+func checkInputCost(req *chatRequest, opts *options) error {
+	if opts.maxInputUSD <= 0 || req.Provider.isLocal() {
+		return nil
+	}
+	if _, ok := openAIPrices[req.Model]; !ok || req.Provider != OpenAI {
+		notef("Warning: no price is known for %s/%s, so --max-input-cost can't be checked\n", req.Provider, req.Model)
+		return nil
+	}
+	tokens := countMessageTokens(req)
+	cost := estimateCost(req.Provider, req.Model, tokens.n, 0)
+	if cost <= opts.maxInputUSD {
+		return nil
+	}
+	return &exitError{code: exitUsage, err: fmt.Errorf("the prompt to %s/%s (est. $%.2f for %s tokens) exceeds --max-input-cost of $%.2f",
+		req.Provider, req.Model, cost, tokens, opts.maxInputUSD)}
+}
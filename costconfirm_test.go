@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckInputCost(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// 400k characters are estimated at 100k tokens, $0.175 with gpt-5.2
+	large := []OpenAIMessage{{Role: "user", Content: strings.Repeat("x", 400_000)}}
+	tests := []struct {
+		name     string
+		provider Provider
+		model    string
+		limit    float64
+		wantErr  bool
+	}{
+		{name: "no limit", provider: OpenAI, model: "gpt-5.2"},
+		{name: "below", provider: OpenAI, model: "gpt-5.2", limit: 0.20},
+		{name: "above", provider: OpenAI, model: "gpt-5.2", limit: 0.10, wantErr: true},
+		{name: "cheaper model", provider: OpenAI, model: "gpt-5-nano", limit: 0.10},
+		{name: "unknown price", provider: OpenAI, model: "gpt-unknown", limit: 0.01},
+		{name: "local", provider: LMStudio, model: "qwen", limit: 0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &chatRequest{Provider: tt.provider, Model: tt.model, Messages: large}
+			err := checkInputCost(req, &options{maxInputUSD: tt.limit, yes: true})
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkInputCost = %v, want the request sent", err)
+				}
+				return
+			}
+			var exit *exitError
+			if !errors.As(err, &exit) || exit.code != exitUsage {
+				t.Fatalf("checkInputCost = %v, want exit code %d despite --yes", err, exitUsage)
+			}
+			if !strings.Contains(err.Error(), "est. $0.17 for ~100k tokens") {
+				t.Errorf("err = %q, want the estimate labeled as approximate", err)
+			}
+		})
+	}
+}
+
+func TestMaxInputCostFlag(t *testing.T) {
+	for _, value := range []string{"0.5", "$0.5"} {
+		opts, _, err := parseOptions([]string{"--max-input-cost", value, "hi"})
+		if err != nil || opts.maxInputUSD != 0.5 {
+			t.Errorf("--max-input-cost %s: limit = %v, err = %v", value, opts.maxInputUSD, err)
+		}
+	}
+	for _, value := range []string{"0", "-1", "cheap"} {
+		if _, _, err := parseOptions([]string{"--max-input-cost", value, "hi"}); err == nil {
+			t.Errorf("--max-input-cost %s was accepted", value)
+		}
+	}
+}
+
+func TestConfirmCostSkipsCountingWithoutPrice(t *testing.T) {
+	tokenized := ollamaTokenizer(t, false)
+	config := &Config{CostConfirmUSD: 0.01}
+	messages := []OpenAIMessage{{Role: "user", Content: strings.Repeat("word ", 10_000)}}
+	for _, req := range []*chatRequest{
+		{Provider: Ollama, Model: "llama3.2", Messages: messages},
+		{Provider: OpenAI, Model: "gpt-unknown", Messages: messages},
+	} {
+		if err := confirmCost(config, req, &options{}); err != nil {
+			t.Errorf("confirmCost(%s/%s) = %v, want the request sent", req.Provider, req.Model, err)
+		}
+	}
+	if *tokenized != 0 {
+		t.Errorf("the prompt was tokenized %d times, want it not counted", *tokenized)
+	}
+}
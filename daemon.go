@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	daemonAddrFileName = "daemon.addr"
+	daemonSocketName   = "daemon.sock"
+	// daemonTokenFileName holds the token every request to the daemon must
+	// carry, readable only by the user, since on Windows the daemon's TCP
+	// port is open to every local user and process.
+	daemonTokenFileName = "daemon.token"
+	// daemonCacheTTL is how long the daemon answers identical requests from
+	// memory.
+	daemonCacheTTL = 10 * time.Minute
+)
+
+// inDaemon is set in the daemon process so it sends requests itself instead
+// of forwarding them to a daemon.
+var inDaemon bool
+
+// daemonRequest is what the CLI forwards to the daemon.
+type daemonRequest struct {
+	Request     *chatRequest  `json:"request"`
+	Stream      bool          `json:"stream"`
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+}
+
+// daemonEvent is one line of the daemon's answer: streamed text, then
+// either the result or an error.
+type daemonEvent struct {
+	Chunk     string      `json:"chunk,omitempty"`
+	Result    *completion `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+	// Unavailable carries a modelUnavailableError so the CLI can still
+	// offer a replacement model.
+	Unavailable *daemonUnavailable `json:"unavailable,omitempty"`
+	// Failure carries what the CLI needs to rebuild a providerError and the
+	// exit code of an error, see daemonError.
+	Failure *daemonFailure `json:"failure,omitempty"`
+}
+
+// daemonFailure describes an error beyond its message.
+type daemonFailure struct {
+	Provider Provider `json:"provider,omitempty"`
+	Status   int      `json:"status,omitempty"` // the provider's HTTP status
+	Code     int      `json:"code,omitempty"`   // the exit code, if not exitFailure
+}
+
+// newDaemonFailure describes err for the CLI, or returns nil if its
+// message is all there is to it.
+func newDaemonFailure(err error) *daemonFailure {
+	var f daemonFailure
+	var provider *providerError
+	if errors.As(err, &provider) {
+		f.Provider, f.Status = provider.provider, provider.status
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		f.Code = exit.code
+	}
+	if f == (daemonFailure{}) {
+		return nil
+	}
+	return &f
+}
+
+// daemonError rebuilds the error the daemon reported, so it is printed
+// and mapped to an exit code as without the daemon.
+func daemonError(event daemonEvent) error {
+	err := errors.New(event.Error)
+	if f := event.Failure; f != nil {
+		if f.Provider != "" {
+			err = &providerError{provider: f.Provider, status: f.Status, err: err}
+		}
+		if f.Code != 0 {
+			err = &exitError{code: f.Code, err: err}
+		}
+	}
+	return err
+}
+
+type daemonUnavailable struct {
+	Provider Provider `json:"provider"`
+	Model    string   `json:"model"`
+	Reason   string   `json:"reason"`
+}
+
+// daemonStatus is reported by "daemon status".
+type daemonStatus struct {
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+	Address   string    `json:"address"`
+	Requests  int64     `json:"requests"`
+	CacheHits int64     `json:"cache_hits"`
+}
+
+type cachedCompletion struct {
+	result  *completion
+	expires time.Time
+}
+
+// daemon keeps connections and recent answers warm across CLI invocations.
+type daemon struct {
+	status    daemonStatus
+	requests  atomic.Int64
+	cacheHits atomic.Int64
+
+	mu    sync.Mutex
+	cache map[string]cachedCompletion
+
+	server *http.Server
+	token  string
+}
+
+func getDaemonAddrPath() string {
+	return filepath.Join(getStateDir(), daemonAddrFileName)
+}
+
+func getDaemonTokenPath() string {
+	return filepath.Join(getStateDir(), daemonTokenFileName)
+}
+
+// newDaemonToken creates the token of a starting daemon and writes it to
+// the token file, readable only by the user.
+func newDaemonToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := writeFileAtomic(getDaemonTokenPath(), []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// daemonCommand runs the daemon in the foreground or manages a running one.
+func daemonCommand(args []string) error {
+	action := "run"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "run", "start":
+		return runDaemon()
+	case "status":
+		client, addr := connectDaemon()
+		if client == nil {
+			fmt.Println("Daemon not running")
+			return nil
+		}
+		var status daemonStatus
+		if err := daemonGetJSON(client, "/status", &status); err != nil {
+			return err
+		}
+		fmt.Printf("Daemon running (pid %d, up %s) on %s\n", status.PID, time.Since(status.Started).Round(time.Second), addr)
+		fmt.Printf("%d requests, %d answered from cache\n", status.Requests, status.CacheHits)
+		return nil
+	case "stop":
+		client, _ := connectDaemon()
+		if client == nil {
+			fmt.Println("Daemon not running")
+			return nil
+		}
+		resp, err := client.Post("http://ai-cli/stop", "application/json", nil)
+		if err != nil {
+			return fmt.Errorf("failed to stop daemon: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("failed to stop daemon: %s", resp.Status)
+		}
+		fmt.Println("Daemon stopped")
+		return nil
+	default:
+		return fmt.Errorf("unknown daemon action: %s (use start, status or stop)", action)
+	}
+}
+
+// runDaemon listens on a unix socket (localhost TCP on Windows) until it is
+// stopped or interrupted.
+func runDaemon() error {
+	if stateDisabled() {
+		return errNoState
+	}
+	if client, addr := connectDaemon(); client != nil {
+		return fmt.Errorf("daemon already running on %s", addr)
+	}
+	if err := os.MkdirAll(getStateDir(), 0700); err != nil {
+		return err
+	}
+	token, err := newDaemonToken()
+	if err != nil {
+		return fmt.Errorf("failed to create the daemon token: %w", err)
+	}
+	defer os.Remove(getDaemonTokenPath())
+
+	var listener net.Listener
+	var addr string
+	if runtime.GOOS == "windows" {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		if err == nil {
+			addr = "tcp:" + listener.Addr().String()
+		}
+	} else {
+		socket := filepath.Join(getStateDir(), daemonSocketName)
+		os.Remove(socket) // left over from a crashed daemon
+		listener, err = net.Listen("unix", socket)
+		addr = "unix:" + socket
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	if err := writeFileAtomic(getDaemonAddrPath(), []byte(addr), 0600); err != nil {
+		listener.Close()
+		return err
+	}
+	defer os.Remove(getDaemonAddrPath())
+
+	inDaemon = true
+	d := &daemon{
+		status: daemonStatus{PID: os.Getpid(), Started: time.Now(), Address: addr},
+		cache:  make(map[string]cachedCompletion),
+		token:  token,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /execute", d.handleExecute)
+	mux.HandleFunc("GET /status", d.handleStatus)
+	mux.HandleFunc("POST /stop", d.handleStop)
+	d.server = &http.Server{Handler: d.authorize(mux)}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		d.server.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(os.Stderr, "Daemon listening on %s\n", addr)
+	if err := d.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authorize rejects requests without the daemon's token, so only the user
+// who started the daemon can send requests with their keys.
+func (d *daemon) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+			http.Error(w, "invalid daemon token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *daemon) handleExecute(w http.ResponseWriter, r *http.Request) {
+	var dr daemonRequest
+	if err := json.NewDecoder(r.Body).Decode(&dr); err != nil || dr.Request == nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	d.requests.Add(1)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	send := func(event daemonEvent) {
+		enc.Encode(event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	key := requestKey(dr.Request)
+	if result := d.cached(key); result != nil {
+		d.cacheHits.Add(1)
+		if dr.Stream {
+			send(daemonEvent{Chunk: result.Content})
+		}
+		send(daemonEvent{Result: result})
+		return
+	}
+
+	var stream *streamTarget
+	if dr.Stream {
+		stream = &streamTarget{
+			w:           writerFunc(func(chunk string) { send(daemonEvent{Chunk: chunk}) }),
+			idleTimeout: dr.IdleTimeout,
+		}
+	}
+	result, err := executeRequest(dr.Request, stream)
+
+	var truncated *streamTruncatedError
+	var unavailable *modelUnavailableError
+	switch {
+	case errors.As(err, &truncated):
+		send(daemonEvent{Result: result, Error: err.Error(), Truncated: true})
+	case errors.As(err, &unavailable):
+		send(daemonEvent{Error: err.Error(), Unavailable: &daemonUnavailable{
+			Provider: unavailable.provider, Model: unavailable.model, Reason: unavailable.reason,
+		}})
+	case err != nil:
+		send(daemonEvent{Error: err.Error(), Failure: newDaemonFailure(err)})
+	default:
+		d.store(key, result)
+		send(daemonEvent{Result: result})
+	}
+}
+
+func (d *daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := d.status
+	status.Requests = d.requests.Load()
+	status.CacheHits = d.cacheHits.Load()
+	json.NewEncoder(w).Encode(status)
+}
+
+func (d *daemon) handleStop(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+	go d.server.Shutdown(context.Background())
+}
+
+func (d *daemon) cached(key string) *completion {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(d.cache, key)
+		return nil
+	}
+	return entry.result
+}
+
+func (d *daemon) store(key string, result *completion) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, entry := range d.cache {
+		if time.Now().After(entry.expires) {
+			delete(d.cache, k)
+		}
+	}
+	d.cache[key] = cachedCompletion{result: result, expires: time.Now().Add(daemonCacheTTL)}
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(string)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	f(string(p))
+	return len(p), nil
+}
+
+// connectDaemon returns a client for the running daemon and its address, or
+// nil if none is running. A stale address file is removed.
+func connectDaemon() (*http.Client, string) {
+	if stateDisabled() {
+		return nil, ""
+	}
+	data, err := os.ReadFile(getDaemonAddrPath())
+	if err != nil {
+		return nil, ""
+	}
+	addr := strings.TrimSpace(string(data))
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, ""
+	}
+
+	token, err := os.ReadFile(getDaemonTokenPath())
+	if err != nil {
+		return nil, ""
+	}
+
+	conn, err := net.DialTimeout(network, address, time.Second)
+	if err != nil {
+		os.Remove(getDaemonAddrPath())
+		return nil, ""
+	}
+	conn.Close()
+
+	client := &http.Client{Transport: &daemonTransport{
+		token: strings.TrimSpace(string(token)),
+		base: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+	}}
+	return client, addr
+}
+
+// daemonTransport adds the daemon's token to every request.
+type daemonTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *daemonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+func daemonGetJSON(client *http.Client, path string, v any) error {
+	resp, err := client.Get("http://ai-cli" + path)
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon error: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// executeViaDaemon forwards req to the daemon. It reports false if no
+// daemon is running, in which case the caller sends the request itself.
+func executeViaDaemon(req *chatRequest, stream *streamTarget) (*completion, bool, error) {
+	// with --debug-dir the request is sent here, to be captured
+	if inDaemon || debugDir != "" {
+		return nil, false, nil
+	}
+	client, _ := connectDaemon()
+	if client == nil {
+		return nil, false, nil
+	}
+
+	dr := daemonRequest{Request: req}
+	if stream != nil {
+		dr.Stream, dr.IdleTimeout = true, stream.idleTimeout
+	}
+	data, err := json.Marshal(dr)
+	if err != nil {
+		return nil, true, err
+	}
+	resp, err := client.Post("http://ai-cli/execute", "application/json", strings.NewReader(string(data)))
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, true, fmt.Errorf("daemon error: %s", strings.TrimSpace(string(body)))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event daemonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, true, fmt.Errorf("invalid answer from daemon: %w", err)
+		}
+		switch {
+		case event.Chunk != "":
+			if stream != nil {
+				io.WriteString(stream.w, event.Chunk)
+			}
+		case event.Truncated:
+			return event.Result, true, &streamTruncatedError{idle: stream.idleTimeout}
+		case event.Unavailable != nil:
+			u := event.Unavailable
+			return nil, true, &modelUnavailableError{provider: u.Provider, model: u.Model, reason: u.Reason}
+		case event.Error != "":
+			return nil, true, daemonError(event)
+		case event.Result != nil:
+			return event.Result, true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, true, fmt.Errorf("failed to read answer from daemon: %w", err)
+	}
+	return nil, true, fmt.Errorf("daemon closed the connection without an answer")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDaemonErrorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "plain", err: errors.New("failed to marshal request")},
+		{name: "rate limited", err: apiError(OpenAI, 429, "OpenAI API error: rate limit reached")},
+		{name: "server error", err: withProvider(Ollama, apiError(Ollama, 503, "ollama is loading the model"))},
+		{name: "without status", err: withProvider(OpenAI, errors.New("connection reset"))},
+		{name: "exit code", err: &exitError{code: exitBudgetExceeded, err: errors.New("over budget")}},
+		{name: "exit code and provider", err: fmt.Errorf("audit: %w", &exitError{code: exitUsage, err: apiError(OpenAI, 400, "bad request")})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(daemonEvent{Error: tt.err.Error(), Failure: newDaemonFailure(tt.err)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var event daemonEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				t.Fatal(err)
+			}
+			got, want := newErrorReport(daemonError(event)), newErrorReport(tt.err)
+			if got != want {
+				t.Errorf("through the daemon: %+v, want %+v", got, want)
+			}
+		})
+	}
+}
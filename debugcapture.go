@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// debugFileMaxBytes caps each file of a debug capture, so a long stream
+// still leaves a file that can be attached to a bug report.
+const debugFileMaxBytes = 5 << 20
+
+var (
+	// debugDir is where the requests to the providers are captured, see
+	// --debug-dir.
+	debugDir string
+	// debugSequence numbers the captures of a process in the order the
+	// requests were sent.
+	debugSequence atomic.Int64
+	// sensitiveHeaderPattern matches the headers that are redacted from
+	// captures: API keys, tokens and the request_signer's signatures.
+	sensitiveHeaderPattern = regexp.MustCompile(`(?i)auth|key|token|secret|signature|cookie`)
+)
+
+// enableDebugCapture makes every request to a provider write its request
+// and response to dir, as sent and as received. It is a no-op for "".
+func enableDebugCapture(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create debug directory: %w", err)
+	}
+	debugDir = dir
+	// capture below the signer, to record the headers it adds
+	signing := httpClient.Transport.(*signingTransport)
+	signing.base = &debugTransport{base: signing.base, dir: dir}
+	return nil
+}
+
+// debugTransport writes each request to <time>-<seq>-<host>.request.txt and
+// its response to .response.txt next to it. Streamed responses are written
+// chunk by chunk as they are read, with the time each chunk arrived.
+// Failing to write a capture doesn't fail the request.
+type debugTransport struct {
+	base http.RoundTripper
+	dir  string
+	warn sync.Once
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	name := fmt.Sprintf("%s-%03d-%s", start.Format("20060102-150405.000"), debugSequence.Add(1), unsafeNameChars.ReplaceAllString(req.URL.Host, "_"))
+	base := filepath.Join(t.dir, name)
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sent := req.Clone(req.Context())
+	sent.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s\nSent: %s\n", req.Method, req.URL, start.Format(time.RFC3339Nano))
+	writeDebugHeaders(&request, sent.Header)
+	request.WriteString("\n")
+	request.Write(body)
+	file := &cappedFile{}
+	if err := file.create(base + ".request.txt"); err != nil {
+		t.failed(err)
+	} else {
+		file.Write(request.Bytes())
+		file.Close()
+	}
+
+	resp, err := t.base.RoundTrip(sent)
+
+	file = &cappedFile{}
+	if err := file.create(base + ".response.txt"); err != nil {
+		t.failed(err)
+		return resp, err
+	}
+	if err != nil {
+		fmt.Fprintf(file, "Error after %s: %v\n", time.Since(start).Round(time.Millisecond), err)
+		file.Close()
+		return resp, err
+	}
+	fmt.Fprintf(file, "%s\nHeaders after: %s\n", resp.Status, time.Since(start).Round(time.Millisecond))
+	writeDebugHeaders(file, resp.Header)
+	file.WriteString("\n")
+	contentType := resp.Header.Get("Content-Type")
+	resp.Body = &debugBody{
+		ReadCloser: resp.Body,
+		file:       file,
+		start:      start,
+		streaming:  strings.Contains(contentType, "event-stream") || strings.Contains(contentType, "ndjson"),
+	}
+	return resp, nil
+}
+
+func (t *debugTransport) failed(err error) {
+	t.warn.Do(func() { notef("Warning: failed to write debug capture: %v\n", err) })
+}
+
+// writeDebugHeaders writes h sorted by name, with sensitive values redacted.
+func writeDebugHeaders(w io.Writer, h http.Header) {
+	for _, name := range slices.Sorted(maps.Keys(h)) {
+		for _, value := range h[name] {
+			if sensitiveHeaderPattern.MatchString(name) {
+				value = "[redacted]"
+			}
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// debugBody copies a response body to its capture as it is read. The
+// capture ends with the time the body was read to the end or closed.
+type debugBody struct {
+	io.ReadCloser
+	file      *cappedFile
+	start     time.Time
+	streaming bool
+	chunks    int
+	size      int
+	done      bool
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.done {
+		b.chunks++
+		b.size += n
+		if b.streaming {
+			fmt.Fprintf(b.file, "--- chunk %d at +%s, %d bytes ---\n", b.chunks, b.elapsed(), n)
+		}
+		b.file.Write(p[:n])
+		if b.streaming && p[n-1] != '\n' {
+			b.file.WriteString("\n")
+		}
+	}
+	if err != nil && !b.done {
+		if err == io.EOF {
+			b.finish("end")
+		} else {
+			b.finish(fmt.Sprintf("error (%v)", err))
+		}
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	if !b.done {
+		b.finish("closed")
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *debugBody) finish(how string) {
+	b.done = true
+	// past the cap, so the end is always recorded
+	fmt.Fprintf(b.file.f, "\n--- %s at +%s, %d bytes ---\n", how, b.elapsed(), b.size)
+	b.file.Close()
+}
+
+func (b *debugBody) elapsed() time.Duration {
+	return time.Since(b.start).Round(time.Millisecond)
+}
+
+// cappedFile writes up to debugFileMaxBytes to a file and drops the rest,
+// noting where it was cut. Write errors are ignored, as the capture must
+// not get in the way of the request.
+type cappedFile struct {
+	f         *os.File
+	written   int
+	truncated bool
+}
+
+func (c *cappedFile) create(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	c.f = f
+	return err
+}
+
+func (c *cappedFile) Write(p []byte) (int, error) {
+	if c.truncated {
+		return len(p), nil
+	}
+	data := p
+	if room := debugFileMaxBytes - c.written; len(data) > room {
+		data = data[:room]
+		c.truncated = true
+	}
+	n, _ := c.f.Write(data)
+	c.written += n
+	if c.truncated {
+		fmt.Fprintf(c.f, "\n[capture cut at %s]\n", formatBytes(debugFileMaxBytes))
+	}
+	return len(p), nil
+}
+
+func (c *cappedFile) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+func (c *cappedFile) Close() {
+	c.f.Close()
+}
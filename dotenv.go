@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"strings"
+)
+
+// dotenvKeys are the variables read from a .env file. Anything else in it
+// is ignored, so a project's .env can't change how ai-cli behaves.
+var dotenvKeys = []string{"OPENAI_API_KEY", "BRAVE_API_KEY"}
+
+// loadDotenv sets the provider keys of the .env file in the working
+// directory, or of env_file from the configuration, that aren't set in
+// the environment already. With --verbose the names of the keys are noted,
+// never their values.
+func loadDotenv(opts *options) {
+	if opts.noDotenv {
+		return
+	}
+	path := ".env"
+	if config, err := loadConfigOrDefault(); err == nil && config.EnvFile != "" {
+		path = expandHome(config.EnvFile)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var loaded []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := parseDotenvLine(scanner.Text())
+		if !ok || !slices.Contains(dotenvKeys, key) {
+			continue
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		os.Setenv(key, value)
+		loaded = append(loaded, key)
+	}
+	if opts.verbose && len(loaded) > 0 {
+		notef("Loaded %s from %s\n", strings.Join(loaded, ", "), path)
+	}
+}
+
+// parseDotenvLine parses KEY=value, optionally preceded by "export" and
+// with the value in single or double quotes. Unquoted values end at " #".
+func parseDotenvLine(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, value, ok = strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return key, value[1 : end+1], true
+		}
+	}
+	if comment := strings.Index(value, " #"); comment >= 0 {
+		value = strings.TrimSpace(value[:comment])
+	}
+	return key, value, true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// providerError is an error of a request to a provider. Status is the HTTP
+// status of the failed response, or 0 if there was none.
+type providerError struct {
+	provider Provider
+	status   int
+	err      error
+}
+
+func (e *providerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *providerError) Unwrap() error {
+	return e.err
+}
+
+// apiError reports an error response of a provider's API.
+func apiError(provider Provider, status int, format string, args ...any) error {
+	return &providerError{provider: provider, status: status, err: fmt.Errorf(format, args...)}
+}
+
+// withProvider attributes err to provider, unless it already names one.
+func withProvider(provider Provider, err error) error {
+	var known *providerError
+	var unavailable *modelUnavailableError
+	if errors.As(err, &known) || errors.As(err, &unavailable) {
+		return err
+	}
+	return &providerError{provider: provider, err: err}
+}
+
+// errorReport is the machine-readable form of an error, see --errors json.
+type errorReport struct {
+	Code       int      `json:"code"`
+	Provider   Provider `json:"provider,omitempty"`
+	Message    string   `json:"message"`
+	Retryable  bool     `json:"retryable"`
+	HTTPStatus int      `json:"http_status,omitempty"`
+}
+
+// newErrorReport describes err with the exit code it leads to.
+func newErrorReport(err error) errorReport {
+	report := errorReport{Code: exitFailure, Message: err.Error()}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		report.Code = exit.code
+	}
+
+	var provider *providerError
+	var unavailable *modelUnavailableError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &provider):
+		report.Provider, report.HTTPStatus = provider.provider, provider.status
+	case errors.As(err, &unavailable):
+		report.Provider = unavailable.provider
+	}
+	switch {
+	case report.HTTPStatus != 0:
+		report.Retryable = report.HTTPStatus == http.StatusTooManyRequests || report.HTTPStatus >= 500
+	case report.Code == exitTruncated, report.Code == exitEmptyAnswer:
+		report.Retryable = true
+	case errors.As(err, &netErr):
+		report.Retryable = true
+	}
+	return report
+}
+
+// printError reports err on stderr, as text or with --errors json as a
+// JSON object, and returns the exit code for it. Errors that carry only an
+// exit code were already reported in text form.
+func printError(err error, opts *options) int {
+	report := newErrorReport(err)
+	if opts != nil && opts.errorFormat == "json" {
+		data, _ := json.Marshal(report)
+		fmt.Fprintln(os.Stderr, string(data))
+		return report.Code
+	}
+
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return report.Code
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// saveExchange writes the assembled prompt of req to the --save-prompt
+// file, and prompt and answer to a new pair of files in the
+// --save-exchange directory. sent is when the request was sent. The
+// messages were scrubbed before sending, so secrets redacted from the
+// request are redacted here too.
+func saveExchange(req *chatRequest, answer string, sent time.Time, opts *options) error {
+	if opts.savePrompt == "" && opts.saveExchange == "" {
+		return nil
+	}
+	now := time.Now()
+	prompt := formatPromptFile(req, sent)
+
+	if opts.savePrompt != "" {
+		if err := writeExchangeFile(opts.savePrompt, prompt, now, opts); err != nil {
+			return err
+		}
+	}
+	if opts.saveExchange != "" {
+		base := filepath.Join(opts.saveExchange, "{date}-{time}-{slug}")
+		if err := writeExchangeFile(base+".prompt.md", prompt, now, opts); err != nil {
+			return err
+		}
+		if err := writeExchangeFile(base+".answer.md", normalizeOutput(answer), now, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExchangeFile writes a file like -o does: names with placeholders
+// never overwrite a file.
+func writeExchangeFile(name, content string, now time.Time, opts *options) error {
+	path, templated := expandOutputName(name, now, opts)
+	if !templated {
+		return writeOutput(content, []string{path})
+	}
+	if err := checkOutputName(name, path, opts); err != nil {
+		return err
+	}
+	written, err := createOutputFile(path, []byte(content))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if opts.verbose {
+		notef("Wrote %s\n", written)
+	}
+	return nil
+}
+
+// formatPromptFile shows the messages of req after a front matter block
+// with the model, the parameters and the time the request was sent.
+func formatPromptFile(req *chatRequest, sent time.Time) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "provider: %s\nmodel: %s\n", req.Provider, req.Model)
+	if req.Temperature != nil {
+		fmt.Fprintf(&b, "temperature: %g\n", *req.Temperature)
+	}
+	if req.MaxTokens > 0 {
+		fmt.Fprintf(&b, "max_tokens: %d\n", req.MaxTokens)
+	}
+	if req.Format != nil {
+		format := "json"
+		if req.Format.Schema != nil {
+			format = "json-schema"
+		}
+		fmt.Fprintf(&b, "format: %s\n", format)
+	}
+	if len(req.Tools) > 0 {
+		var names []string
+		for _, tool := range req.Tools {
+			names = append(names, tool.Function.Name)
+		}
+		fmt.Fprintf(&b, "tools: %s\n", strings.Join(names, ", "))
+	}
+	if req.WebSearch {
+		b.WriteString("web_search: true\n")
+	}
+	if len(req.Tags) > 0 {
+		fmt.Fprintf(&b, "tags: %s\n", strings.Join(req.Tags, ", "))
+	}
+	if req.User != "" {
+		fmt.Fprintf(&b, "user: %s\n", req.User)
+	}
+	fmt.Fprintf(&b, "time: %s\n---\n", sent.Format(time.RFC3339))
+	for _, msg := range req.Messages {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", msg.Role, msg.Content)
+	}
+	return b.String()
+}
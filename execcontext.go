@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+const (
+	// defaultExecTimeout is how long each --exec command may run unless
+	// exec_timeout is set.
+	defaultExecTimeout = 30 * time.Second
+	// defaultExecMaxBytes is how much output of all --exec commands together
+	// is added to the prompt unless exec_max_bytes is set.
+	defaultExecMaxBytes = 64 << 10
+)
+
+// runExecCommands runs every --exec command and adds its combined stdout
+// and stderr as a context source labeled with the command line and its exit
+// code, e.g. "$ kubectl get pods -A (exit 0)". A failing command is still
+// included, since its output is usually what the question is about.
+func runExecCommands(config *Config, opts *options) ([]contextSource, error) {
+	timeout := defaultExecTimeout
+	if config.ExecTimeout != "" {
+		d, err := time.ParseDuration(config.ExecTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid exec_timeout value: %s (use e.g. 30s)", config.ExecTimeout)
+		}
+		timeout = d
+	}
+	remaining := config.ExecMaxBytes
+	if remaining <= 0 {
+		remaining = defaultExecMaxBytes
+	}
+
+	var sources []contextSource
+	for _, command := range opts.execs {
+		output, status := runExecCommand(command, timeout)
+		output, truncated := truncateText(output, max(remaining, 0))
+		remaining -= len(output)
+
+		if opts.verbose || opts.dryRun {
+			note := ""
+			if truncated {
+				note = ", truncated to fit exec_max_bytes"
+			}
+			notef("Ran %s: %s, %s output%s\n", command, status, formatBytes(len(output)), note)
+		}
+		sources = append(sources, contextSource{Name: fmt.Sprintf("$ %s (%s)", command, status), Content: output})
+	}
+	return sources, nil
+}
+
+// runExecCommand runs a command line through the shell with no input and
+// returns its output and how it ended, e.g. "exit 0" or "timed out after
+// 30s".
+func runExecCommand(command string, timeout time.Duration) (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// don't wait for background processes that keep the output open
+	cmd.WaitDelay = time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return output.String(), fmt.Sprintf("timed out after %s", timeout)
+	case errors.As(err, &exit):
+		return output.String(), fmt.Sprintf("exit %d", exit.ExitCode())
+	case err != nil:
+		return output.String(), err.Error()
+	}
+	return output.String(), "exit 0"
+}
@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// Process exit codes. Anything not covered by a more specific code exits
+// with exitFailure.
+const (
+	exitFailure           = 1
+	exitUsage             = 2
+	exitModerationFlagged = 3
+	exitBudgetExceeded    = 4
+	exitSecretsFound      = 5
+	exitTruncated         = 6
+	exitEmptyAnswer       = 7
+	exitInterrupted       = 130 // the conventional status after Ctrl-C
+)
+
+// exitError makes the process exit with a specific status code. If err is
+// nil nothing is printed.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
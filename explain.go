@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultRunTailKB is how much of a failed command's output is sent to the model.
+const defaultRunTailKB = 16
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// runCommand executes the given command, passing its output through. If the
+// command fails, the command line and the tail of its output are sent to the
+// model for a diagnosis. The process exits with the command's exit code.
+func runCommand(args []string, opts *options) error {
+	tailKB := defaultRunTailKB
+
+	for len(args) > 0 && args[0] != "--" {
+		switch args[0] {
+		case "--tail":
+			if len(args) < 2 {
+				return fmt.Errorf("--tail flag requires a size in KB")
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid --tail value: %s", args[1])
+			}
+			tailKB = n
+			args = args[2:]
+		default:
+			return fmt.Errorf("unknown run flag: %s (separate the command with --)", args[0])
+		}
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ai-cli run [--tail KB] -- <command> [args...]")
+	}
+
+	tail := &tailBuffer{max: tailKB * 1024}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &teeWriter{out: os.Stdout, tail: tail}
+	cmd.Stderr = &teeWriter{out: os.Stderr, tail: tail}
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to run command: %w", err)
+	}
+	code := exitErr.ExitCode()
+	if code < 0 {
+		code = 1
+	}
+
+	if err := ensureConfigExists(); err != nil {
+		return &exitError{code: code, err: err}
+	}
+
+	opts.task = "run"
+	fmt.Fprintln(os.Stderr)
+	output, err := executePrompt(userInput{Prompt: buildRunPrompt(args, code, tail)}, opts)
+	if err := deliver(output, err, opts); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) && exit.err == nil {
+			return &exitError{code: code} // already reported
+		}
+		return &exitError{code: code, err: err}
+	}
+	return &exitError{code: code}
+}
+
+// teeWriter passes writes through to out while recording them in tail.
+type teeWriter struct {
+	out  *os.File
+	tail *tailBuffer
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	w.tail.Write(p)
+	return w.out.Write(p)
+}
+
+func buildRunPrompt(args []string, code int, tail *tailBuffer) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The command `%s` failed with exit code %d.\n\n", strings.Join(args, " "), code)
+
+	output := strings.TrimRight(tail.String(), "\n")
+	if output == "" {
+		sb.WriteString("It produced no output.\n\n")
+	} else {
+		if tail.truncated {
+			fmt.Fprintf(&sb, "Last %d KB of its combined stdout/stderr:\n", tail.max/1024)
+		} else {
+			sb.WriteString("Its combined stdout/stderr:\n")
+		}
+		fmt.Fprintf(&sb, "```\n%s\n```\n\n", output)
+	}
+
+	sb.WriteString("Diagnose the cause of the failure and suggest a concrete fix.")
+	return sb.String()
+}
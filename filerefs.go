@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// fileReferencePattern finds #path tokens at the start of the prompt or
+// after whitespace or an opening bracket. A backslash before the # keeps
+// the token as text.
+var fileReferencePattern = regexp.MustCompile(`(^|[\s(\[])(\\?)#([^\s#]+)`)
+
+// expandFileReferences attaches the files referenced as #path in the prompt,
+// like -f does, and replaces each reference with the file's base name. Only
+// tokens naming an existing file count, so "#1" or "#todo" stay as they
+// are; trailing punctuation is not part of the path. Files also given with
+// -f are not attached twice.
+func expandFileReferences(prompt string, opts *options) (string, []contextSource, error) {
+	var sources []contextSource
+	attached := slices.Clone(opts.files)
+	var b strings.Builder
+	last := 0
+	for _, m := range fileReferencePattern.FindAllStringSubmatchIndex(prompt, -1) {
+		escaped := m[5] > m[4]
+		token := prompt[m[6]:m[7]]
+		path := strings.TrimRight(token, ".,;:!?)]'\"")
+		if escaped {
+			b.WriteString(prompt[last:m[4]])
+			last = m[5] // drop the backslash
+			continue
+		}
+		if !isReadableFile(path) {
+			continue
+		}
+
+		b.WriteString(prompt[last:m[3]])
+		b.WriteString(filepath.Base(path))
+		last = m[6] + len(path)
+		if slices.Contains(attached, path) {
+			continue
+		}
+		attached = append(attached, path)
+
+		content, err := readAttachment(path)
+		if err != nil {
+			return "", nil, err
+		}
+		content = tabularInput(path, content, opts)
+		if opts.verbose || opts.dryRun {
+			notef("Attached #%s as %s: %s text\n", path, filepath.Base(path), formatBytes(len(content)))
+		}
+		sources = append(sources, contextSource{Name: path, Content: content})
+	}
+	b.WriteString(prompt[last:])
+	return b.String(), sources, nil
+}
+
+// fileArguments attaches the trailing arguments that name readable files,
+// like -f does, and returns the rest as the prompt: ai-cli "summarize
+// these" a.md b.md. The first argument is always prompt text. With
+// --no-file-args all arguments are.
+func fileArguments(args []string, opts *options) []string {
+	if opts.noFileArgs {
+		return args
+	}
+	end := len(args)
+	for end > 1 && isReadableFile(args[end-1]) {
+		end--
+	}
+	if end == len(args) {
+		return args
+	}
+	files := args[end:]
+	for _, path := range files {
+		if !slices.Contains(opts.files, path) {
+			opts.files = append(opts.files, path)
+		}
+	}
+	if opts.verbose || opts.dryRun {
+		notef("Attaching %s as files, not prompt text (--no-file-args keeps them in the prompt)\n", strings.Join(files, ", "))
+	}
+	return args[:end]
+}
+
+// isReadableFile reports whether path names a regular file that can be
+// opened.
+func isReadableFile(path string) bool {
+	if info, err := os.Stat(path); path == "" || err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxAutoContinues bounds the continue turns of --auto-continue.
+	maxAutoContinues = 3
+	// continueOverlap is the longest repetition of the end of the answer
+	// that is removed from the start of a continuation; repetitions
+	// shorter than minContinueOverlap are kept, since they are likely a
+	// coincidence.
+	continueOverlap    = 500
+	minContinueOverlap = 8
+)
+
+const continuePrompt = "Your answer was cut off. Continue exactly where it stopped, without repeating anything."
+
+// finishReason maps the providers' reasons for ending an answer to
+// "length" if it hit the token limit, "content_filter" if it was filtered
+// and "" if it ended normally.
+func finishReason(reason string) string {
+	switch reason {
+	case "length", "max_output_tokens":
+		return "length"
+	case "content_filter":
+		return "content_filter"
+	}
+	return ""
+}
+
+// checkFinish reports answers the provider cut off. With --auto-continue,
+// an answer cut off at the token limit is continued with further turns,
+// which are appended without the text they repeat and written to the
+// stream target if there is one.
+func checkFinish(req *chatRequest, result *completion, opts *options, stream *streamTarget) (*completion, error) {
+	for range maxAutoContinues {
+		if result.FinishReason != "length" || !opts.autoContinue {
+			break
+		}
+		if opts.verbose {
+			notef("The answer hit the token limit, asking the model to continue\n")
+		}
+		config, err := loadConfigOrDefault()
+		if err != nil {
+			return result, err
+		}
+		next := *req
+		next.Messages = append(slices.Clone(req.Messages),
+			OpenAIMessage{Role: "assistant", Content: result.Content},
+			OpenAIMessage{Role: "user", Content: continuePrompt})
+		part, err := sendSideRequest(config, &next, opts, nil)
+		if err != nil {
+			return result, err
+		}
+
+		rest := continuation(result.Content, part.Content)
+		if stream != nil {
+			io.WriteString(stream.w, rest)
+		}
+		result.Content += rest
+		result.PromptTokens += part.PromptTokens
+		result.CachedTokens += part.CachedTokens
+		result.CompletionTokens += part.CompletionTokens
+		result.FinishReason, result.RawFinishReason = part.FinishReason, part.RawFinishReason
+	}
+
+	switch result.FinishReason {
+	case "length":
+		limit := "the model's output limit"
+		switch {
+		case req.MaxTokens > 0 && req.MaxTokens == ollamaLengthTokens[opts.length] && opts.maxTokens == 0:
+			limit = fmt.Sprintf("the --%s limit of %d tokens", opts.length, req.MaxTokens)
+		case req.MaxTokens > 0:
+			limit = fmt.Sprintf("--max-tokens %d", req.MaxTokens)
+		}
+		notef("Warning: the answer was cut off at %s; raise --max-tokens or use --auto-continue\n", limit)
+	case "content_filter":
+		notef("Warning: the answer was stopped by the content filter of %s\n", req.Provider)
+	}
+	return result, nil
+}
+
+// checkEmptyAnswer fails on answers that are empty or only whitespace,
+// which scripts would otherwise take for a successful run. In a terminal it
+// first offers to send the request again with a higher temperature, which
+// often gets past a stop sequence matching right away.
+func checkEmptyAnswer(req *chatRequest, result *completion, opts *options, stream *streamTarget) (*completion, error) {
+	for strings.TrimSpace(result.Content) == "" {
+		reason := result.RawFinishReason
+		if reason == "" {
+			reason = "none reported"
+		}
+		empty := &exitError{code: exitEmptyAnswer, err: fmt.Errorf("the model returned an empty answer (finish reason: %s); use --allow-empty to accept it", reason)}
+		if opts.batch || opts.streamWriter != nil || !isInteractive() {
+			return result, empty
+		}
+
+		temperature := emptyRetryTemperature(req.Temperature)
+		notef("The model returned an empty answer (finish reason: %s).\n", reason)
+		notef("Send it again with temperature %.1f? [Y/n]: ", temperature)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "" && answer != "y" && answer != "yes" {
+			return result, empty
+		}
+
+		config, err := loadConfigOrDefault()
+		if err != nil {
+			return result, err
+		}
+		req.Temperature = &temperature
+		next, err := sendSideRequest(config, req, opts, stream)
+		if err != nil {
+			return result, err
+		}
+		next.PromptTokens += result.PromptTokens
+		next.CachedTokens += result.CachedTokens
+		next.CompletionTokens += result.CompletionTokens
+		if result, err = checkFinish(req, next, opts, stream); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// emptyRetryTemperature raises the temperature for another try after an
+// empty answer: to 1 if it was lower or the provider's default, otherwise
+// by 0.5 up to the maximum of 2.
+func emptyRetryTemperature(current *float64) float64 {
+	if current == nil || *current < 1 {
+		return 1
+	}
+	return min(*current+0.5, 2)
+}
+
+// continuation returns next without the text it repeats from the end of
+// prev, as models tend to restart the interrupted sentence.
+func continuation(prev, next string) string {
+	for n := min(len(prev), len(next), continueOverlap); n >= minContinueOverlap; n-- {
+		if strings.HasSuffix(prev, next[:n]) {
+			return next[n:]
+		}
+	}
+	return next
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestAutoContinueIsRateLimited(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "the end of the answer"}, "finish_reason": "stop"}},
+		})
+	}))
+	defer provider.Close()
+	defer func(url string) { openAIBaseURL = url }(openAIBaseURL)
+	openAIBaseURL = provider.URL
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "test")
+	limit := &RateLimit{RequestsPerMinute: 60}
+	if err := saveConfig(&Config{Provider: OpenAI, Model: "gpt-5-mini", RateLimit: limit}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &chatRequest{Provider: OpenAI, Model: "gpt-5-mini", Messages: []OpenAIMessage{{Role: "user", Content: "write a lot"}}}
+	cut := &completion{Content: "the start of the answer, ", FinishReason: "length"}
+	result, err := checkFinish(req, cut, &options{autoContinue: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Content != "the start of the answer, the end of the answer" || result.FinishReason != "" {
+		t.Errorf("result = %+v, want the continued answer", result)
+	}
+
+	data, err := os.ReadFile(getRateLimitPath(OpenAI))
+	if err != nil {
+		t.Fatalf("the continuation wasn't rate limited: %v", err)
+	}
+	var state rateLimitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Requests > float64(limit.RequestsPerMinute)-0.5 {
+		t.Errorf("%.2f requests left, want the continuation counted", state.Requests)
+	}
+}
+
+func TestAutoContinueOffline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := saveConfig(&Config{Provider: OpenAI, Model: "gpt-5-mini", Offline: true}); err != nil {
+		t.Fatal(err)
+	}
+	req := &chatRequest{Provider: OpenAI, Model: "gpt-5-mini", Messages: []OpenAIMessage{{Role: "user", Content: "write a lot"}}}
+	cut := &completion{Content: "the start", FinishReason: "length"}
+	result, err := checkFinish(req, cut, &options{autoContinue: true}, nil)
+	if err == nil {
+		t.Error("the continuation was sent in offline mode")
+	}
+	if result == nil || result.Content != "the start" {
+		t.Errorf("result = %+v, want the part answered so far", result)
+	}
+}
@@ -1,3 +1,9 @@
 module github.com/frauelster/ai-cli
 
 go 1.25.6
+
+require (
+	github.com/ledongthuc/pdf v0.0.0-20260907135840-6c8c28e0e8a0
+	golang.org/x/net v0.49.0
+	golang.org/x/sys v0.40.0
+)
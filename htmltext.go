@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements never contain readable page content.
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Head:     true,
+}
+
+// blockElements start on a new line.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Main: true, atom.Ul: true, atom.Ol: true, atom.Table: true,
+	atom.Blockquote: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Hr: true, atom.Body: true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// isHTML sniffs whether data is an HTML document.
+func isHTML(data string) bool {
+	mediaType, _, _ := strings.Cut(http.DetectContentType([]byte(data)), ";")
+	return mediaType == "text/html"
+}
+
+// convertPipedHTML replaces piped HTML with its readable text. Anything else,
+// or HTML that can't be parsed, is returned unchanged.
+func convertPipedHTML(piped string, opts *options) string {
+	if piped == "" || !isHTML(piped) {
+		return piped
+	}
+	text, err := htmlToText(strings.NewReader(piped))
+	if err != nil {
+		return piped
+	}
+	if opts.verbose {
+		notef("Converted piped HTML to text: %s -> %s (%.0f%% smaller)\n",
+			formatBytes(len(piped)), formatBytes(len(text)), 100*(1-float64(len(text))/float64(len(piped))))
+	}
+	return text
+}
+
+// htmlToText extracts the readable text of an HTML page as light Markdown.
+// Scripts, styles and page chrome such as navigation are dropped, and if the
+// page has an <article> or <main> element only that is used.
+func htmlToText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	root := doc
+	if content := findElement(doc, atom.Article); content != nil {
+		root = content
+	} else if content := findElement(doc, atom.Main); content != nil {
+		root = content
+	}
+
+	var b strings.Builder
+	if title := findElement(doc, atom.Title); title != nil && root != doc {
+		if t := strings.TrimSpace(textContent(title)); t != "" {
+			b.WriteString("# " + t + "\n\n")
+		}
+	}
+	writeText(&b, root)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+// writeText renders n and its children into b.
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			if n.Data != "" && !endsWithSpace(b) {
+				b.WriteByte(' ')
+			}
+			return
+		}
+		if startsWithSpace(n.Data) && !endsWithSpace(b) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		if endsWithSpaceString(n.Data) {
+			b.WriteByte(' ')
+		}
+		return
+	case html.CommentNode, html.DoctypeNode:
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] {
+			return
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		b.WriteString("\n")
+		return
+	case atom.Pre:
+		b.WriteString("\n\n```\n" + strings.Trim(textContent(n), "\n") + "\n```\n\n")
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		b.WriteString("\n\n" + strings.Repeat("#", level) + " " + strings.Join(strings.Fields(textContent(n)), " ") + "\n\n")
+		return
+	case atom.Li:
+		b.WriteString("\n- ")
+	case atom.Tr:
+		b.WriteString("\n")
+	case atom.Td, atom.Th:
+		for prev := n.PrevSibling; prev != nil; prev = prev.PrevSibling {
+			if prev.Type == html.ElementNode {
+				b.WriteString(" | ")
+				break
+			}
+		}
+	}
+
+	block := blockElements[n.DataAtom]
+	if block {
+		b.WriteString("\n\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+	if block {
+		b.WriteString("\n\n")
+	}
+}
+
+// textContent returns the raw text below n.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+// findElement returns the first element of the given type below n.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n") != s
+}
+
+func endsWithSpaceString(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n") != s
+}
+
+func endsWithSpace(b *strings.Builder) bool {
+	s := b.String()
+	return s == "" || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\n")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// connectionsOpened counts the connections the shared client has dialed, so
+// bench can show how many requests reused a connection.
+var connectionsOpened atomic.Int64
+
+// httpClient is shared by all requests of a process so connections (and
+// their TLS handshakes) are reused, e.g. across batch items and bench runs.
+// Requests to the providers pass the request_signer, if one is configured.
+var httpClient = &http.Client{Transport: &signingTransport{base: newHTTPTransport()}}
+
+func newHTTPTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			connectionsOpened.Add(1)
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16, // enough for parallel batch workers
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 0, // send bodies right away
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultJSONInputMaxBytes is the size piped JSON is reduced to with
+// --json-input.
+const defaultJSONInputMaxBytes = 32 << 10
+
+// jsonNode is a parsed JSON value that keeps the order of object keys.
+type jsonNode struct {
+	object []jsonField // set for objects
+	array  []*jsonNode // set for arrays
+	scalar json.RawMessage
+	isObj  bool
+	isArr  bool
+}
+
+type jsonField struct {
+	key   string
+	value *jsonNode
+}
+
+// jsonElisions counts what was left out while shrinking JSON.
+type jsonElisions struct {
+	items   int // array elements
+	objects int // objects and arrays collapsed by the depth limit
+}
+
+// shrinkJSONInput parses piped JSON and, if it is larger than maxBytes,
+// samples arrays and limits the nesting depth until it fits. The result is
+// always valid JSON; elided parts are replaced by marker strings.
+func shrinkJSONInput(data string, maxBytes int, opts *options) (string, error) {
+	root, err := parseJSONNode(json.NewDecoder(strings.NewReader(data)))
+	if err != nil {
+		return "", fmt.Errorf("--json-input: piped input is not valid JSON: %w", err)
+	}
+	if len(data) <= maxBytes {
+		return data, nil
+	}
+
+	// sample arrays ever harder, then limit the depth as a last resort
+	var out string
+	var elided jsonElisions
+	for _, limits := range []struct{ items, depth int }{
+		{20, -1}, {10, -1}, {6, -1}, {4, -1}, {2, -1},
+		{2, 8}, {2, 6}, {2, 4}, {2, 3}, {2, 2}, {2, 1},
+	} {
+		elided = jsonElisions{}
+		var b bytes.Buffer
+		writeJSONNode(&b, root, limits.items, limits.depth, &elided)
+		out = b.String()
+		if len(out) <= maxBytes {
+			break
+		}
+	}
+
+	if opts.verbose || elided.items > 0 || elided.objects > 0 {
+		notef("Reduced piped JSON from %s to %s: %d array items and %d nested values elided\n",
+			formatBytes(len(data)), formatBytes(len(out)), elided.items, elided.objects)
+	}
+	return out + "\n", nil
+}
+
+// parseJSONNode reads one JSON value from dec.
+func parseJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	dec.UseNumber()
+	node, err := readJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return node, nil
+}
+
+func readJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node := &jsonNode{isObj: true}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := readJSONNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				node.object = append(node.object, jsonField{key: keyTok.(string), value: value})
+			}
+			_, err := dec.Token() // '}'
+			return node, err
+		case '[':
+			node := &jsonNode{isArr: true}
+			for dec.More() {
+				value, err := readJSONNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				node.array = append(node.array, value)
+			}
+			_, err := dec.Token() // ']'
+			return node, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	default:
+		raw, err := json.Marshal(t)
+		return &jsonNode{scalar: raw}, err
+	}
+}
+
+// writeJSONNode writes n as compact JSON. Arrays longer than maxItems keep
+// their first and last elements; below maxDepth (if not negative) objects
+// and arrays are replaced by a summary.
+func writeJSONNode(b *bytes.Buffer, n *jsonNode, maxItems, maxDepth int, elided *jsonElisions) {
+	switch {
+	case n.isObj:
+		if maxDepth == 0 && len(n.object) > 0 {
+			elided.objects++
+			marker, _ := json.Marshal(fmt.Sprintf("{... %d keys elided ...}", len(n.object)))
+			b.Write(marker)
+			return
+		}
+		b.WriteByte('{')
+		for i, field := range n.object {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(field.key)
+			b.Write(key)
+			b.WriteByte(':')
+			writeJSONNode(b, field.value, maxItems, maxDepth-1, elided)
+		}
+		b.WriteByte('}')
+	case n.isArr:
+		if maxDepth == 0 && len(n.array) > 0 {
+			elided.objects++
+			marker, _ := json.Marshal(fmt.Sprintf("[... %d items elided ...]", len(n.array)))
+			b.Write(marker)
+			return
+		}
+		items := n.array
+		skipped := 0
+		if len(items) > maxItems {
+			head := (maxItems + 1) / 2
+			tail := maxItems - head
+			skipped = len(items) - maxItems
+			items = append(append(items[:head:head], nil), n.array[len(n.array)-tail:]...)
+			elided.items += skipped
+		}
+		b.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if item == nil {
+				marker, _ := json.Marshal(fmt.Sprintf("... %d more items ...", skipped))
+				b.Write(marker)
+				continue
+			}
+			writeJSONNode(b, item, maxItems, maxDepth-1, elided)
+		}
+		b.WriteByte(']')
+	default:
+		b.Write(n.scalar)
+	}
+}
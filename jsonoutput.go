@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultJSONRepairRounds is how often an invalid JSON answer is sent back
+// for repair unless json_repair_rounds is set.
+const defaultJSONRepairRounds = 2
+
+// jsonAnswerInstruction is added to the system message of requests for a
+// JSON answer. OpenAI's JSON mode also requires the word in the messages.
+const jsonAnswerInstruction = "Respond with valid JSON only, without Markdown code fences or any other text."
+
+// answerFormat asks the provider for a JSON answer, matching Schema if set.
+type answerFormat struct {
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// answerFormat returns the format requested with --json or --schema, or
+// nil for a free-form answer.
+func (o *options) answerFormat() (*answerFormat, error) {
+	if o.schema == "" {
+		if o.json {
+			return &answerFormat{}, nil
+		}
+		return nil, nil
+	}
+	data, err := os.ReadFile(o.schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --schema: %w", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid --schema %s: %w", o.schema, err)
+	}
+	return &answerFormat{Schema: schema}, nil
+}
+
+// requestJSON makes req ask for a JSON answer in format.
+func requestJSON(req *chatRequest, format *answerFormat) {
+	req.Format = format
+	instruction := jsonAnswerInstruction
+	if format.Schema != nil {
+		schema, _ := json.Marshal(format.Schema)
+		instruction += " The JSON must match this JSON Schema: " + string(schema)
+	}
+	req.Messages = addSystemInstruction(req.Messages, instruction)
+}
+
+// openAI returns the response_format of the chat completions API.
+func (f *answerFormat) openAI() any {
+	if f == nil {
+		return nil
+	}
+	if f.Schema == nil {
+		return map[string]any{"type": "json_object"}
+	}
+	return map[string]any{"type": "json_schema", "json_schema": map[string]any{"name": "answer", "schema": f.Schema}}
+}
+
+// responses returns the text format of the Responses API.
+func (f *answerFormat) responses() *responsesText {
+	if f == nil {
+		return nil
+	}
+	if f.Schema == nil {
+		return &responsesText{Format: map[string]any{"type": "json_object"}}
+	}
+	return &responsesText{Format: map[string]any{"type": "json_schema", "name": "answer", "schema": f.Schema}}
+}
+
+// ollama returns the format parameter of Ollama's chat API: "json" or the
+// schema itself.
+func (f *answerFormat) ollama() any {
+	if f == nil {
+		return nil
+	}
+	if f.Schema == nil {
+		return "json"
+	}
+	return f.Schema
+}
+
+// check returns the JSON of an answer without a Markdown fence, or an error
+// describing why it is invalid.
+func (f *answerFormat) check(answer string) (string, error) {
+	answer = stripJSONFence(answer)
+	var value any
+	if err := json.Unmarshal([]byte(answer), &value); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	if f.Schema != nil {
+		if err := checkJSONSchema(f.Schema, value, "$"); err != nil {
+			return "", fmt.Errorf("schema mismatch: %w", err)
+		}
+	}
+	return answer, nil
+}
+
+// repairJSONAnswer checks the answer to a JSON request. An invalid answer
+// is sent back to the model together with the error, up to
+// json_repair_rounds times, before giving up. The tokens of the repair
+// rounds are added to the result.
+func repairJSONAnswer(config *Config, req *chatRequest, result *completion) (*completion, error) {
+	rounds := defaultJSONRepairRounds
+	if config.JSONRepairRounds != nil {
+		rounds = *config.JSONRepairRounds
+	}
+
+	messages := req.Messages
+	for {
+		answer, err := req.Format.check(result.Content)
+		if err == nil {
+			result.Content = answer
+			return result, nil
+		}
+		if result.RepairRounds >= rounds {
+			return nil, fmt.Errorf("no valid JSON answer after %d repair rounds: %w", result.RepairRounds, err)
+		}
+
+		notef("Warning: rejected the answer (%v), asking the model to fix it\n", err)
+		messages = append(messages,
+			OpenAIMessage{Role: "assistant", Content: result.Content},
+			OpenAIMessage{Role: "user", Content: fmt.Sprintf("Your answer was rejected: %v. Reply with the corrected JSON only.", err)})
+		repair := *req
+		repair.Messages = messages
+		repaired, err := executeRequest(&repair, nil)
+		if err != nil {
+			return nil, err
+		}
+		repaired.RepairRounds = result.RepairRounds + 1
+		repaired.PromptTokens += result.PromptTokens
+		repaired.CachedTokens += result.CachedTokens
+		repaired.CompletionTokens += result.CompletionTokens
+		result = repaired
+	}
+}
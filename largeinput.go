@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	// defaultInputConfirmBytes is the size of piped input above which a
+	// terminal user is asked before it is sent.
+	defaultInputConfirmBytes = 100 << 10
+	// defaultInputMaxBytes is the size of piped input that is refused
+	// without a terminal to ask on.
+	defaultInputMaxBytes = 1 << 20
+)
+
+// confirmLargeInput asks before large piped input is sent, showing its size
+// and the estimated tokens and cost of req. Since stdin is the pipe, the
+// answer is read from the terminal. Without one, input above the hard cap
+// is refused. --yes skips both.
+func confirmLargeInput(config *Config, req *chatRequest, piped string, opts *options) error {
+	threshold := config.InputConfirmBytes
+	if threshold <= 0 {
+		threshold = defaultInputConfirmBytes
+	}
+	if opts.yes || opts.batch || len(piped) <= threshold {
+		return nil
+	}
+
+	tokens := countMessageTokens(req)
+	estimate := fmt.Sprintf("%s tokens", tokens)
+	if cost := estimateCost(req.Provider, req.Model, tokens.n, 0); cost > 0 {
+		estimate += fmt.Sprintf(", est. $%.2f", cost)
+	}
+
+	tty, err := openTerminal()
+	if err != nil || !isTerminal(os.Stderr) {
+		limit := config.InputMaxBytes
+		if limit <= 0 {
+			limit = defaultInputMaxBytes
+		}
+		if len(piped) <= limit {
+			return nil
+		}
+		return &exitError{code: exitUsage, err: fmt.Errorf("piped input of %s (%s) exceeds the %s limit; use --yes to send it anyway or raise input_max_bytes",
+			formatBytes(len(piped)), estimate, formatBytes(limit))}
+	}
+	defer tty.Close()
+
+	notef("About to send %s (%s) to %s/%s — continue? [y/N]: ", formatBytes(len(piped)), estimate, req.Provider, req.Model)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("cancelled, nothing was sent")
+	}
+	return nil
+}
+
+// openTerminal opens the controlling terminal, to ask questions while stdin
+// is a pipe.
+func openTerminal() (*os.File, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	return os.Open(name)
+}
+
+// formatTokenCount shortens large token counts, e.g. "350k".
+func formatTokenCount(n int) string {
+	if n >= 10_000 {
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultLMStudioURL is the OpenAI-compatible server LM Studio starts
+	// on this machine.
+	defaultLMStudioURL = "http://localhost:1234/v1"
+	// lmStudioProbeTimeout bounds the check whether LM Studio is running,
+	// which happens whenever the models are listed.
+	lmStudioProbeTimeout = 2 * time.Second
+)
+
+// lmStudioURL returns the base URL of the LM Studio server: lmstudio_url
+// from the configuration or the default.
+func lmStudioURL() string {
+	config, err := loadConfigOrDefault()
+	if err != nil || config.LMStudioURL == "" {
+		return defaultLMStudioURL
+	}
+	return strings.TrimSuffix(config.LMStudioURL, "/")
+}
+
+// listLMStudioModels returns the models LM Studio serves. If nothing
+// listens on its port, LM Studio isn't running, which is not an error: the
+// provider is just not offered.
+func listLMStudioModels() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lmStudioProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", lmStudioURL()+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach LM Studio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing LM Studio models: %s", resp.Status)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse LM Studio models: %w", err)
+	}
+	var models []string
+	for _, m := range list.Data {
+		// embedding models are listed too but can't answer prompts
+		if !strings.Contains(m.ID, "embedding") {
+			models = append(models, m.ID)
+		}
+	}
+	return models, nil
+}
+
+// sendError describes a failure to send a request to provider, pointing
+// out an LM Studio server that isn't running.
+func sendError(provider Provider, err error) error {
+	if provider == LMStudio && errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("LM Studio is not running: start its server on %s", lmStudioURL())
+	}
+	return fmt.Errorf("failed to send request: %w", err)
+}
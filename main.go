@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,134 +13,524 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 type Provider string
 
 const (
-	OpenAI = "openai"
-	Ollama = "ollama"
+	OpenAI   = "openai"
+	Ollama   = "ollama"
+	LMStudio = "lmstudio"
 )
 
+// knownProviders are all providers, in the order they are listed.
+var knownProviders = []Provider{Ollama, LMStudio, OpenAI}
+
+// isLocal reports whether the provider runs the models on the user's
+// machine, so requests cost nothing and don't leave it.
+func (p Provider) isLocal() bool {
+	return p == Ollama || p == LMStudio
+}
+
+// displayName is the provider's name in messages.
+func (p Provider) displayName() string {
+	switch p {
+	case OpenAI:
+		return "OpenAI"
+	case LMStudio:
+		return "LM Studio"
+	case Ollama:
+		return "Ollama"
+	}
+	return string(p)
+}
+
+// parseModelSpec splits a "provider/model" reference. If the prefix is not a
+// known provider or plugin, the whole spec is treated as a model name and
+// the provider is left empty.
+func parseModelSpec(spec string) (Provider, string) {
+	prefix, model, found := strings.Cut(spec, "/")
+	if found {
+		switch Provider(prefix) {
+		case Ollama, OpenAI, LMStudio:
+			return Provider(prefix), model
+		}
+		if Provider(prefix).isPlugin() {
+			return Provider(prefix), model
+		}
+	}
+	return "", spec
+}
+
 type Config struct {
-	Model    string   `json:"model"`
-	Provider Provider `json:"provider"` // "ollama" or "openai"
+	Model        string   `json:"model"`
+	Provider     Provider `json:"provider"` // "ollama", "lmstudio", "openai" or a plugin
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+	Language     string   `json:"language,omitempty"` // answer language, e.g. "German"
+	// DefaultModels remembers the last model chosen for each provider, so
+	// "ai-cli use" can switch providers without the picker.
+	DefaultModels map[Provider]string `json:"default_models,omitempty"`
+	// StrictCommands makes unknown first arguments an error instead of a
+	// prompt; prompts must then be sent with "ask" or after "--".
+	StrictCommands bool `json:"strict_commands,omitempty"`
+	// OpenAIAPI selects the OpenAI endpoint: "chat" (default) for chat
+	// completions or "responses" for the Responses API, see responses.go.
+	OpenAIAPI string `json:"openai_api,omitempty"`
+	// Aliases map short names to "provider/model" references or to other
+	// aliases, e.g. "fast": "ollama/llama3.2".
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// TaskModels overrides the model for built-in tasks such as "run" and
+	// "title". Values are aliases or model references.
+	TaskModels map[string]string `json:"task_models,omitempty"`
+	// LengthPresets overrides the instructions added by --short, --long
+	// and --bullets, keyed by "short", "long" and "bullets".
+	LengthPresets map[string]string `json:"length_presets,omitempty"`
+	// EscalationModel is the model (alias or reference) "ai-cli escalate"
+	// re-sends the last request to, e.g. "openai/gpt-5.2".
+	EscalationModel string `json:"escalation_model,omitempty"`
+	// PromptPrefix and PromptSuffix are added around every plain prompt,
+	// e.g. "Answer concisely. No preamble." as suffix.
+	PromptPrefix string `json:"prompt_prefix,omitempty"`
+	PromptSuffix string `json:"prompt_suffix,omitempty"`
+	// BudgetUSD is the monthly spending limit for paid providers, based on
+	// the estimated cost in the usage log. 0 disables the limit.
+	BudgetUSD float64 `json:"budget_usd,omitempty"`
+	// CostConfirmUSD is the estimated cost of a single request above which
+	// ai-cli asks before sending it. 0 disables the check.
+	CostConfirmUSD float64 `json:"cost_confirm_usd,omitempty"`
+	// RateLimit throttles requests to cloud providers across all running
+	// ai-cli processes.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// InputConfirmBytes is the size of piped input (default 100 KiB) above
+	// which ai-cli asks before sending it. Without a terminal, input above
+	// InputMaxBytes (default 1 MiB) is refused instead.
+	InputConfirmBytes int `json:"input_confirm_bytes,omitempty"`
+	InputMaxBytes     int `json:"input_max_bytes,omitempty"`
+	// URLMaxBytes limits how much text of each --url page is added to the
+	// prompt. 0 means the default of 32 KiB.
+	URLMaxBytes int `json:"url_max_bytes,omitempty"`
+	// ExecTimeout is how long each --exec command may run, e.g. "1m"
+	// (default 30s). ExecMaxBytes caps the output of all --exec commands
+	// together (default 64 KiB).
+	ExecTimeout  string `json:"exec_timeout,omitempty"`
+	ExecMaxBytes int    `json:"exec_max_bytes,omitempty"`
+	// Offline refuses every provider that would send data off the machine,
+	// allowing only Ollama hosts and an LM Studio server on the local
+	// network.
+	Offline bool `json:"offline,omitempty"`
+	// AuditLog is a file recording every prompt sent to a cloud provider
+	// (and to Ollama and LM Studio with AuditLogLocal). AuditLogContent adds the full
+	// messages to the hash and size, and the log is rotated at
+	// AuditLogMaxBytes (default 10 MiB).
+	AuditLog         string `json:"audit_log,omitempty"`
+	AuditLogContent  bool   `json:"audit_log_content,omitempty"`
+	AuditLogLocal    bool   `json:"audit_log_local,omitempty"`
+	AuditLogMaxBytes int64  `json:"audit_log_max_bytes,omitempty"`
+	// Stream prints answers as they arrive. A stream that stalls for
+	// StreamIdleTimeout seconds (default 30) once it has started is cut off.
+	Stream            bool `json:"stream,omitempty"`
+	StreamIdleTimeout int  `json:"stream_idle_timeout,omitempty"`
+	// StreamMeter shows the tokens per second while an answer streams, as
+	// --meter does.
+	StreamMeter bool `json:"stream_meter,omitempty"`
+	// WebSearch is the search backend for --web-search with models that
+	// have no hosted search tool.
+	WebSearch *WebSearch `json:"web_search,omitempty"`
+	// MCPServers are Model Context Protocol servers whose tools can be
+	// enabled with --tools, keyed by server name.
+	MCPServers map[string]MCPServer `json:"mcp_servers,omitempty"`
+	// PostProcessCmd is a shell command every answer is piped through
+	// before it is printed; its stdout replaces the answer.
+	PostProcessCmd string `json:"post_process_cmd,omitempty"`
+	// PreProcessCmd is a shell command the assembled prompt is piped
+	// through before it is sent; a failure aborts the request.
+	PreProcessCmd string `json:"pre_process_cmd,omitempty"`
+	// ModelCapabilities describe models the built-in table doesn't know,
+	// keyed by "provider/model" or model, see capabilities.go.
+	ModelCapabilities map[string]ModelCapabilities `json:"model_capabilities,omitempty"`
+	// EnvFile is read for provider keys instead of .env in the working
+	// directory, see dotenv.go.
+	EnvFile string `json:"env_file,omitempty"`
+	// UserID is sent as the user of OpenAI requests, for the abuse
+	// monitoring of an organization. AI_CLI_USER overrides it.
+	UserID string `json:"user_id,omitempty"`
+	// RequestSigner adds headers to the requests to the providers, see
+	// signer.go.
+	RequestSigner *RequestSigner `json:"request_signer,omitempty"`
+	// Templates are reusable prompts and Roles named system prompts, see
+	// templates.go.
+	Templates map[string]Template `json:"templates,omitempty"`
+	Roles     map[string]Role     `json:"roles,omitempty"`
+	// Fragments are shared pieces of template prompts, inserted with
+	// {{include "name"}}.
+	Fragments map[string]string `json:"fragments,omitempty"`
+	// Routing chooses the model by prompt size and content, or by --tier.
+	Routing *Routing `json:"routing,omitempty"`
+	// AutoSession continues one session per project (git repository or
+	// directory) for plain prompts and chat, see workspace.go.
+	AutoSession bool `json:"auto_session,omitempty"`
+	// OllamaMemoryGB is the memory Ollama can hold models in, for the
+	// warning before a model swap. It defaults to the machine's memory if
+	// Ollama runs locally.
+	OllamaMemoryGB float64 `json:"ollama_memory_gb,omitempty"`
+	// OllamaHosts are several Ollama instances to use instead of the one
+	// of OLLAMA_HOST, see ollamahosts.go.
+	OllamaHosts []OllamaHost `json:"ollama_hosts,omitempty"`
+	// LMStudioURL is the base URL of the LM Studio server, by default
+	// http://localhost:1234/v1, see lmstudio.go.
+	LMStudioURL string `json:"lmstudio_url,omitempty"`
+	// ProviderPlugins adds providers run by external programs, by name,
+	// besides the ai-cli-provider-<name> programs on PATH; PluginTimeout
+	// (seconds, default 120) bounds every call. See plugin.go.
+	ProviderPlugins map[string]string `json:"provider_plugins,omitempty"`
+	PluginTimeout   int               `json:"plugin_timeout,omitempty"`
+	// SessionTitles lets the model title sessions after their first
+	// exchange (default true), see startSessionTitle.
+	SessionTitles *bool `json:"session_titles,omitempty"`
+	// HistoryStrategy is how chat and session histories are shortened when
+	// they outgrow the context window: "trim" (default) drops the oldest
+	// exchanges, "summarize" replaces them with a summary. HistoryReserve
+	// tokens (default 4096) are kept free for the answer, and ContextWindow
+	// overrides the window of the model; Ollama also gets it as num_ctx.
+	HistoryStrategy string `json:"history_strategy,omitempty"`
+	HistoryReserve  int    `json:"history_reserve,omitempty"`
+	ContextWindow   int    `json:"context_window,omitempty"`
+	// JSONRepairRounds is how often an answer that isn't valid JSON (or
+	// doesn't match --schema) is sent back for repair. nil means 2.
+	JSONRepairRounds *int `json:"json_repair_rounds,omitempty"`
+	// ShowFooter controls the one-line model summary printed to a terminal
+	// after each answer (default true).
+	ShowFooter *bool `json:"show_footer,omitempty"`
+	// NotifyAfter is a duration such as "30s"; requests taking longer end
+	// with a desktop notification, as with --notify.
+	NotifyAfter string `json:"notify_after,omitempty"`
 }
 
 type OpenAIRequest struct {
-	Model    string          `json:"model"`
-	Messages []OpenAIMessage `json:"messages"`
+	Model          string               `json:"model"`
+	Messages       []OpenAIMessage      `json:"messages"`
+	Temperature    *float64             `json:"temperature,omitempty"`
+	MaxTokens      int                  `json:"max_completion_tokens,omitempty"`
+	Tools          []toolDefinition     `json:"tools,omitempty"`
+	Stream         bool                 `json:"stream,omitempty"`
+	StreamOptions  *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	ResponseFormat any                  `json:"response_format,omitempty"`
+	User           string               `json:"user,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIStreamChunk is one server-sent event of a streamed answer.
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Delta        OpenAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// OpenAIUsage is the token usage of a chat completion. The cached tokens are
+// the part of the prompt served from the provider's prompt cache.
+type OpenAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
 }
 
 type OpenAIMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are requested by the assistant; the results come back in
+	// "tool" messages carrying the call's ID.
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// ReasoningContent is the reasoning some OpenAI-compatible APIs such as
+	// DeepSeek's stream ahead of the answer. It is never sent back.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Refusal is why the model declined to answer. It is never sent back.
+	Refusal string `json:"refusal,omitempty"`
 }
 
 type OpenAIResponse struct {
 	Choices []struct {
-		Message OpenAIMessage `json:"message"`
+		Message      OpenAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
 	} `json:"choices"`
+	Usage OpenAIUsage `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
+		Code    string `json:"code"`
 	} `json:"error,omitempty"`
 }
 
-const configFileName = ".config/ai-cli.json"
+// chatRequest is a fully assembled request as it is sent to a provider.
+type chatRequest struct {
+	Provider    Provider         `json:"provider"`
+	Model       string           `json:"model"`
+	Messages    []OpenAIMessage  `json:"messages"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	MaxTokens   int              `json:"max_tokens,omitempty"` // 0: the provider's limit
+	Tools       []toolDefinition `json:"tools,omitempty"`
+	// ContextWindow is the context size Ollama loads the model with, see
+	// context_window. 0 keeps Ollama's default.
+	ContextWindow int `json:"context_window,omitempty"`
+	// WebSearch enables the provider's hosted web search tool.
+	WebSearch bool `json:"web_search,omitempty"`
+	// Format asks for a JSON answer, see --json and --schema.
+	Format *answerFormat `json:"format,omitempty"`
+	// Think asks for the reasoning of reasoning models, see --show-thinking.
+	Think bool `json:"think,omitempty"`
+	// Tags attribute the usage of the request, see --tag.
+	Tags []string `json:"tags,omitempty"`
+	// User identifies the end user to OpenAI, see user_id.
+	User string `json:"user,omitempty"`
+}
+
+// completion is a provider's answer together with the metadata needed for
+// statistics.
+type completion struct {
+	Content      string
+	PromptTokens int
+	// CachedTokens is the part of PromptTokens read from the provider's
+	// prompt cache, which is billed at a lower price.
+	CachedTokens     int `json:",omitempty"`
+	CompletionTokens int
+	// FinishReason is "length" if the answer was cut off at the token
+	// limit and "content_filter" if the provider's filter stopped it.
+	// RawFinishReason is the reason as the provider reported it, e.g.
+	// "stop", for messages.
+	FinishReason    string `json:",omitempty"`
+	RawFinishReason string `json:",omitempty"`
+	// RepairRounds counts the requests it took to fix an invalid JSON
+	// answer.
+	RepairRounds int `json:",omitempty"`
+	// EvalDuration is the pure generation time if the provider reports it.
+	EvalDuration time.Duration
+	// ToolCalls are the tools the model wants to run before it answers.
+	ToolCalls []toolCall
+	// Citations are the URLs of sources a hosted web search reported.
+	Citations []string `json:",omitempty"`
+	// Refusal is why the model declined to answer, if it did.
+	Refusal string `json:",omitempty"`
+}
+
+const (
+	configFileName = ".config/ai-cli.json"
+	stateDirName   = ".config/ai-cli"
+)
+
+var openAIBaseURL = "https://api.openai.com/v1"
 
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	opts, args, err := parseOptions(os.Args[1:])
+	if err == nil {
+		loadDotenv(opts)
+		err = enableDebugCapture(opts.debugDir)
+	}
+	if err == nil {
+		err = run(opts, args)
+	}
+	if err != nil {
+		os.Exit(printError(err, opts))
 	}
 }
 
-func run() error {
-	var outputFile string
-	args := os.Args[1:]
+func run(opts *options, args []string) error {
+	if opts.color != "" {
+		colorMode = opts.color
+	}
 
-	for i := 0; i < len(args); i++ {
-		if args[i] == "-o" {
-			if i+1 >= len(args) {
-				return fmt.Errorf("-o flag requires a filename argument")
-			}
-			outputFile = args[i+1]
-			args = append(args[:i], args[i+2:]...)
-			break
-		}
+	// "--" forces everything after it to be treated as the prompt
+	if len(args) > 0 && args[0] == "--" {
+		return promptCommand(args[1:], opts)
 	}
 
 	if len(args) > 0 {
 		switch args[0] {
+		case "ask":
+			if len(args) > 1 && args[1] == "--" {
+				return promptCommand(args[2:], opts)
+			}
+			return promptCommand(args[1:], opts)
+		case "init":
+			return initSubcommand(args[1:], opts)
 		case "set-model":
-			return setModelCommand()
+			return setModelCommand(args[1:])
+		case "use":
+			return useCommand(args[1:])
+		case "run":
+			return runCommand(args[1:], opts)
+		case "config":
+			return configCommand(args[1:])
+		case "models":
+			return modelsCommand(args[1:])
+		case "unload":
+			return unloadCommand(args[1:])
+		case "batch":
+			return batchCommand(args[1:], opts)
+		case "usage":
+			return usageCommand(args[1:])
+		case "purge":
+			return purgeCommand(args[1:], opts)
+		case "retry":
+			return retryCommand(args[1:], opts)
+		case "escalate":
+			return escalateCommand(args[1:], opts)
+		case "daemon":
+			return daemonCommand(args[1:])
+		case "serve":
+			return serveCommand(args[1:], opts)
+		case "tools":
+			return toolsCommand(args[1:], opts)
+		case "tpl":
+			return tplCommand(args[1:], opts)
+		case "chat":
+			return chatCommand(args[1:], opts)
+		case "sessions":
+			return sessionsCommand(args[1:])
+		case "roles":
+			return rolesCommand(args[1:], opts)
+		case "bench":
+			return benchCommand(args[1:], opts)
+		case "compare":
+			return compareCommand(args[1:], opts)
 		case "--help", "-h", "help":
 			return printHelp()
 		default:
-			if err := ensureConfigExists(); err != nil {
-				return err
-			}
-			prompt := strings.Join(args, " ")
-
-			// If there's piped input, append it to the prompt
-			if isPiped() {
-				input, err := io.ReadAll(os.Stdin)
-				if err != nil {
-					return fmt.Errorf("failed to read piped input: %w", err)
+			if suggestion := suggestCommand(args[0]); suggestion != "" {
+				return &exitError{
+					code: exitUsage,
+					err:  fmt.Errorf("unknown command '%s', did you mean '%s'? (use -- or 'ask' to send it as a prompt)", args[0], suggestion),
 				}
-				prompt = prompt + "\n\n" + strings.TrimSpace(string(input))
 			}
-
-			output, err := executePrompt(prompt)
-			if err != nil {
-				return err
+			if config, err := loadConfig(); err == nil && config.StrictCommands {
+				return &exitError{
+					code: exitUsage,
+					err:  fmt.Errorf("unknown command '%s' (strict_commands is enabled: use 'ai-cli ask \"...\"' to send a prompt)", args[0]),
+				}
 			}
-			return writeOutput(output, outputFile)
 		}
 	}
 
-	if isPiped() {
-		path := getConfigPath()
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			return fmt.Errorf("not initialized: run once in interactive mode to configure")
+	return promptCommand(args, opts)
+}
+
+// promptCommand sends a prompt built from args and piped input. Without
+// args the prompt is read from the pipe or, interactively, from the terminal.
+func promptCommand(args []string, opts *options) error {
+	opts.autoSession = true
+	// --instruction states the task when the data comes from a here-doc
+	if opts.instruction != "" {
+		if len(args) > 0 {
+			return &exitError{code: exitUsage, err: fmt.Errorf("give the prompt either as arguments or with --instruction, not both")}
+		}
+		args = []string{opts.instruction}
+	}
+	if len(args) > 0 {
+		if err := ensureConfigExists(); err != nil {
+			return err
+		}
+		args = fileArguments(args, opts)
+		input := userInput{Prompt: strings.Join(args, " ")}
+		if opts.watch {
+			return watchPrompt(input, opts)
 		}
-		input, err := io.ReadAll(os.Stdin)
+
+		// If there's piped input, append it to the prompt
+		piped, err := pipedInput(opts)
 		if err != nil {
-			return fmt.Errorf("failed to read piped input: %w", err)
+			return err
+		}
+		input.Piped = piped
+
+		output, err := executePrompt(input, opts)
+		return deliver(output, err, opts)
+	}
+
+	if isPiped() || opts.paste {
+		if !configExists() {
+			return fmt.Errorf("not initialized: run once in interactive mode to configure")
 		}
-		output, err := executePrompt(strings.TrimSpace(string(input)))
+		piped, err := pipedInput(opts)
 		if err != nil {
 			return err
 		}
-		return writeOutput(output, outputFile)
+		output, err := executePrompt(userInput{Piped: piped}, opts)
+		return deliver(output, err, opts)
 	}
 
-	// interactive mode
+	// interactive mode, unless there is no one to type the prompt
+	if !isTerminal(os.Stdin) {
+		return &exitError{code: exitUsage, err: fmt.Errorf(`no prompt given and stdin is not a terminal; pass the prompt as an argument (ai-cli "your prompt") or pipe it in (echo "your prompt" | ai-cli)`)}
+	}
 	if err := ensureConfigExists(); err != nil {
 		return err
 	}
 	fmt.Print("Enter your prompt: ")
 	reader := bufio.NewReader(os.Stdin)
 	prompt, err := reader.ReadString('\n')
-	if err != nil {
+	if err == io.EOF && strings.TrimSpace(prompt) == "" {
+		fmt.Println()
+		return &exitError{code: exitUsage, err: fmt.Errorf("no prompt entered")}
+	}
+	if err != nil && err != io.EOF {
 		return fmt.Errorf("failed to read input: %w", err)
 	}
-	output, err := executePrompt(strings.TrimSpace(prompt))
+	output, err := executePrompt(userInput{Prompt: strings.TrimSpace(prompt)}, opts)
+	return deliver(output, err, opts)
+}
+
+// pipedInput returns the input piped to stdin or, with --paste, the text
+// on the clipboard, or "" if there is none. Piping with --paste is an
+// error, since it is unclear which input is meant.
+func pipedInput(opts *options) (string, error) {
+	if opts.paste {
+		if isPiped() {
+			return "", &exitError{code: exitUsage, err: fmt.Errorf("--paste can't be combined with piped input; use one or the other")}
+		}
+		text, err := pasteFromClipboard()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(text), nil
+	}
+	if !isPiped() {
+		return "", nil
+	}
+	piped, err := io.ReadAll(os.Stdin)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to read piped input: %w", err)
 	}
-	return writeOutput(output, outputFile)
+	return strings.TrimSpace(string(piped)), nil
 }
 
 func ensureConfigExists() error {
-	path := getConfigPath()
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if !configExists() {
 		fmt.Println("No configuration found. Running initial setup...")
-		return initCommand()
+		return initCommand(setupOptions{})
 	}
 	return nil
 }
 
+// configExists reports whether there is a configuration to run with, which
+// in stateless mode comes from the environment.
+func configExists() bool {
+	if statelessMode() {
+		return true
+	}
+	_, err := os.Stat(getConfigPath())
+	return !os.IsNotExist(err)
+}
+
 func isOllamaInstalled() bool {
 	_, err := exec.LookPath("ollama")
 	return err == nil
@@ -150,8 +541,24 @@ func hasOpenAIToken() bool {
 }
 
 func isPiped() bool {
-	stat, _ := os.Stdin.Stat()
-	return (stat.Mode() & os.ModeCharDevice) == 0
+	stat, err := os.Stdin.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) == 0
+}
+
+// isTerminal reports whether f is a terminal. The null device is a
+// character device too, but nobody types into it.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(stat, null)
+}
+
+// isInteractive reports whether the user can be asked questions.
+func isInteractive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
 }
 
 func getConfigPath() string {
@@ -159,7 +566,20 @@ func getConfigPath() string {
 	return filepath.Join(home, configFileName)
 }
 
+// getStateDir returns the directory holding caches and other state that is
+// not part of the configuration.
+func getStateDir() string {
+	if dir := os.Getenv(stateDirEnv); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, stateDirName)
+}
+
 func loadConfig() (*Config, error) {
+	if statelessMode() {
+		return statelessConfig()
+	}
 	path := getConfigPath()
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -170,10 +590,51 @@ func loadConfig() (*Config, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
+	if err := validateAliases(config.Aliases); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := validateWebSearch(config.WebSearch); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := validateRouting(&config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if config.HistoryStrategy != "" && config.HistoryStrategy != "trim" && config.HistoryStrategy != "summarize" {
+		return nil, fmt.Errorf("invalid config %s: history_strategy must be trim or summarize", path)
+	}
+	if config.OpenAIAPI != "" && config.OpenAIAPI != "chat" && config.OpenAIAPI != "responses" {
+		return nil, fmt.Errorf("invalid config %s: openai_api must be chat or responses", path)
+	}
+	if config.RequestSigner != nil && config.RequestSigner.Command == "" {
+		return nil, fmt.Errorf("invalid config %s: request_signer needs a command", path)
+	}
+	if err := validateOllamaHosts(config.OllamaHosts); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := validateProviderPlugins(config.ProviderPlugins); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	library := templateLibrary{Templates: config.Templates, Roles: config.Roles, Fragments: config.Fragments}
+	if err := library.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
 	return &config, nil
 }
 
+// loadConfigOrDefault is like loadConfig but returns an empty configuration
+// if none has been created yet.
+func loadConfigOrDefault() (*Config, error) {
+	config, err := loadConfig()
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
 func saveConfig(config *Config) error {
+	if statelessMode() {
+		return errStatelessConfig
+	}
 	path := getConfigPath()
 	dir := filepath.Dir(path)
 
@@ -186,10 +647,33 @@ func saveConfig(config *Config) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return writeFileAtomic(path, data, 0644)
 }
 
 func getInstalledModels() ([]string, error) {
+	installed, err := listOllamaModels()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, m := range installed {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// ollamaModel is an entry of "ollama list".
+type ollamaModel struct {
+	Name  string
+	Size  string   // as printed by ollama, e.g. "2.0 GB"
+	Hosts []string // the ollama_hosts that have the model
+}
+
+func listOllamaModels() ([]ollamaModel, error) {
+	if hasOllamaHosts() {
+		return listOllamaHostModels(ollamaHosts())
+	}
 	cmd := exec.Command("ollama", "list")
 	output, err := cmd.Output()
 	if err != nil {
@@ -197,15 +681,20 @@ func getInstalledModels() ([]string, error) {
 	}
 
 	lines := strings.Split(string(output), "\n")
-	var models []string
+	var models []ollamaModel
 
 	for i, line := range lines {
 		if i == 0 || strings.TrimSpace(line) == "" {
 			continue
 		}
+		// NAME ID SIZE MODIFIED, where SIZE is "<number> <unit>"
 		fields := strings.Fields(line)
 		if len(fields) > 0 {
-			models = append(models, fields[0])
+			model := ollamaModel{Name: fields[0]}
+			if len(fields) >= 4 {
+				model.Size = fields[2] + " " + fields[3]
+			}
+			models = append(models, model)
 		}
 	}
 
@@ -220,42 +709,15 @@ func getOpenAIModels() []string {
 	}
 }
 
-func getAllAvailableModels() (map[string][]string, error) {
-	available := make(map[string][]string)
-
-	if isOllamaInstalled() {
-		ollamaModels, err := getInstalledModels()
-		if err == nil && len(ollamaModels) > 0 {
-			available["ollama"] = ollamaModels
-		}
-	}
-
-	if hasOpenAIToken() {
-		available["openai"] = getOpenAIModels()
-	}
-
-	return available, nil
+// ModelOption is a selectable model in the pickers.
+type ModelOption struct {
+	Provider Provider
+	Model    string
 }
 
-func initCommand() error {
-	available, err := getAllAvailableModels()
-	if err != nil {
-		return err
-	}
-
-	if len(available) == 0 {
-		fmt.Println("No models available.")
-		fmt.Println("Please either:")
-		fmt.Println("  1. Install ollama and pull a model (e.g., 'ollama pull llama3.2')")
-		fmt.Println("  2. Set OPENAI_API_KEY environment variable")
-		return nil
-	}
-
-	// Build a flat list of models with their providers
-	type ModelOption struct {
-		Provider Provider
-		Model    string
-	}
+// modelOptions flattens the available models into a list, the local
+// providers first.
+func modelOptions(available map[string][]string) []ModelOption {
 	var options []ModelOption
 
 	if models, ok := available["ollama"]; ok {
@@ -263,78 +725,94 @@ func initCommand() error {
 			options = append(options, ModelOption{Provider: Ollama, Model: model})
 		}
 	}
+	if models, ok := available["lmstudio"]; ok {
+		for _, model := range models {
+			options = append(options, ModelOption{Provider: LMStudio, Model: model})
+		}
+	}
 	if models, ok := available["openai"]; ok {
 		for _, model := range models {
 			options = append(options, ModelOption{Provider: OpenAI, Model: model})
 		}
 	}
-
-	fmt.Println("Available models:")
-	for i, opt := range options {
-		fmt.Printf("%d. [%s] %s\n", i+1, opt.Provider, opt.Model)
+	for _, plugin := range pluginNames() {
+		for _, model := range available[string(plugin)] {
+			options = append(options, ModelOption{Provider: plugin, Model: model})
+		}
 	}
-	fmt.Printf("Select a model (1-%d) [1]: ", len(options))
+	return options
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
-	input = strings.TrimSpace(input)
+// printModelOptions prints the numbered picker list including each model's
+// details.
+func printModelOptions(options []ModelOption) {
+	details := fetchModelDetails(options)
+	hosts := ollamaModelHosts()
 
-	var choice int
-	if input == "" {
-		choice = 1
-	} else {
-		fmt.Sscanf(input, "%d", &choice)
-		if choice < 1 || choice > len(options) {
-			return fmt.Errorf("invalid choice")
-		}
+	fmt.Println("Available models:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, opt := range options {
+		fmt.Fprintf(w, "%d. [%s] %s\t%s\n", i+1, opt.Provider, modelLabel(opt, hosts), details[opt].summary())
 	}
+	w.Flush()
+}
 
-	selected := options[choice-1]
-	fmt.Printf("Selected: [%s] %s\n", selected.Provider, selected.Model)
-
-	config := &Config{
-		Model:    selected.Model,
-		Provider: selected.Provider,
+func setModelCommand(args []string) error {
+	if statelessMode() {
+		return errStatelessConfig
 	}
-	if err := saveConfig(config); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
 	}
+	refresh := slices.Contains(args, "--refresh")
+	args = slices.DeleteFunc(args, func(arg string) bool { return arg == "--refresh" })
 
-	fmt.Println("Configuration saved successfully!")
-	return nil
-}
+	// a model or alias given as argument skips the picker
+	if len(args) > 0 {
+		provider, model := config.resolveModel(args[0])
+		if provider == "" {
+			return fmt.Errorf("'%s' is neither an alias nor a provider/model reference", args[0])
+		}
+		config.setModel(provider, model)
+		if err := saveConfig(config); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Printf("Model changed to: [%s] %s\n", provider, model)
+		return nil
+	}
 
-func setModelCommand() error {
-	available, err := getAllAvailableModels()
+	available, unavailable, err := getAllAvailableModels(refresh)
 	if err != nil {
 		return err
 	}
 
 	if len(available) == 0 {
+		printUnavailableProviders(unavailable)
 		return fmt.Errorf("no models available")
 	}
 
-	type ModelOption struct {
-		Provider Provider
-		Model    string
-	}
-	var options []ModelOption
-
-	if models, ok := available["ollama"]; ok {
-		for _, model := range models {
-			options = append(options, ModelOption{Provider: Ollama, Model: model})
-		}
+	selected, err := pickModel(modelOptions(available), unavailable)
+	if err != nil {
+		return err
 	}
-	if models, ok := available["openai"]; ok {
-		for _, model := range models {
-			options = append(options, ModelOption{Provider: OpenAI, Model: model})
-		}
+	config.setModel(selected.Provider, selected.Model)
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	fmt.Println("Available models:")
-	for i, opt := range options {
-		fmt.Printf("%d. [%s] %s\n", i+1, opt.Provider, opt.Model)
+	fmt.Printf("Model changed to: [%s] %s", selected.Provider, selected.Model)
+	return nil
+}
+
+// pickModel lets the user choose one of options by number, noting the
+// providers that are unavailable.
+func pickModel(options []ModelOption, unavailable map[string]string) (ModelOption, error) {
+	if !isTerminal(os.Stdin) {
+		return ModelOption{}, &exitError{code: exitUsage, err: fmt.Errorf("stdin is not a terminal to pick a model on; name it instead: ai-cli set-model <provider/model>")}
 	}
+	printModelOptions(options)
+	printUnavailableProviders(unavailable)
 	fmt.Printf("Select a model (1-%d): ", len(options))
 
 	reader := bufio.NewReader(os.Stdin)
@@ -344,52 +822,248 @@ func setModelCommand() error {
 	var choice int
 	fmt.Sscanf(input, "%d", &choice)
 	if choice < 1 || choice > len(options) {
-		return fmt.Errorf("invalid choice")
+		return ModelOption{}, fmt.Errorf("invalid choice")
 	}
+	return options[choice-1], nil
+}
 
-	selected := options[choice-1]
-	config := &Config{
-		Model:    selected.Model,
-		Provider: selected.Provider,
+// useCommand switches to the remembered default model of a provider, e.g.
+// "ai-cli use openai". The picker only runs if there is none yet.
+func useCommand(args []string) error {
+	if len(args) != 1 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("usage: ai-cli use ollama|lmstudio|openai")}
+	}
+	if statelessMode() {
+		return errStatelessConfig
+	}
+	provider := Provider(args[0])
+	if !slices.Contains(knownProviders, provider) && !provider.isPlugin() {
+		return &exitError{code: exitUsage, err: fmt.Errorf("unknown provider '%s' (use ollama, lmstudio, openai or a plugin, or 'ai-cli ask' to send a prompt)", args[0])}
 	}
+
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	model := config.rememberedModel(provider)
+	if model == "" {
+		available, unavailable, err := getAllAvailableModels(false)
+		if err != nil {
+			return err
+		}
+		if reason, ok := unavailable[string(provider)]; ok {
+			return fmt.Errorf("%s is unavailable: %s", provider, reason)
+		}
+		options := modelOptions(map[string][]string{string(provider): available[string(provider)]})
+		if len(options) == 0 {
+			switch provider {
+			case OpenAI:
+				return fmt.Errorf("no OpenAI models available: set OPENAI_API_KEY")
+			case LMStudio:
+				return fmt.Errorf("no LM Studio models available: start its server at %s and load a model", lmStudioURL())
+			}
+			if provider.isPlugin() {
+				return fmt.Errorf("plugin %s lists no models", provider)
+			}
+			return fmt.Errorf("no Ollama models available: pull one with 'ollama pull'")
+		}
+		selected, err := pickModel(options, nil)
+		if err != nil {
+			return err
+		}
+		model = selected.Model
+	}
+
+	config.setModel(provider, model)
 	if err := saveConfig(config); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
+	fmt.Printf("Model changed to: [%s] %s\n", provider, model)
+	return nil
+}
 
-	fmt.Printf("Model changed to: [%s] %s", selected.Provider, selected.Model)
+// setModel makes provider/model the default and remembers it as the
+// provider's default model. The previous model stays remembered for its
+// provider, also in configurations from before DefaultModels.
+func (c *Config) setModel(provider Provider, model string) {
+	if c.DefaultModels == nil {
+		c.DefaultModels = make(map[Provider]string)
+	}
+	if c.Model != "" {
+		c.DefaultModels[c.Provider] = c.Model
+	}
+	c.Provider, c.Model = provider, model
+	c.DefaultModels[provider] = model
+}
+
+// rememberedModel returns the default model of provider, or "" if none was
+// chosen yet.
+func (c *Config) rememberedModel(provider Provider) string {
+	if c.Provider == provider && c.Model != "" {
+		return c.Model
+	}
+	return c.DefaultModels[provider]
+}
+
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return fmt.Errorf("usage: ai-cli config show")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("not initialized: run once in interactive mode to configure")
+		}
+		return err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s\n%s\n", getConfigPath(), data)
 	return nil
 }
 
 func printHelp() error {
 	config, err := loadConfig()
 	currentModel := "not configured"
+	language := "model default"
 	if err == nil {
 		currentModel = fmt.Sprintf("[%s] %s", config.Provider, config.Model)
+		for _, provider := range allProviders() {
+			if model := config.DefaultModels[provider]; provider != config.Provider && model != "" {
+				currentModel += fmt.Sprintf("\n  'ai-cli use %s': [%s] %s", provider, provider, model)
+			}
+		}
+		if config.Language != "" {
+			language = config.Language
+		}
 	}
 
-	fmt.Printf(`AI CLI - Ollama & OpenAI Command Line Interface
+	fmt.Printf(`AI CLI - Ollama, LM Studio & OpenAI Command Line Interface
 
 Current model: %s
+Answer language: %s
 
 Usage:
   ai-cli                        Interactive mode (prompts for input)
   ai-cli "your prompt"          Execute with direct prompt
+  ai-cli ask "your prompt"      Execute with direct prompt, never as a command
+  ai-cli use <provider>         Switch to the provider's last used model (ollama, lmstudio, openai, plugins)
+  ai-cli -- set-model           Send words that look like a command as a prompt
   ai-cli -o file.txt "prompt"   Execute and save output to file
   echo "prompt" | ai-cli        Execute with piped input
   echo "prompt" | ai-cli -o out.txt  Save piped output to file
+  ai-cli run -- <command>       Run a command and explain it if it fails
+  ai-cli batch -i in.txt "task"  Run the task for every input line (JSONL output)
+  ai-cli retry                  Re-send the last request (accepts --model, --temperature)
+  ai-cli escalate               Re-send the last request to the escalation_model
+  ai-cli daemon [status|stop]   Keep connections and recent answers warm
+  ai-cli serve [--port 8099]    Serve the OpenAI API locally through ai-cli
+  ai-cli chat [--session name]  Have a conversation, saved as a session
+  ai-cli sessions [show|rm]     List, show (--full: whole prompts) or remove saved sessions
+  ai-cli sessions import --from chatgpt|claude <file>  Import an exported conversation as a session
+  ai-cli tpl <name> [input]     Run a prompt template (also: tpl list, show, import, export)
+  ai-cli tpl test [name]        Check template answers against their tests
+  ai-cli roles bake <role>      Build an Ollama model with the role's system prompt
+  ai-cli tools list             Show the built-in and MCP tools --tools can enable
+  ai-cli init [--provider p] [--model p/m] [--pull]  Run the setup again
   ai-cli set-model              Change the model
+  ai-cli set-model <model>      Change the model to an alias or provider/model
+  ai-cli models [--refresh]     List available models and aliases (--refresh skips the cache)
+  ai-cli models --loaded        Show the Ollama models in memory
+  ai-cli unload [model|--all]   Free the memory of the loaded Ollama model, a named one or all
+  ai-cli usage [--by-tag]       Show this month's usage, cost and budget, per model or tag
+  ai-cli purge --all [--config] Delete history, sessions, cache and usage (or pick with
+                                --history, --sessions, --cache, --usage)
+  ai-cli config show            Show the current configuration
+  ai-cli bench --model p/m ...  Compare latency and throughput of models
+  ai-cli compare --model a --model b [--diff] "prompt"  Compare the answers of models
   ai-cli --help                 Show this help message
 
+Options:
+  -o <file>                     Write the output to a file (repeatable; .html and .json are converted,
+                                {date}, {time}, {model} and {slug} are filled in)
+  --allow-outside               Let an -o name with placeholders write outside its directory
+  --json                        Answer with JSON only, repairing invalid JSON
+  --schema <file>               Answer with JSON matching the JSON Schema in the file
+  --instruction <prompt>        The prompt, so piped input or a here-doc is only data
+  --lang <language>             Answer in the given language (e.g. --lang de)
+  --short, --long, --bullets    Ask for a brief, thorough or bulleted answer
+  --model <model|alias>         Use a different model for this run
+  --temperature <0-2>           Sampling temperature
+  --max-tokens <n>              Limit the length of the answer in tokens
+  --max-input-cost <usd>        Refuse prompts estimated to cost more than this
+  --auto-continue               Continue answers that were cut off at the token limit
+  --allow-empty                 Print an empty answer and exit 0 instead of failing
+  --watch                       Run the prompt again whenever a -f file changes
+  --scrub[=block|off]           Redact secrets from the prompt (default for cloud providers)
+  --moderate[=warn]             Check the prompt with OpenAI moderation first
+  --dry-run                     Show the resolved model and messages without sending
+  --no-wrap                     Don't add the configured prompt_prefix/prompt_suffix
+  --offline                     Only allow a local Ollama host, nothing leaves the network
+  --stream, --no-stream         Print the answer as it arrives (default from "stream")
+  --meter                       Show tokens and tokens/sec on stderr while streaming
+  --show-thinking               Print the reasoning of reasoning models to stderr
+  --yes                         Send large piped input or costly requests without asking
+  --errors json                 Report failures as a JSON object on stderr
+  --color <auto|always|never>   Color output (default: auto, off with NO_COLOR)
+  --over-budget                 Send to paid providers even above budget_usd
+  -f <file>                     Add a file to the prompt (text or PDF), or write #path in it
+  --no-file-args                Send trailing arguments naming files as prompt text
+  --smart-truncate              Elide function bodies of -f code files that don't fit
+  --table[=full]                Send only a summary of piped or -f CSV/TSV data
+  --json-input                  Shrink large piped JSON while keeping it valid
+  --tools[=read_file,...]       Let the model read files, fetch URLs, run confirmed commands
+                                and use MCP server tools
+  --url <url>                   Fetch a web page and add its text to the prompt
+  --exec <command>              Run a command and add its output and exit code to the prompt
+  --raw                         Print the answer exactly as received, without cleaning up whitespace
+  --raw-input                   Send piped HTML as is instead of converting it to text
+  --save-prompt <file>          Also write the prompt as sent, with model and parameters
+  --save-exchange <dir>         Write prompt and answer to new files in a directory
+  --no-citations                Don't ask the model to cite -f files by path or check its citations
+  --no-dotenv                   Don't read provider keys from .env
+  --no-squash                   Send repeated and blank lines of piped input to cloud models as is
+  --verbose                     Print details such as fetched page sizes to stderr
+  --debug-dir <dir>             Write each request and response to files, for bug reports
+  --code                        Print only the code blocks of the answer
+  --post <command>              Pipe the answer through a command (default post_process_cmd)
+  --copy                        Also copy the printed answer to the clipboard
+  --paste                       Use the text on the clipboard as piped input
+  --session <name>              Continue (or start) a saved conversation
+  -c, --continue                Continue the most recently used session
+  --role <name>                 Add a configured role's system prompt
+  --tag <tag>                   Record the request's usage under a tag (repeatable)
+  --tier <name>                 Use a model tier from the routing configuration
+  --quiet                       Don't print the model footer after the answer
+  --stats                       Print model, route, time, tokens and cost to stderr
+  --notify                      Show a desktop notification when the answer is complete
+  --web-search                  Let the model search the web and list the cited sources
+
+Output order:
+  The answer is reduced to its code blocks (--code), then piped through
+  --post/post_process_cmd, then written to stdout or -o and copied (--copy).
+
 Examples:
   ai-cli "What is the capital of France?"
   ai-cli -o answer.txt "Explain quantum computing"
   echo "Explain quantum computing" | ai-cli -o output.txt
+  ai-cli --url https://example.com/post "summarize this article"
+  ai-cli run -- make build
+  ai-cli run --tail 32 -- go test ./...
+  ai-cli bench --model ollama/llama3.2 --model openai/gpt-5-mini --runs 5
 
 Environment Variables:
   OPENAI_API_KEY                OpenAI API key (enables OpenAI models)
+  OLLAMA_HOST                   Ollama server address (default 127.0.0.1:11434)
+  AI_CLI_SERVE_TOKEN            Bearer token required by 'ai-cli serve'
+  BRAVE_API_KEY                 API key for the Brave web_search backend
 
 Note: Configuration is created automatically on first run.
-`, currentModel)
+`, currentModel, language)
 	return nil
 }
 
@@ -402,108 +1076,712 @@ func isModelInstalled(model string) (bool, error) {
 	return slices.Contains(models, model), nil
 }
 
-func writeOutput(output string, outputFile string) error {
-	if outputFile == "" {
-		fmt.Print(output)
-		return nil
+// deliver hands the model's answer to the user according to the options.
+// err is the error that came with the answer: a truncated stream still
+// delivers the partial answer and then exits with exitTruncated.
+func deliver(output string, err error, opts *options) error {
+	defer waitSessionTitle(opts)
+	var truncated *streamTruncatedError
+	if err != nil && !errors.As(err, &truncated) {
+		return err
 	}
+	if !opts.dryRun {
+		config, err := loadConfigOrDefault()
+		if err != nil {
+			return err
+		}
+		// a streamed answer is printed as it arrives and at most reduced to
+		// its code
+		if !opts.streamed {
+			output = processOutput(output, config, opts)
+			if err := writeAnswer(output, opts); err != nil {
+				opts.journal.abandon("the output files couldn't be written")
+				return err
+			}
+			opts.journal.remove()
+		} else {
+			// as it was printed
+			if !opts.raw {
+				output = normalizeOutput(output)
+			}
+			if opts.code {
+				output, _ = codeOf(output)
+			}
+		}
+		if opts.copy {
+			if err := copyToClipboard(output); err != nil {
+				notef("Warning: failed to copy the answer: %v\n", err)
+			}
+		}
 
-	if err := os.WriteFile(outputFile, []byte(output), 0644); err != nil {
-		return fmt.Errorf("failed to write output file: %w", err)
+		sources := opts.webSearch && opts.answered != nil
+		stats := opts.stats && opts.answered != nil
+		footer := !stats && showFooter(config, opts)
+		// end the answer's line before anything else appears on the terminal
+		if (sources || stats || footer || opts.chat) && len(opts.outputFiles) == 0 && !strings.HasSuffix(output, "\n") {
+			fmt.Println()
+		}
+		if sources {
+			// the list follows the answer on stdout, or goes to the
+			// terminal if the answer went to a file
+			w := io.Writer(os.Stdout)
+			if len(opts.outputFiles) > 0 {
+				w = os.Stderr
+			}
+			printSources(opts.sources, w)
+		}
+		switch {
+		case stats:
+			opts.answered.print()
+		case footer:
+			opts.answered.printFooter()
+		}
+	}
+	if truncated != nil {
+		if opts.streamed && !opts.chat {
+			fmt.Println()
+		}
+		notef("Warning: %v\n", truncated)
+		return &exitError{code: exitTruncated}
 	}
 	return nil
 }
 
-func executePrompt(prompt string) (string, error) {
-	if prompt == "" {
+// userInput is what the user provided for a single request.
+type userInput struct {
+	Prompt string // the instruction given as arguments or typed interactively
+	Piped  string // data read from stdin
+	// Sources is additional content such as -f files and --url pages.
+	Sources []contextSource
+}
+
+func executePrompt(input userInput, opts *options) (string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := validateOptions(config, opts); err != nil {
+		return "", err
+	}
+
+	if input.Sources, err = gatherSources(config, opts); err != nil {
+		return "", err
+	}
+	var references []contextSource
+	if input.Prompt, references, err = expandFileReferences(input.Prompt, opts); err != nil {
+		return "", err
+	}
+	input.Sources = append(input.Sources, references...)
+	if !opts.rawInput {
+		input.Piped = convertPipedHTML(input.Piped, opts)
+	}
+	input.Piped = tabularInput("piped input", input.Piped, opts)
+	if opts.jsonInput && input.Piped != "" {
+		if input.Piped, err = shrinkJSONInput(input.Piped, defaultJSONInputMaxBytes, opts); err != nil {
+			return "", err
+		}
+	}
+	if input.Prompt == "" && input.Piped == "" && len(input.Sources) == 0 {
 		return "", fmt.Errorf("empty prompt")
 	}
+	opts.prompt = input.Prompt
+	if opts.prompt == "" {
+		opts.prompt = input.Piped
+	}
 
-	config, err := loadConfig()
+	prompt, err := preProcessPrompt(config, composePrompt(config, opts, input))
+	if err != nil {
+		return "", err
+	}
+	req, source := buildRequest(config, opts, prompt)
+	// local models cost nothing, so only cloud requests are squashed
+	if !opts.noSquash && !req.Provider.isLocal() && input.Piped != "" {
+		if squashed := squashPipedInput(input.Piped, opts); squashed != input.Piped {
+			input.Piped = squashed
+			if prompt, err = preProcessPrompt(config, composePrompt(config, opts, input)); err != nil {
+				return "", err
+			}
+			req, source = buildRequest(config, opts, prompt)
+		}
+	}
+	if opts.smartTruncate {
+		if excess := estimateMessageTokens(req.Messages) - historyBudget(config, req); excess > 0 && smartTruncate(input.Sources, input.Prompt, excess, opts) {
+			if prompt, err = preProcessPrompt(config, composePrompt(config, opts, input)); err != nil {
+				return "", err
+			}
+			req, source = buildRequest(config, opts, prompt)
+		}
+	}
+	format, err := opts.answerFormat()
 	if err != nil {
 		return "", err
 	}
+	if format != nil {
+		requestJSON(req, format)
+	}
+	if !opts.dryRun {
+		if err := checkProviderKey(req, opts); err != nil {
+			return "", err
+		}
+	}
+	if opts.webSearch {
+		if err := addWebSearch(config, req, opts); err != nil {
+			return "", err
+		}
+	}
+	files := attachedFiles(opts, references)
+	if opts.noCitations {
+		files = nil
+	}
+	if len(files) > 0 {
+		req.Messages = addSystemInstruction(req.Messages, citationInstruction)
+	}
 
-	switch config.Provider {
-	case "ollama":
-		return executeOllama(config.Model, prompt)
-	case "openai":
-		return executeOpenAI(config.Model, prompt)
-	default:
-		return "", fmt.Errorf("unknown provider: %s", config.Provider)
+	name, err := sessionName(config, opts)
+	if err != nil {
+		return "", err
+	}
+	var conversation *session
+	if name != "" {
+		if conversation, err = loadSession(name); err != nil {
+			return "", err
+		}
+		if opts.sessionDir != "" {
+			conversation.Dir = opts.sessionDir
+		}
+		if err := withSession(config, req, conversation, opts); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.dryRun {
+		printDryRun(req, source)
+		return "", nil
+	}
+	if err := confirmLargeInput(config, req, input.Piped, opts); err != nil {
+		return "", err
+	}
+	if err := checkInputCost(req, opts); err != nil {
+		return "", err
+	}
+	if err := confirmCost(config, req, opts); err != nil {
+		return "", err
+	}
+	if opts.verbose {
+		notef("Model: [%s] %s (from %s)\n", req.Provider, req.Model, source)
+	}
+
+	start := time.Now()
+	result, err := sendRequest(req, opts)
+	if result == nil {
+		return "", err
+	}
+	opts.answered = newAnswerStats(req, result, source, time.Since(start))
+	if opts.webSearch {
+		opts.sources = citedSources(result)
+	}
+	if len(files) > 0 {
+		warnUncitablePaths(result.Content, files)
+	}
+	if err := saveExchange(req, result.Content, start, opts); err != nil {
+		notef("Warning: failed to save the prompt: %v\n", err)
+	}
+	if conversation != nil && err == nil {
+		// the session keeps the prompt as it was sent, without the secrets
+		// scrubbed from it
+		title, sent := inputTitle(input), prompt
+		if scrubMode(opts, req.Provider) != "off" {
+			found := make(map[string]int)
+			title, sent = scrubSecrets(title, found), scrubSecrets(sent, found)
+		}
+		if err := recordSessionTurn(conversation, title, sent, result.Content); err != nil {
+			notef("Warning: failed to save session %s: %v\n", conversation.Name, err)
+		} else {
+			startSessionTitle(config, req, conversation, opts)
+		}
+	}
+	return result.Content, err
+}
+
+// checkRequest applies the policies every request is subject to before it
+// is sent: offline mode, the budget, scrubbing, which redacts req's
+// messages in place, and moderation.
+func checkRequest(config *Config, req *chatRequest, opts *options) error {
+	if err := checkOffline(config, opts, req.Provider); err != nil {
+		return err
+	}
+	if err := checkBudget(config, req.Provider, opts.overBudget); err != nil {
+		return err
+	}
+
+	if mode := scrubMode(opts, req.Provider); mode != "off" {
+		if err := scrubMessages(req.Messages, mode); err != nil {
+			return err
+		}
+	}
+
+	if opts.moderate != "" {
+		if err := moderateMessages(req.Messages, opts.moderate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendSideRequest sends a request ai-cli makes on its own behalf, such as
+// summarizing a session's history, under the same policies as the user's
+// request, but without remembering it for "retry". Only follow-ups of the
+// answer, such as its continuation, are written to stream.
+func sendSideRequest(config *Config, req *chatRequest, opts *options, stream *streamTarget) (*completion, error) {
+	if err := checkRequest(config, req, opts); err != nil {
+		return nil, err
+	}
+	if err := waitForRateLimit(config.RateLimit, req.Provider, estimateMessageTokens(req.Messages)); err != nil {
+		return nil, err
 	}
+	return executeRequest(req, stream)
 }
 
-func executeOllama(model, prompt string) (string, error) {
-	installed, err := isModelInstalled(model)
+// sendRequest remembers req for "retry", unless opts.noRetry is set, and
+// sends it to its provider.
+func sendRequest(req *chatRequest, opts *options) (*completion, error) {
+	config, err := loadConfigOrDefault()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if err := checkRequest(config, req, opts); err != nil {
+		return nil, err
 	}
-	if !installed {
-		return "", fmt.Errorf("configured model '%s' is not installed. Please run 'set-model'", model)
+
+	if !opts.noRetry {
+		if err := saveLastRequest(req); err != nil {
+			notef("Warning: failed to save request for retry: %v\n", err)
+		}
 	}
 
-	cmd := exec.Command("ollama", "run", model, prompt)
-	cmd.Stderr = os.Stderr
+	if err := waitForRateLimit(config.RateLimit, req.Provider, estimateMessageTokens(req.Messages)); err != nil {
+		return nil, err
+	}
 
-	output, err := cmd.Output()
+	if err := checkCapabilities(config, req); err != nil {
+		return nil, err
+	}
+	if req.Provider == Ollama && !opts.batch && opts.streamWriter == nil {
+		warnModelSwap(config, req.Model)
+	}
+
+	var stream *streamTarget
+	switch {
+	case len(req.Tools) > 0:
+		// tool calls can't be streamed; the final answer is printed at once
+	case opts.streamWriter != nil:
+		stream = &streamTarget{w: opts.streamWriter, idleTimeout: streamIdleTimeout(config)}
+	case (config.Stream || opts.stream || opts.showThinking) && !opts.noStream && !opts.batch:
+		stream = &streamTarget{w: io.Discard, idleTimeout: streamIdleTimeout(config), thinking: newThinkingDisplay(opts.showThinking), meter: newStreamMeter(opts.meter || config.StreamMeter)}
+		stdout := stream.meter.terminal(os.Stdout)
+		switch {
+		case len(opts.outputFiles) > 0:
+			journal, err := openOutputJournal(opts.outputFiles[0], req, opts)
+			if err != nil {
+				notef("Warning: failed to create a file for the partial answer: %v\n", err)
+				break
+			}
+			stream.w = journal
+			opts.journal = journal
+		case opts.streamsCode(config):
+			code := newCodeExtractor(stdout)
+			defer func() {
+				code.Close()
+				if warning := code.warning(); warning != "" {
+					notef("Warning: %s\n", warning)
+				}
+			}()
+			stream.w = code
+			if !opts.raw {
+				normalizer := newOutputNormalizer(code)
+				defer normalizer.Close()
+				stream.w = normalizer
+			}
+			opts.streamed = true
+		case !opts.transformsOutput(config):
+			stream.w = stdout
+			if !opts.raw {
+				normalizer := newOutputNormalizer(stdout)
+				defer normalizer.Close()
+				stream.w = normalizer
+			}
+			opts.streamed = true
+		}
+		stream.w = stream.meter.counting(stream.w)
+	}
+
+	start := time.Now()
+	result, err := executeRequest(req, stream)
+	var unavailable *modelUnavailableError
+	if errors.As(err, &unavailable) && !opts.batch {
+		result, err = recoverUnavailableModel(req, unavailable, opts, stream)
+	}
+	if err == nil && len(result.ToolCalls) > 0 {
+		result, err = continueWithTools(req, result, opts)
+	}
+	if err == nil {
+		result, err = checkFinish(req, result, opts, stream)
+	}
+	if err == nil && !opts.allowEmpty {
+		result, err = checkEmptyAnswer(req, result, opts, stream)
+	}
+	if err == nil && req.Format != nil {
+		result, err = repairJSONAnswer(config, req, result)
+	}
+
+	// only answers for the user at the terminal are announced
+	if result != nil && !opts.batch && opts.streamWriter == nil {
+		elapsed := time.Since(start)
+		if threshold := notifyAfter(config); opts.notify || (threshold > 0 && elapsed >= threshold) {
+			notifyCompletion(result.Content, elapsed)
+		}
+	}
+	var truncated *streamTruncatedError
+	if err != nil && !errors.As(err, &truncated) {
+		opts.journal.abandon("the request failed")
+	}
+	return result, err
+}
+
+// executeRequest sends req to its provider and records the usage. Requests
+// are written to the audit log first, if one is configured. With a stream
+// target the answer is also written to it as it arrives; a stalled stream
+// returns the partial answer together with a streamTruncatedError. If a
+// daemon is running, the request is forwarded to it instead.
+func executeRequest(req *chatRequest, stream *streamTarget) (*completion, error) {
+	if stream != nil {
+		defer stream.meter.end()
+	}
+	if result, forwarded, err := executeViaDaemon(req, stream); forwarded {
+		return result, err
+	}
+
+	if err := auditRequest(req); err != nil {
+		return nil, err
+	}
+
+	var result *completion
+	var err error
+	switch {
+	case req.Provider == Ollama && stream != nil:
+		result, err = streamOllama(req, stream)
+	case req.Provider == Ollama:
+		result, err = executeOllama(req)
+	case req.Provider == OpenAI && useResponsesAPI():
+		result, err = executeOpenAIResponses(req, stream)
+	case (req.Provider == OpenAI || req.Provider == LMStudio) && stream != nil:
+		result, err = streamOpenAI(req, stream)
+	case req.Provider == OpenAI || req.Provider == LMStudio:
+		result, err = executeOpenAI(req)
+	case req.Provider.isPlugin():
+		result, err = executePlugin(req, stream)
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", req.Provider)
+	}
+	var truncated *streamTruncatedError
+	if errors.As(err, &truncated) {
+		return result, err
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to execute prompt: %w", err)
+		return nil, withProvider(req.Provider, err)
+	}
+
+	if err := recordUsage(req, result); err != nil {
+		notef("Warning: failed to record usage: %v\n", err)
+	}
+	if result.Content == "" && len(result.ToolCalls) == 0 && result.Refusal != "" {
+		return nil, apiError(req.Provider, 0, "the model refused to answer: %s", result.Refusal)
+	}
+	return result, nil
+}
+
+// buildRequest assembles the request for a prompt from the configuration
+// and the per-run options. It also returns a description of where the model
+// choice came from.
+func buildRequest(config *Config, opts *options, prompt string) (*chatRequest, string) {
+	req := &chatRequest{
+		Provider:    config.Provider,
+		Model:       config.Model,
+		Messages:    buildMessages(config, opts, prompt),
+		Temperature: opts.temperature,
+		MaxTokens:   opts.maxTokens,
+		Tools:       requestTools(config, opts),
+		Think:       opts.showThinking,
+		Tags:        requestTags(opts),
+		User:        requestUser(config),
+	}
+
+	// --model wins over --tier and template, role and task models, which
+	// win over routing rules and the global default
+	spec, source := "", "global default"
+	if opts.model() != "" {
+		spec, source = opts.model(), "--model flag"
+	} else if tpl, _ := resolveTemplate(config, opts.template); opts.template != "" && tpl.Model != "" && opts.tier == "" {
+		spec, source = tpl.Model, fmt.Sprintf("template %q", opts.template)
+	} else if role := config.Roles[opts.role]; opts.role != "" && role.Model != "" && opts.tier == "" {
+		spec, source = role.Model, fmt.Sprintf("role %q", opts.role)
+	} else if taskModel := config.TaskModels[opts.task]; opts.task != "" && taskModel != "" && opts.tier == "" {
+		spec, source = taskModel, fmt.Sprintf("task_models[%q]", opts.task)
+	} else if routed, reason := config.route(req.Messages, opts); routed != "" {
+		spec, source = routed, reason
 	}
+	if spec != "" {
+		if provider, model := config.resolveModel(spec); provider != "" {
+			req.Provider, req.Model = provider, model
+		} else {
+			req.Model = model
+		}
+	}
+
+	// a baked role already contains its system prompt
+	if role := config.Roles[opts.role]; role.BakedModel != "" && req.Provider == Ollama && req.Model == role.BakedFrom {
+		unbaked := *opts
+		unbaked.role = ""
+		req.Model, req.Messages = role.BakedModel, buildMessages(config, &unbaked, prompt)
+		source += fmt.Sprintf(", baked role %q", opts.role)
+	}
+
+	// local models tend to ramble on until their own limit
+	if req.Provider == Ollama && req.MaxTokens == 0 {
+		req.MaxTokens = ollamaLengthTokens[opts.length]
+	}
+	// Ollama's default window is far smaller than the one the history is
+	// trimmed to
+	if req.Provider == Ollama {
+		req.ContextWindow = config.ContextWindow
+	}
+	return req, source
+}
 
-	return string(output), nil
+// composePrompt joins the user's prompt and piped input into the user
+// message. The configured prefix and suffix wrap the whole message, so they
+// never end up inside piped data. Curated task prompts (e.g. "run") are not
+// wrapped.
+func composePrompt(config *Config, opts *options, input userInput) string {
+	wrap := !opts.noWrap && opts.task == ""
+
+	// files and pages come before the prompt, so repeated runs over the
+	// same context share a prefix the provider can cache
+	var parts []string
+	if wrap && config.PromptPrefix != "" {
+		parts = append(parts, config.PromptPrefix)
+	}
+	for _, source := range input.Sources {
+		parts = append(parts, fmt.Sprintf("--- Source: %s ---\n%s", source.Name, strings.TrimSpace(source.Content)))
+	}
+	if input.Prompt != "" {
+		parts = append(parts, input.Prompt)
+	}
+	if input.Piped != "" {
+		parts = append(parts, input.Piped)
+	}
+	if wrap && config.PromptSuffix != "" {
+		parts = append(parts, config.PromptSuffix)
+	}
+	return strings.Join(parts, "\n\n")
 }
 
-func executeOpenAI(model, prompt string) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
+// printDryRun shows what would be sent instead of sending it.
+func printDryRun(req *chatRequest, source string) {
+	fmt.Printf("Provider: %s\n", req.Provider)
+	fmt.Printf("Model:    %s (from %s)\n", req.Model, source)
+	if req.Temperature != nil {
+		fmt.Printf("Temperature: %g\n", *req.Temperature)
+	}
+	if req.MaxTokens > 0 {
+		fmt.Printf("Max tokens: %d\n", req.MaxTokens)
+	}
+	if req.Format != nil {
+		format := "JSON"
+		if req.Format.Schema != nil {
+			format = "JSON matching the --schema"
+		}
+		fmt.Printf("Format:   %s\n", format)
+	}
+	for _, msg := range req.Messages {
+		fmt.Printf("\n--- %s ---\n%s\n", msg.Role, msg.Content)
+	}
+}
+
+// buildMessages assembles the chat messages for a prompt. The configured
+// system prompt, the role, the length preset and the answer language are
+// combined in this order into a single system message.
+func buildMessages(config *Config, opts *options, prompt string) []OpenAIMessage {
+	var system []string
+	if config.SystemPrompt != "" {
+		system = append(system, config.SystemPrompt)
+	}
+	if role, ok := config.Roles[opts.role]; ok && opts.role != "" {
+		system = append(system, role.SystemPrompt)
+	}
+	if instruction := lengthInstruction(config, opts); instruction != "" {
+		system = append(system, instruction)
+	}
+	if language := effectiveLanguage(config, opts); language != "" {
+		system = append(system, fmt.Sprintf("Respond in %s.", language))
+	}
+
+	var messages []OpenAIMessage
+	if len(system) > 0 {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: strings.Join(system, "\n\n")})
+	}
+	return append(messages, OpenAIMessage{Role: "user", Content: prompt})
+}
+
+// addSystemInstruction adds an instruction to the system message, creating
+// one if there is none.
+func addSystemInstruction(messages []OpenAIMessage, instruction string) []OpenAIMessage {
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages[0].Content += "\n\n" + instruction
+		return messages
+	}
+	return append([]OpenAIMessage{{Role: "system", Content: instruction}}, messages...)
+}
+
+// effectiveLanguage returns the answer language, preferring the --lang flag
+// over the configured default.
+func effectiveLanguage(config *Config, opts *options) string {
+	language := config.Language
+	if opts != nil && opts.language != "" {
+		language = opts.language
+	}
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// defaultLengthPresets are the instructions of --short, --long and
+// --bullets unless length_presets overrides them.
+var defaultLengthPresets = map[string]string{
+	"short":   "Answer as briefly as possible: a sentence or two, no preamble, no repetition of the question.",
+	"long":    "Answer thoroughly: explain the reasoning, cover edge cases and give examples where they help.",
+	"bullets": "Answer as a concise bulleted list, one point per bullet, without an introduction or summary.",
+}
+
+// ollamaLengthTokens cap the answers of Ollama models with --short and
+// --long, in addition to the instruction, unless --max-tokens is given.
+var ollamaLengthTokens = map[string]int{
+	"short": 256,
+	"long":  2048,
+}
+
+// lengthInstruction returns the instruction of the --short, --long or
+// --bullets preset, or "" if none was given.
+func lengthInstruction(config *Config, opts *options) string {
+	if opts == nil || opts.length == "" {
+		return ""
+	}
+	if instruction := config.LengthPresets[opts.length]; instruction != "" {
+		return instruction
+	}
+	return defaultLengthPresets[opts.length]
+}
+
+// languageNames maps common ISO 639-1 codes to the language name used in the
+// system instruction.
+var languageNames = map[string]string{
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// openAIEndpoint returns the base URL and API key of a provider speaking
+// the OpenAI chat completions format. LM Studio needs no key.
+func openAIEndpoint(provider Provider) (baseURL, apiKey string, err error) {
+	if provider == LMStudio {
+		return lmStudioURL(), "", nil
+	}
+	apiKey = os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		return "", "", fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	return openAIBaseURL, apiKey, nil
+}
+
+func executeOpenAI(chatReq *chatRequest) (*completion, error) {
+	baseURL, apiKey, err := openAIEndpoint(chatReq.Provider)
+	if err != nil {
+		return nil, err
 	}
 
 	reqBody := OpenAIRequest{
-		Model: model,
-		Messages: []OpenAIMessage{
-			{Role: "user", Content: prompt},
-		},
+		Model:          chatReq.Model,
+		Messages:       chatReq.Messages,
+		Temperature:    chatReq.Temperature,
+		MaxTokens:      chatReq.MaxTokens,
+		Tools:          chatReq.Tools,
+		ResponseFormat: chatReq.Format.openAI(),
+		User:           chatReq.User,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, sendError(chatReq.Provider, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	var openAIResp OpenAIResponse
 	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if openAIResp.Error != nil {
-		return "", fmt.Errorf("OpenAI API error: %s", openAIResp.Error.Message)
+		if openAIResp.Error.Code == "model_not_found" {
+			return nil, &modelUnavailableError{provider: chatReq.Provider, model: chatReq.Model, reason: openAIResp.Error.Message}
+		}
+		return nil, apiError(chatReq.Provider, resp.StatusCode, "%s API error: %s", chatReq.Provider.displayName(), openAIResp.Error.Message)
 	}
 
 	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+		return nil, fmt.Errorf("no response from %s", chatReq.Provider.displayName())
 	}
 
-	return openAIResp.Choices[0].Message.Content, nil
+	return &completion{
+		Content:          openAIResp.Choices[0].Message.Content,
+		ToolCalls:        openAIResp.Choices[0].Message.ToolCalls,
+		Refusal:          openAIResp.Choices[0].Message.Refusal,
+		PromptTokens:     openAIResp.Usage.PromptTokens,
+		CachedTokens:     openAIResp.Usage.PromptTokensDetails.CachedTokens,
+		CompletionTokens: openAIResp.Usage.CompletionTokens,
+		FinishReason:     finishReason(openAIResp.Choices[0].FinishReason),
+		RawFinishReason:  openAIResp.Choices[0].FinishReason,
+	}, nil
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// markdownPageStyle keeps the pages of -o out.html readable without any
+// external resources.
+const markdownPageStyle = `body { max-width: 46em; margin: 2em auto; padding: 0 1em; font: 16px/1.5 system-ui, sans-serif; color: #222; }
+pre { background: #f4f4f4; padding: .8em; overflow-x: auto; }
+code { font: .9em ui-monospace, monospace; }
+blockquote { margin-left: 0; padding-left: 1em; border-left: 3px solid #ccc; color: #555; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: .3em .6em; }`
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	listItemPattern  = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(.*)$`)
+	rulePattern      = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	tableRulePattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+	inlineCodePattern = regexp.MustCompile("`([^`]+)`")
+	linkPattern       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+)
+
+// markdownPage renders the Markdown of an answer as a standalone HTML page.
+func markdownPage(markdown string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>ai-cli</title>\n<style>\n")
+	b.WriteString(markdownPageStyle)
+	b.WriteString("\n</style>\n</head>\n<body>\n")
+	b.WriteString(markdownHTML(markdown))
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// markdownHTML renders the Markdown models answer with: headings, code
+// blocks, lists, quotes, rules, tables and paragraphs with inline code,
+// emphasis and links. Anything else is kept as text.
+func markdownHTML(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + inlineHTML(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case isFenceLine([]byte(line)):
+			flush()
+			lang := strings.TrimSpace(strings.TrimLeft(trimmed, "`~"))
+			var code []string
+			for i++; i < len(lines) && !isFenceLine([]byte(lines[i])); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			b.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case headingPattern.MatchString(trimmed):
+			flush()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			tag := "h" + string(rune('0'+len(m[1])))
+			b.WriteString("<" + tag + ">" + inlineHTML(m[2]) + "</" + tag + ">\n")
+		case rulePattern.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				text := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(text, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n" + markdownHTML(strings.Join(quote, "\n")) + "</blockquote>\n")
+		case listItemPattern.MatchString(line):
+			flush()
+			tag := "ul"
+			if m := listItemPattern.FindStringSubmatch(line); m[1][0] >= '0' && m[1][0] <= '9' {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && listItemPattern.MatchString(lines[i]); i++ {
+				b.WriteString("<li>" + inlineHTML(listItemPattern.FindStringSubmatch(lines[i])[2]) + "</li>\n")
+			}
+			i--
+			b.WriteString("</" + tag + ">\n")
+		case strings.Contains(line, "|") && i+1 < len(lines) && tableRulePattern.MatchString(lines[i+1]):
+			flush()
+			b.WriteString("<table>\n<tr>")
+			for _, cell := range tableCells(line) {
+				b.WriteString("<th>" + inlineHTML(cell) + "</th>")
+			}
+			b.WriteString("</tr>\n")
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				b.WriteString("<tr>")
+				for _, cell := range tableCells(lines[i]) {
+					b.WriteString("<td>" + inlineHTML(cell) + "</td>")
+				}
+				b.WriteString("</tr>\n")
+			}
+			i--
+			b.WriteString("</table>\n")
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// inlineHTML escapes text and renders its inline code, links and emphasis.
+// Code spans are set aside first so nothing inside them is rendered.
+func inlineHTML(text string) string {
+	var spans []string
+	text = inlineCodePattern.ReplaceAllStringFunc(text, func(code string) string {
+		spans = append(spans, "<code>"+html.EscapeString(code[1:len(code)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+	text = html.EscapeString(text)
+	text = linkPattern.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = boldPattern.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = italicPattern.ReplaceAllString(text, "<em>$1$2</em>")
+	text = strings.ReplaceAll(text, "\n", "<br>\n")
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", span, 1)
+	}
+	return text
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mcpProtocolVersion = "2025-06-18"
+	mcpStartTimeout    = 10 * time.Second
+	// mcpToolSeparator joins server and tool names into the name the model
+	// sees, e.g. "github__search_issues".
+	mcpToolSeparator = "__"
+)
+
+// MCPServer is a Model Context Protocol server launched over stdio.
+type MCPServer struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// mcpTool is a tool offered by an MCP server.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// mcpClient talks JSON-RPC to one running MCP server.
+type mcpClient struct {
+	name  string
+	cmd   *exec.Cmd
+	tools []mcpTool
+
+	mu      sync.Mutex // guards stdin, nextID and pending
+	stdin   io.WriteCloser
+	nextID  int
+	pending map[int]chan mcpMessage
+}
+
+var (
+	mcpMu      sync.Mutex
+	mcpClients = make(map[string]*mcpClient)
+	mcpStarted = make(map[string]bool) // attempted, whether or not it came up
+)
+
+// startMCPServers starts the named MCP servers, once per process, and
+// returns those that are running. Servers that fail are reported and
+// skipped so the run can go on without them.
+func startMCPServers(config *Config, opts *options, names []string) map[string]*mcpClient {
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, name := range names {
+		if mcpStarted[name] {
+			continue
+		}
+		mcpStarted[name] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := startMCPServer(name, config.MCPServers[name], opts)
+			if err != nil {
+				notef("Warning: MCP server %s failed to start: %v\n", name, err)
+				return
+			}
+			mu.Lock()
+			mcpClients[name] = client
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return mcpClients
+}
+
+// startMCPServer launches a server, performs the initialization handshake
+// and lists its tools.
+func startMCPServer(name string, server MCPServer, opts *options) (*mcpClient, error) {
+	if server.Command == "" {
+		return nil, fmt.Errorf("no command configured")
+	}
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range server.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	if opts.verbose {
+		cmd.Stderr = os.Stderr
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &mcpClient{name: name, cmd: cmd, stdin: stdin, pending: make(map[int]chan mcpMessage)}
+	go c.readLoop(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpStartTimeout)
+	defer cancel()
+	init := map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]string{"name": "ai-cli", "version": "1.0"},
+	}
+	if err := c.call(ctx, "initialize", init, nil); err != nil {
+		c.close()
+		return nil, err
+	}
+	if err := c.send(mcpMessage{Method: "notifications/initialized"}); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	var list struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	if err := c.call(ctx, "tools/list", map[string]any{}, &list); err != nil {
+		c.close()
+		return nil, err
+	}
+	c.tools = list.Tools
+	return c, nil
+}
+
+// readLoop dispatches responses to the waiting calls. Requests from the
+// server are answered with "method not found", since ai-cli offers none.
+func (c *mcpClient) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg mcpMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil {
+			continue // notifications and log noise
+		}
+		if msg.Method != "" {
+			reply := mcpMessage{ID: msg.ID}
+			reply.Error = &struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}{-32601, "method not found"}
+			c.send(reply)
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	// the server exited: fail all waiting calls
+	c.mu.Lock()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *mcpClient) send(msg mcpMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// call sends a request and decodes its result into result, if not nil.
+func (c *mcpClient) call(ctx context.Context, method string, params, result any) error {
+	ch := make(chan mcpMessage, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(mcpMessage{ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("MCP server %s exited", c.name)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result != nil {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return fmt.Errorf("MCP server %s did not answer %s in time", c.name, method)
+	}
+}
+
+// callTool runs a tool and returns its text output.
+func (c *mcpClient) callTool(tool, arguments string) (string, error) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolCommandTimeout)
+	defer cancel()
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": tool, "arguments": args}, &result); err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", content.Type))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+func (c *mcpClient) close() {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+}
+
+// mcpToolDefinitions describes the tools of the given servers to the model.
+func mcpToolDefinitions(clients map[string]*mcpClient, servers []string) []toolDefinition {
+	var defs []toolDefinition
+	for _, name := range servers {
+		client, ok := clients[name]
+		if !ok {
+			continue
+		}
+		for _, tool := range client.tools {
+			schema := tool.InputSchema
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			defs = append(defs, toolDefinition{
+				Type: "function",
+				Function: toolFunction{
+					Name:        name + mcpToolSeparator + tool.Name,
+					Description: tool.Description,
+					Parameters:  schema,
+				},
+			})
+		}
+	}
+	return defs
+}
+
+// runMCPToolCall runs a "<server>__<tool>" call. It reports false if the
+// name doesn't belong to a running MCP server.
+func runMCPToolCall(call toolCall) (string, bool, error) {
+	server, tool, ok := strings.Cut(call.Function.Name, mcpToolSeparator)
+	if !ok {
+		return "", false, nil
+	}
+	mcpMu.Lock()
+	client, ok := mcpClients[server]
+	mcpMu.Unlock()
+	if !ok || !slices.ContainsFunc(client.tools, func(t mcpTool) bool { return t.Name == tool }) {
+		return "", false, nil
+	}
+	notef("Tool: %s %s\n", call.Function.Name, call.Function.Arguments)
+	output, err := client.callTool(tool, call.Function.Arguments)
+	return output, true, err
+}
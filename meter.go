@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// meterInterval is how often the meter is redrawn at most.
+	meterInterval = 100 * time.Millisecond
+	// meterWindow is the span the current rate is measured over.
+	meterWindow = 2 * time.Second
+	// meterMinWidth is the least room the meter needs; with less it is not
+	// drawn rather than cut to nothing.
+	meterMinWidth = 8
+)
+
+// streamMeter shows the tokens received and the current tokens per second
+// on stderr while an answer streams, with --meter. Every piece the
+// provider streams counts as a token, which holds for Ollama and nearly so
+// for OpenAI; --stats has the exact numbers afterwards. If the answer goes
+// to the same terminal, the meter sits after the last line of the answer
+// and is erased before more of it is written, otherwise it has a line of
+// its own. It is removed when the stream ends, so it never stays on screen.
+type streamMeter struct {
+	inline bool // the answer is printed on the terminal too
+	start  time.Time
+	tokens int
+	recent []time.Time // when the tokens within meterWindow arrived
+	drawn  int         // the width of the meter on screen, 0 if none
+	last   time.Time   // when it was drawn
+	column int         // where the answer's cursor is, for inline
+}
+
+// newStreamMeter returns a meter if enabled and stderr is a terminal, and
+// nil otherwise; all methods of a nil meter do nothing.
+func newStreamMeter(enabled bool) *streamMeter {
+	if !enabled || !isTerminal(os.Stderr) {
+		return nil
+	}
+	return &streamMeter{inline: isTerminal(os.Stdout)}
+}
+
+// counting returns w counting every write as a token.
+func (m *streamMeter) counting(w io.Writer) io.Writer {
+	if m == nil {
+		return w
+	}
+	return meterCounter{m, w}
+}
+
+// terminal returns stdout writing around the meter, for answers printed
+// on the terminal.
+func (m *streamMeter) terminal(stdout io.Writer) io.Writer {
+	if m == nil || !m.inline {
+		return stdout
+	}
+	return meterTerminal{m, stdout}
+}
+
+type meterCounter struct {
+	m *streamMeter
+	w io.Writer
+}
+
+func (c meterCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.m.count()
+	return n, err
+}
+
+type meterTerminal struct {
+	m *streamMeter
+	w io.Writer
+}
+
+func (t meterTerminal) Write(p []byte) (int, error) {
+	t.m.clear()
+	t.m.advance(p)
+	return t.w.Write(p)
+}
+
+func (m *streamMeter) count() {
+	now := time.Now()
+	if m.tokens == 0 {
+		m.start = now
+	}
+	m.tokens++
+	m.recent = append(m.recent, now)
+	for len(m.recent) > 0 && now.Sub(m.recent[0]) > meterWindow {
+		m.recent = m.recent[1:]
+	}
+	// a rate needs two tokens
+	if m.tokens > 1 && now.Sub(m.last) >= meterInterval {
+		m.draw(now)
+	}
+}
+
+// rate returns the tokens per second within the last meterWindow, or since
+// the first token if that was more recent.
+func (m *streamMeter) rate(now time.Time) float64 {
+	span := min(now.Sub(m.start), meterWindow)
+	if span <= 0 {
+		return 0
+	}
+	return float64(len(m.recent)) / span.Seconds()
+}
+
+func (m *streamMeter) draw(now time.Time) {
+	m.clear()
+	text := fmt.Sprintf(" %d tok · %.1f tok/s", m.tokens, m.rate(now))
+	room := terminalWidth(os.Stderr) - 1 // the last column would wrap
+	if m.inline {
+		room -= m.column
+	}
+	if width := utf8.RuneCountInString(text); width > room {
+		// without room for both, the rate is kept
+		text = fmt.Sprintf(" %.1f tok/s", m.rate(now))
+	}
+	width := utf8.RuneCountInString(text)
+	if width > room || room < meterMinWidth {
+		return
+	}
+
+	if m.inline {
+		// drawn after the answer, with the cursor put back at its end
+		fmt.Fprintf(os.Stderr, "%s\033[%dD", styled(os.Stderr, styleDim, text), width)
+	} else {
+		fmt.Fprint(os.Stderr, "\r"+styled(os.Stderr, styleDim, strings.TrimPrefix(text, " ")))
+	}
+	m.drawn, m.last = width, now
+}
+
+// clear erases the meter, leaving the answer as it was.
+func (m *streamMeter) clear() {
+	if m == nil || m.drawn == 0 {
+		return
+	}
+	if m.inline {
+		fmt.Fprint(os.Stderr, "\033[K")
+	} else {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	m.drawn = 0
+}
+
+// advance follows the cursor through text written to the terminal. All
+// non-ASCII characters are counted as two columns, so the meter rather gets
+// too little room than too much.
+func (m *streamMeter) advance(p []byte) {
+	width := terminalWidth(os.Stdout)
+	for _, r := range string(p) {
+		switch {
+		case r == '\n' || r == '\r':
+			m.column = 0
+		case r == '\t':
+			m.column += 8 - m.column%8
+		case r < utf8.RuneSelf:
+			m.column++
+		default:
+			m.column += 2
+		}
+		if width > 0 && m.column >= width {
+			m.column %= width
+		}
+	}
+}
+
+// end removes the meter when the stream is over.
+func (m *streamMeter) end() {
+	if m == nil {
+		return
+	}
+	m.clear()
+	m.tokens, m.recent, m.last = 0, nil, time.Time{}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// modelDetailsTimeout bounds how long the pickers wait for model details.
+const modelDetailsTimeout = 3 * time.Second
+
+// modelDetails is the metadata shown next to a model. Empty fields are
+// unknown.
+type modelDetails struct {
+	ParameterSize string `json:"parameter_size,omitempty"`
+	Quantization  string `json:"quantization,omitempty"`
+	DiskSize      string `json:"disk_size,omitempty"`
+	ContextWindow int    `json:"context_window,omitempty"`
+	// Capabilities are the known features of the model.
+	Capabilities ModelCapabilities `json:"capabilities"`
+}
+
+// summary formats the known details for the picker.
+func (d modelDetails) summary() string {
+	var parts []string
+	for _, part := range []string{d.ParameterSize, d.Quantization, d.DiskSize} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if d.ContextWindow > 0 {
+		parts = append(parts, formatContextWindow(d.ContextWindow)+" context")
+	}
+	return strings.Join(parts, "  ")
+}
+
+func formatContextWindow(tokens int) string {
+	if tokens >= 1000 {
+		return fmt.Sprintf("%dk", tokens/1000)
+	}
+	return fmt.Sprint(tokens)
+}
+
+// fetchModelDetails gathers details for all options. Ollama models are
+// queried in parallel; whatever hasn't arrived within modelDetailsTimeout is
+// left out rather than blocking the picker.
+func fetchModelDetails(options []ModelOption) map[ModelOption]modelDetails {
+	details := make(map[ModelOption]modelDetails)
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		config = &Config{}
+	}
+
+	var sizes map[string]string
+	for _, opt := range options {
+		if opt.Provider == Ollama {
+			sizes = ollamaModelSizes()
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+
+	for _, opt := range options {
+		caps, _ := knownCapabilities(config, opt.Provider, opt.Model)
+		details[opt] = modelDetails{DiskSize: sizes[opt.Model], ContextWindow: caps.ContextWindow, Capabilities: caps}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, opt := range options {
+		if opt.Provider != Ollama {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			show, err := fetchOllamaShow(ctx, opt.Model)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			d := details[opt]
+			d.ParameterSize = show.Details.ParameterSize
+			d.Quantization = show.Details.QuantizationLevel
+			d.Capabilities.applyOllamaShow(show)
+			d.Capabilities.applyConfig(config, opt.Provider, opt.Model)
+			d.ContextWindow = d.Capabilities.ContextWindow
+			details[opt] = d
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result := make(map[ModelOption]modelDetails, len(details))
+	for opt, d := range details {
+		result[opt] = d
+	}
+	return result
+}
+
+// ollamaModelSizes returns the disk size of each installed Ollama model.
+func ollamaModelSizes() map[string]string {
+	sizes := make(map[string]string)
+	models, err := listOllamaModels()
+	if err != nil {
+		return sizes
+	}
+	for _, m := range models {
+		sizes[m.Name] = m.Size
+	}
+	return sizes
+}
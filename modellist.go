@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// providerListTimeout bounds how long listing the models of one
+	// provider may take.
+	providerListTimeout = 5 * time.Second
+	// modelListTTL is how long the listed models are reused, so repeated
+	// set-model runs don't ask the providers again. An older list is still
+	// used up to modelListMaxAge, but refreshed in the background.
+	modelListTTL    = 10 * time.Minute
+	modelListMaxAge = time.Hour
+)
+
+var errListTimeout = errors.New("timeout")
+
+// modelListCache is the cached result of getAllAvailableModels. Key tells
+// which API keys and Ollama hosts it was listed with.
+type modelListCache struct {
+	Key    string              `json:"key"`
+	Time   time.Time           `json:"time"`
+	Models map[string][]string `json:"models"`
+}
+
+// getAllAvailableModels lists the models of every provider, asking them
+// concurrently. Providers that fail or take longer than
+// providerListTimeout are returned in unavailable with the reason instead.
+// A complete result is cached, see modelListTTL; refresh ignores the cache.
+func getAllAvailableModels(refresh bool) (available map[string][]string, unavailable map[string]string, err error) {
+	key := modelListKey()
+	if !refresh {
+		if cached, listed, ok := loadModelList(key); ok {
+			if time.Since(listed) > modelListTTL {
+				// picked up by the next run if this one ends first
+				go getAllAvailableModels(true)
+			}
+			return cached, nil, nil
+		}
+	}
+
+	listers := make(map[string]func() ([]string, error))
+	if isOllamaInstalled() || hasOllamaHosts() {
+		listers["ollama"] = getInstalledModels
+	}
+	// LM Studio is only found by asking its server, see lmstudio.go
+	listers["lmstudio"] = listLMStudioModels
+	if hasOpenAIToken() {
+		listers["openai"] = func() ([]string, error) {
+			noteOutdatedCatalog()
+			return getOpenAIModels(), nil
+		}
+	}
+	for _, plugin := range pluginNames() {
+		listers[string(plugin)] = func() ([]string, error) { return listPluginModels(plugin) }
+	}
+
+	available = make(map[string][]string)
+	unavailable = make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for provider, list := range listers {
+		wg.Go(func() {
+			models, err := listWithTimeout(list)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				unavailable[provider] = err.Error()
+			case len(models) > 0:
+				available[provider] = models
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(unavailable) == 0 {
+		if err := saveModelList(key, available); err != nil {
+			notef("Warning: failed to cache the model list: %v\n", err)
+		}
+	}
+	return available, unavailable, nil
+}
+
+// listWithTimeout runs list, giving up after providerListTimeout.
+func listWithTimeout(list func() ([]string, error)) ([]string, error) {
+	type result struct {
+		models []string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		models, err := list()
+		done <- result{models, err}
+	}()
+	select {
+	case r := <-done:
+		return r.models, r.err
+	case <-time.After(providerListTimeout):
+		return nil, errListTimeout
+	}
+}
+
+// printUnavailableProviders lists the providers whose models couldn't be
+// listed, e.g. "[ollama] (unavailable: timeout)".
+func printUnavailableProviders(unavailable map[string]string) {
+	for _, provider := range slices.Sorted(maps.Keys(unavailable)) {
+		fmt.Printf("[%s] (unavailable: %s)\n", provider, unavailable[provider])
+	}
+}
+
+// modelListKey identifies what the listed models depend on: which API keys
+// are set and which Ollama instances, LM Studio server and plugins are used.
+func modelListKey() string {
+	var hosts []string
+	for _, host := range ollamaHosts() {
+		hosts = append(hosts, host.URL)
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%v %v %v %v %v", hasOpenAIToken(), isOllamaInstalled(), hosts, lmStudioURL(), providerPlugins()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func modelListCachePath() string {
+	return filepath.Join(getStateDir(), "cache", "models.json")
+}
+
+// loadModelList returns the cached model list and when it was listed, if
+// it is for key and not older than modelListMaxAge.
+func loadModelList(key string) (map[string][]string, time.Time, bool) {
+	if stateDisabled() {
+		return nil, time.Time{}, false
+	}
+	data, err := os.ReadFile(modelListCachePath())
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	var cache modelListCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Key != key || time.Since(cache.Time) > modelListMaxAge {
+		return nil, time.Time{}, false
+	}
+	return cache.Models, cache.Time, true
+}
+
+func saveModelList(key string, models map[string][]string) error {
+	if stateDisabled() {
+		return nil
+	}
+	data, err := json.Marshal(modelListCache{Key: key, Time: time.Now(), Models: models})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(modelListCachePath(), data, 0600)
+}
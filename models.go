@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// modelsCommand lists the available models together with their aliases.
+func modelsCommand(args []string) error {
+	if len(args) == 1 && args[0] == "--loaded" {
+		return loadedModelsCommand()
+	}
+	refresh := len(args) == 1 && args[0] == "--refresh"
+	if len(args) > 0 && !refresh {
+		return fmt.Errorf("usage: ai-cli models [--loaded|--refresh]")
+	}
+
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	available, unavailable, err := getAllAvailableModels(refresh)
+	if err != nil {
+		return err
+	}
+
+	options := modelOptions(available)
+	details := fetchModelDetails(options)
+	hosts := ollamaModelHosts()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tPROVIDER\tMODEL\tPARAMS\tQUANT\tSIZE\tCONTEXT\tSUPPORTS\tALIASES")
+	for _, opt := range options {
+		current := ""
+		if config.Provider == opt.Provider && config.Model == opt.Model {
+			current = "*"
+		}
+		d := details[opt]
+		window := ""
+		if d.ContextWindow > 0 {
+			window = formatContextWindow(d.ContextWindow)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", current, opt.Provider, modelLabel(opt, hosts),
+			orDash(d.ParameterSize), orDash(d.Quantization), orDash(d.DiskSize), orDash(window), orDash(d.Capabilities.summary()),
+			orDash(strings.Join(config.aliasesFor(opt.Provider, opt.Model), ", ")))
+	}
+	for _, provider := range slices.Sorted(maps.Keys(unavailable)) {
+		fmt.Fprintf(w, "\t%s\t(unavailable: %s)\n", provider, unavailable[provider])
+	}
+	w.Flush()
+	if refresh {
+		printNewerOpenAIModels()
+	}
+
+	if len(config.Aliases) > 0 {
+		var names []string
+		for name := range config.Aliases {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		fmt.Println("\nAliases:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, name := range names {
+			provider, model := config.resolveModel(name)
+			fmt.Fprintf(w, "  %s\t-> %s/%s\n", name, provider, model)
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
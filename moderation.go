@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const moderationModel = "omni-moderation-latest"
+
+type ModerationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type ModerationResponse struct {
+	Results []ModerationResult `json:"results"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// flaggedCategories returns the names of all flagged categories, sorted.
+func (r *ModerationResult) flaggedCategories() []string {
+	var flagged []string
+	for category, hit := range r.Categories {
+		if hit {
+			flagged = append(flagged, category)
+		}
+	}
+	slices.Sort(flagged)
+	return flagged
+}
+
+// moderateMessages checks the assembled messages with the OpenAI moderation
+// endpoint. In "block" mode a flagged prompt aborts with
+// exitModerationFlagged, in "warn" mode only a warning is printed.
+func moderateMessages(messages []OpenAIMessage, mode string) error {
+	var parts []string
+	for _, msg := range messages {
+		parts = append(parts, msg.Content)
+	}
+	input := strings.Join(parts, "\n\n")
+
+	result, err := loadModerationVerdict(input)
+	if err != nil {
+		result, err = fetchModeration(input)
+		if err != nil {
+			return err
+		}
+		if err := saveModerationVerdict(input, result); err != nil {
+			notef("Warning: failed to cache moderation verdict: %v\n", err)
+		}
+	}
+
+	if !result.Flagged {
+		return nil
+	}
+
+	var report []string
+	for _, category := range result.flaggedCategories() {
+		report = append(report, fmt.Sprintf("%s (%.2f)", category, result.CategoryScores[category]))
+	}
+
+	if mode == "warn" {
+		notef("Warning: prompt flagged by moderation: %s\n", strings.Join(report, ", "))
+		return nil
+	}
+	return &exitError{
+		code: exitModerationFlagged,
+		err:  fmt.Errorf("prompt flagged by moderation: %s (use --moderate=warn to send anyway)", strings.Join(report, ", ")),
+	}
+}
+
+func fetchModeration(input string) (*ModerationResult, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("--moderate requires the OPENAI_API_KEY environment variable")
+	}
+
+	jsonData, err := json.Marshal(ModerationRequest{Model: moderationModel, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal moderation request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", openAIBaseURL+"/moderations", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create moderation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send moderation request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation response: %w", err)
+	}
+
+	var modResp ModerationResponse
+	if err := json.Unmarshal(body, &modResp); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation response: %w", err)
+	}
+	if modResp.Error != nil {
+		return nil, fmt.Errorf("OpenAI moderation error: %s", modResp.Error.Message)
+	}
+	if len(modResp.Results) == 0 {
+		return nil, fmt.Errorf("no result from OpenAI moderation")
+	}
+
+	return &modResp.Results[0], nil
+}
+
+// moderationCachePath returns the cache file for the verdict on input. The
+// file name is the SHA-256 of the input, so the prompt itself is not stored.
+func moderationCachePath(input string) string {
+	sum := sha256.Sum256([]byte(moderationModel + "\x00" + input))
+	return filepath.Join(getStateDir(), "cache", "moderation", hex.EncodeToString(sum[:])+".json")
+}
+
+func loadModerationVerdict(input string) (*ModerationResult, error) {
+	if stateDisabled() {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(moderationCachePath(input))
+	if err != nil {
+		return nil, err
+	}
+
+	var result ModerationResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func saveModerationVerdict(input string, result *ModerationResult) error {
+	if stateDisabled() {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(moderationCachePath(input), data, 0600)
+}
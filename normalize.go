@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// outputNormalizer cleans up an answer on its way to the output: CRLF
+// becomes LF, trailing whitespace is stripped from lines outside of code
+// blocks and the answer ends with exactly one newline. Since it works on
+// the bytes as they arrive, a streamed answer is cleaned up the same way as
+// a complete one; only trailing whitespace and blank lines are held back
+// until it is clear they don't end the answer.
+type outputNormalizer struct {
+	w        io.Writer
+	line     []byte // the visible part of the current line so far
+	space    []byte // whitespace not written yet
+	newlines int    // line breaks not written yet
+	inFence  bool
+	written  bool
+}
+
+func newOutputNormalizer(w io.Writer) *outputNormalizer {
+	return &outputNormalizer{w: w}
+}
+
+func (n *outputNormalizer) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	for _, c := range p {
+		switch c {
+		case ' ', '\t', '\r':
+			n.space = append(n.space, c)
+		case '\n':
+			fence := isFenceLine(n.line)
+			// whitespace in code blocks may matter, e.g. in Markdown or diffs
+			if space := bytes.TrimSuffix(n.space, []byte("\r")); n.inFence && !fence && len(space) > 0 {
+				n.flushPending(&out)
+				out.Write(space)
+			}
+			n.space = n.space[:0]
+			if fence {
+				n.inFence = !n.inFence
+			}
+			n.line = n.line[:0]
+			n.newlines++
+		default:
+			n.flushPending(&out)
+			out.Write(n.space)
+			n.space = n.space[:0]
+			out.WriteByte(c)
+			n.line = append(n.line, c)
+			n.written = true
+		}
+	}
+	if _, err := n.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flushPending writes the held back line breaks, once more content follows.
+func (n *outputNormalizer) flushPending(out *bytes.Buffer) {
+	if n.written {
+		out.WriteString(strings.Repeat("\n", n.newlines))
+	}
+	n.newlines = 0
+}
+
+// Close ends the answer with a single newline, dropping trailing
+// whitespace and blank lines.
+func (n *outputNormalizer) Close() error {
+	if !n.written {
+		return nil
+	}
+	_, err := io.WriteString(n.w, "\n")
+	return err
+}
+
+// isFenceLine reports whether line opens or closes a Markdown code block.
+func isFenceLine(line []byte) bool {
+	line = bytes.TrimLeft(line, " \t")
+	return bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~"))
+}
+
+// normalizeOutput applies the outputNormalizer to a complete answer.
+func normalizeOutput(output string) string {
+	var b strings.Builder
+	n := newOutputNormalizer(&b)
+	n.Write([]byte(output))
+	n.Close()
+	return b.String()
+}
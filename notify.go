@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 5 * time.Second
+
+// notifyAfter returns the configured notify_after threshold, or 0 if none
+// is set.
+func notifyAfter(config *Config) time.Duration {
+	if config.NotifyAfter == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(config.NotifyAfter)
+	if err != nil || d <= 0 {
+		notef("Warning: invalid notify_after value: %s (use e.g. 30s)\n", config.NotifyAfter)
+		return 0
+	}
+	return d
+}
+
+// notifyCompletion rings the terminal bell and shows a desktop notification
+// with the first line of the answer. Missing notification tools are
+// ignored.
+func notifyCompletion(answer string, elapsed time.Duration) {
+	if isTerminal(os.Stderr) {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+
+	title := fmt.Sprintf("ai-cli finished after %s", elapsed.Round(time.Second))
+	body, _, _ := strings.Cut(strings.TrimSpace(answer), "\n")
+	body, _ = truncateText(body, 200)
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run",
+			title, body)
+	case "windows":
+		script := `param($title, $body)
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($title)) | Out-Null
+$text.Item(1).AppendChild($xml.CreateTextNode($body)) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('ai-cli').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", "& {"+script+"}", title, body)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=ai-cli", title, body)
+	}
+	cmd.Run() // no notification tool: the bell has to do
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// isOffline reports whether offline mode is enabled by --offline or the
+// "offline" config setting.
+func isOffline(config *Config, opts *options) bool {
+	return opts.offline || config.Offline
+}
+
+// checkOffline fails if offline mode is enabled and provider would send data
+// off the machine. Only an Ollama host or LM Studio server on this machine
+// or the local network is allowed.
+func checkOffline(config *Config, opts *options, provider Provider) error {
+	if !isOffline(config, opts) {
+		return nil
+	}
+	if !provider.isLocal() {
+		return fmt.Errorf("offline mode: provider %s not allowed", provider)
+	}
+	if opts.moderate != "" {
+		return fmt.Errorf("offline mode: --moderate not allowed (it uses the OpenAI API)")
+	}
+	if provider == LMStudio {
+		if !isLocalHost(lmStudioURL()) {
+			return fmt.Errorf("offline mode: LM Studio server %s is not on the local network", lmStudioURL())
+		}
+		return nil
+	}
+	for _, host := range ollamaHosts() {
+		if !isLocalHost(host.URL) {
+			return fmt.Errorf("offline mode: Ollama host %s is not on the local network", host.URL)
+		}
+	}
+	return nil
+}
+
+// isLocalHost reports whether rawURL points to this machine or a private
+// network address.
+func isLocalHost(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil || len(ips) == 0 {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified() {
+			return false
+		}
+	}
+	return true
+}
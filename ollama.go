@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultOllamaHost = "http://127.0.0.1:11434"
+
+type OllamaChatRequest struct {
+	Model    string           `json:"model"`
+	Messages []OllamaMessage  `json:"messages"`
+	Stream   bool             `json:"stream"`
+	Options  *OllamaOptions   `json:"options,omitempty"`
+	Tools    []toolDefinition `json:"tools,omitempty"`
+	Format   any              `json:"format,omitempty"` // "json" or a JSON schema
+	// Think separates the reasoning of thinking models from the answer.
+	Think bool `json:"think,omitempty"`
+}
+
+// OllamaMessage differs from OpenAIMessage in how tool calls are encoded:
+// arguments are a JSON object instead of a string, and tool results name
+// the tool instead of the call.
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	// Thinking is the reasoning of a thinking model, see Think.
+	Thinking string `json:"thinking,omitempty"`
+}
+
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"` // maximum tokens to generate
+	NumCtx      int      `json:"num_ctx,omitempty"`     // context window in tokens
+}
+
+// ollamaOptions returns the model options of req, or nil if it sets none.
+func ollamaOptions(req *chatRequest) *OllamaOptions {
+	if req.Temperature == nil && req.MaxTokens == 0 && req.ContextWindow == 0 {
+		return nil
+	}
+	return &OllamaOptions{Temperature: req.Temperature, NumPredict: req.MaxTokens, NumCtx: req.ContextWindow}
+}
+
+type OllamaChatResponse struct {
+	Message         OllamaMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	EvalDuration    int64         `json:"eval_duration"` // nanoseconds
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// getOllamaHost returns the base URL of the Ollama server, honoring
+// OLLAMA_HOST like the ollama CLI does.
+func getOllamaHost() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return defaultOllamaHost
+	}
+	return ollamaBaseURL(host)
+}
+
+func executeOllama(chatReq *chatRequest) (*completion, error) {
+	model := chatReq.Model
+	installed, err := isModelInstalled(model)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, &modelUnavailableError{provider: Ollama, model: model, reason: "not installed"}
+	}
+
+	reqBody := OllamaChatRequest{
+		Model:    model,
+		Messages: toOllamaMessages(chatReq.Messages),
+		Tools:    chatReq.Tools,
+		Format:   chatReq.Format.ollama(),
+		Think:    chatReq.Think,
+	}
+	reqBody.Options = ollamaOptions(chatReq)
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := postOllama(context.Background(), model, "/api/chat", jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var ollamaResp OllamaChatResponse
+	if err := json.Unmarshal(body, &ollamaResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if ollamaResp.Error != "" {
+		return nil, apiError(Ollama, resp.StatusCode, "ollama error: %s", ollamaResp.Error)
+	}
+
+	return &completion{
+		Content:          ollamaResp.Message.Content,
+		PromptTokens:     ollamaResp.PromptEvalCount,
+		CompletionTokens: ollamaResp.EvalCount,
+		EvalDuration:     time.Duration(ollamaResp.EvalDuration),
+		FinishReason:     finishReason(ollamaResp.DoneReason),
+		RawFinishReason:  ollamaResp.DoneReason,
+		ToolCalls:        fromOllamaToolCalls(ollamaResp.Message.ToolCalls),
+	}, nil
+}
+
+// toOllamaMessages converts messages to Ollama's encoding of tool calls.
+func toOllamaMessages(messages []OpenAIMessage) []OllamaMessage {
+	toolNames := make(map[string]string) // call ID -> tool name
+	result := make([]OllamaMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = OllamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, call := range msg.ToolCalls {
+			var oc OllamaToolCall
+			oc.Function.Name = call.Function.Name
+			oc.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(oc.Function.Arguments) {
+				oc.Function.Arguments = json.RawMessage("{}")
+			}
+			result[i].ToolCalls = append(result[i].ToolCalls, oc)
+			toolNames[call.ID] = call.Function.Name
+		}
+		if msg.ToolCallID != "" {
+			result[i].ToolName = toolNames[msg.ToolCallID]
+		}
+	}
+	return result
+}
+
+// fromOllamaToolCalls converts Ollama's tool calls, which have no IDs, to
+// the OpenAI encoding.
+func fromOllamaToolCalls(calls []OllamaToolCall) []toolCall {
+	var result []toolCall
+	for i, call := range calls {
+		tc := toolCall{ID: fmt.Sprintf("call_%d", i), Type: "function"}
+		tc.Function.Name = call.Function.Name
+		tc.Function.Arguments = string(call.Function.Arguments)
+		result = append(result, tc)
+	}
+	return result
+}
+
+type OllamaShowResponse struct {
+	Capabilities []string `json:"capabilities"`
+	Details      struct {
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+	ModelInfo map[string]any `json:"model_info"`
+}
+
+// contextLength returns the model's context length from the
+// "<architecture>.context_length" entry of its model info, or 0.
+func (r *OllamaShowResponse) contextLength() int {
+	for key, value := range r.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			if n, ok := value.(float64); ok {
+				return int(n)
+			}
+		}
+	}
+	return 0
+}
+
+// fetchOllamaShow queries the details of an installed model.
+func fetchOllamaShow(ctx context.Context, model string) (*OllamaShowResponse, error) {
+	jsonData, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaHostFor(model)+"/api/show", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama show %s: %s", model, resp.Status)
+	}
+
+	var show OllamaShowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return nil, err
+	}
+	return &show, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOllamaOptions(t *testing.T) {
+	temperature := 0.2
+	tests := []struct {
+		name string
+		req  chatRequest
+		want *OllamaOptions
+	}{
+		{name: "none", req: chatRequest{}, want: nil},
+		{name: "max tokens", req: chatRequest{MaxTokens: 100}, want: &OllamaOptions{NumPredict: 100}},
+		{name: "temperature", req: chatRequest{Temperature: &temperature}, want: &OllamaOptions{Temperature: &temperature}},
+		{name: "context window", req: chatRequest{ContextWindow: 32768}, want: &OllamaOptions{NumCtx: 32768}},
+		{
+			name: "all",
+			req:  chatRequest{Temperature: &temperature, MaxTokens: 256, ContextWindow: 8192},
+			want: &OllamaOptions{Temperature: &temperature, NumPredict: 256, NumCtx: 8192},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ollamaOptions(&tt.req)
+			if (got == nil) != (tt.want == nil) || got != nil && (got.Temperature != tt.want.Temperature || got.NumPredict != tt.want.NumPredict || got.NumCtx != tt.want.NumCtx) {
+				t.Errorf("ollamaOptions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRequestOllamaOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		name              string
+		provider          Provider
+		contextWindow     int
+		args              []string
+		wantMaxTokens     int
+		wantTemperature   float64 // -1: not set
+		wantContextWindow int
+	}{
+		{name: "defaults", provider: Ollama, args: []string{"hi"}, wantTemperature: -1},
+		{name: "max tokens", provider: Ollama, args: []string{"--max-tokens", "500", "hi"}, wantMaxTokens: 500, wantTemperature: -1},
+		{name: "temperature", provider: Ollama, args: []string{"--temperature", "0.7", "hi"}, wantTemperature: 0.7},
+		{name: "short", provider: Ollama, args: []string{"--short", "hi"}, wantMaxTokens: 256, wantTemperature: -1},
+		{name: "long", provider: Ollama, args: []string{"--long", "hi"}, wantMaxTokens: 2048, wantTemperature: -1},
+		{name: "max tokens wins over short", provider: Ollama, args: []string{"--short", "--max-tokens", "50", "hi"}, wantMaxTokens: 50, wantTemperature: -1},
+		{name: "context window", provider: Ollama, contextWindow: 16384, args: []string{"hi"}, wantTemperature: -1, wantContextWindow: 16384},
+		{name: "no cap for OpenAI", provider: OpenAI, contextWindow: 16384, args: []string{"--short", "hi"}, wantTemperature: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, args, err := parseOptions(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := &Config{Provider: tt.provider, Model: "llama3.2", ContextWindow: tt.contextWindow}
+			req, _ := buildRequest(config, opts, args[0])
+
+			temperature := -1.0
+			if req.Temperature != nil {
+				temperature = *req.Temperature
+			}
+			if req.MaxTokens != tt.wantMaxTokens || temperature != tt.wantTemperature || req.ContextWindow != tt.wantContextWindow {
+				t.Errorf("max tokens = %d, temperature = %v, context window = %d; want %d, %v, %d",
+					req.MaxTokens, temperature, req.ContextWindow, tt.wantMaxTokens, tt.wantTemperature, tt.wantContextWindow)
+			}
+		})
+	}
+}
+
+func TestOllamaChatPayloadOptions(t *testing.T) {
+	// "ollama list" reports the model as installed
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho 'NAME ID SIZE MODIFIED'\necho 'llama3.2:latest a80c4f17acd5 2.0 GB 2 days ago'\n"
+	if err := os.WriteFile(filepath.Join(bin, "ollama"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+
+	var payloads []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		payloads = append(payloads, payload)
+		if payload["stream"] == true {
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"ok"},"done":false}`)
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`)
+	}))
+	defer srv.Close()
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	temperature := 0.3
+	req := &chatRequest{
+		Provider: Ollama, Model: "llama3.2:latest", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Temperature: &temperature, MaxTokens: 256, ContextWindow: 16384,
+	}
+	if _, err := executeOllama(req); err != nil {
+		t.Fatalf("executeOllama: %v", err)
+	}
+	if _, err := streamOllama(req, &streamTarget{w: io.Discard}); err != nil {
+		t.Fatalf("streamOllama: %v", err)
+	}
+
+	want := map[string]float64{"temperature": 0.3, "num_predict": 256, "num_ctx": 16384}
+	if len(payloads) != 2 {
+		t.Fatalf("%d requests to /api/chat, want 2", len(payloads))
+	}
+	for i, payload := range payloads {
+		options, _ := payload["options"].(map[string]any)
+		if len(options) != len(want) {
+			t.Errorf("request %d: options = %v, want %v", i, options, want)
+		}
+		for key, value := range want {
+			if options[key] != value {
+				t.Errorf("request %d: options.%s = %v, want %v", i, key, options[key], value)
+			}
+		}
+	}
+}
+
+func TestOllamaChatPayloadWithoutOptions(t *testing.T) {
+	data, err := json.Marshal(OllamaChatRequest{Model: "llama3.2", Options: ollamaOptions(&chatRequest{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["options"]; ok {
+		t.Errorf("payload = %s, want no options", data)
+	}
+}
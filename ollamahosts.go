@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// OllamaHost is one of several Ollama instances, e.g. a GPU machine and the
+// laptop. Models are sent to the instance with the highest priority that
+// has them.
+type OllamaHost struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Priority int    `json:"priority,omitempty"` // higher is tried first
+}
+
+func validateOllamaHosts(hosts []OllamaHost) error {
+	var names []string
+	for i, host := range hosts {
+		if host.URL == "" {
+			return fmt.Errorf("ollama_hosts[%d] has no url", i)
+		}
+		name := ollamaHostName(host)
+		if slices.Contains(names, name) {
+			return fmt.Errorf("ollama_hosts: %s is listed twice", name)
+		}
+		names = append(names, name)
+	}
+	return nil
+}
+
+// hasOllamaHosts reports whether ollama_hosts are configured, which are
+// used over the API without the ollama command.
+func hasOllamaHosts() bool {
+	config, err := loadConfigOrDefault()
+	return err == nil && len(config.OllamaHosts) > 0
+}
+
+// ollamaHosts returns the configured Ollama instances in the order they are
+// tried, or the one of OLLAMA_HOST if none are configured.
+func ollamaHosts() []OllamaHost {
+	config, err := loadConfigOrDefault()
+	if err != nil || len(config.OllamaHosts) == 0 {
+		return []OllamaHost{{URL: getOllamaHost()}}
+	}
+	hosts := slices.Clone(config.OllamaHosts)
+	for i := range hosts {
+		hosts[i].Name = ollamaHostName(hosts[i])
+		hosts[i].URL = ollamaBaseURL(hosts[i].URL)
+	}
+	slices.SortStableFunc(hosts, func(a, b OllamaHost) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+	return hosts
+}
+
+// ollamaHostName returns the name of host, by default the host of its URL.
+func ollamaHostName(host OllamaHost) string {
+	if host.Name != "" {
+		return host.Name
+	}
+	if u, err := url.Parse(ollamaBaseURL(host.URL)); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return host.URL
+}
+
+// ollamaBaseURL completes a host like OLLAMA_HOST to a URL.
+func ollamaBaseURL(host string) string {
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+// listOllamaHostModels lists and merges the models of all ollama_hosts,
+// recording which hosts have each. Hosts that can't be reached are left
+// out, unless none can be.
+func listOllamaHostModels(hosts []OllamaHost) ([]ollamaModel, error) {
+	var models []ollamaModel
+	var lastErr error
+	reached := 0
+	for _, host := range hosts {
+		tags, err := fetchOllamaTags(host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reached++
+		for _, tag := range tags {
+			i := slices.IndexFunc(models, func(m ollamaModel) bool { return m.Name == tag.Name })
+			if i < 0 {
+				models = append(models, ollamaModel{Name: tag.Name, Size: fmt.Sprintf("%.1f GB", float64(tag.Size)/1e9)})
+				i = len(models) - 1
+			}
+			models[i].Hosts = append(models[i].Hosts, host.Name)
+		}
+	}
+	if reached == 0 {
+		return nil, fmt.Errorf("failed to list models: %w", lastErr)
+	}
+	return models, nil
+}
+
+type ollamaTag struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// fetchOllamaTags lists the models installed on host.
+func fetchOllamaTags(host OllamaHost) ([]ollamaTag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", host.URL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama at %s: %w", host.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama at %s: %s", host.Name, resp.Status)
+	}
+
+	var tags struct {
+		Models []ollamaTag `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+// ollamaModelHosts maps the Ollama models to the names of the hosts that
+// have them, for showing next to the models. It is nil unless several
+// hosts are configured.
+func ollamaModelHosts() map[string][]string {
+	hosts := ollamaHosts()
+	if len(hosts) < 2 {
+		return nil
+	}
+	models, err := listOllamaHostModels(hosts)
+	if err != nil {
+		return nil
+	}
+	byModel := make(map[string][]string)
+	for _, m := range models {
+		byModel[m.Name] = m.Hosts
+	}
+	return byModel
+}
+
+// modelLabel is the model of opt as listed, with its hosts if known.
+func modelLabel(opt ModelOption, hosts map[string][]string) string {
+	if opt.Provider != Ollama || len(hosts[opt.Model]) == 0 {
+		return opt.Model
+	}
+	return opt.Model + " @" + strings.Join(hosts[opt.Model], ",")
+}
+
+// ollamaHostsWith returns the hosts to try for model, in order: those that
+// have it, or all of them if that is unknown.
+func ollamaHostsWith(model string) []OllamaHost {
+	hosts := ollamaHosts()
+	if len(hosts) == 1 {
+		return hosts
+	}
+	models, err := listOllamaHostModels(hosts)
+	if err != nil {
+		return hosts
+	}
+	i := slices.IndexFunc(models, func(m ollamaModel) bool { return m.Name == model })
+	if i < 0 {
+		return hosts
+	}
+	var with []OllamaHost
+	for _, host := range hosts {
+		if slices.Contains(models[i].Hosts, host.Name) {
+			with = append(with, host)
+		}
+	}
+	return with
+}
+
+// ollamaHostFor returns the base URL of the host that serves model.
+func ollamaHostFor(model string) string {
+	return ollamaHostsWith(model)[0].URL
+}
+
+// postOllama sends a request for model to the first host that has it,
+// falling through to the next one while hosts can't be reached.
+func postOllama(ctx context.Context, model, path string, body []byte) (*http.Response, error) {
+	hosts := ollamaHostsWith(model)
+	var lastErr error
+	for i, host := range hosts {
+		req, err := http.NewRequestWithContext(ctx, "POST", host.URL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+		if i < len(hosts)-1 {
+			notef("Warning: Ollama at %s can't be reached, trying %s\n", host.Name, hosts[i+1].Name)
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// largeModelBytes is the memory size from which a resident model is worth
+// a warning before it is evicted, if the machine's memory is unknown.
+const largeModelBytes = 8 << 30
+
+// ollamaLoadedModel is an entry of /api/ps: a model held in memory.
+type ollamaLoadedModel struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`      // memory used in total
+	SizeVRAM  int64     `json:"size_vram"` // the part of it in GPU memory
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// processor describes where the model runs, like "ollama ps" does.
+func (m ollamaLoadedModel) processor() string {
+	switch {
+	case m.Size == 0 || m.SizeVRAM == 0:
+		return "100% CPU"
+	case m.SizeVRAM >= m.Size:
+		return "100% GPU"
+	}
+	gpu := int(m.SizeVRAM * 100 / m.Size)
+	return fmt.Sprintf("%d%%/%d%% CPU/GPU", 100-gpu, gpu)
+}
+
+func fetchLoadedModels(ctx context.Context, host string) ([]ollamaLoadedModel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", host+"/api/ps", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama ps: %s", resp.Status)
+	}
+
+	var ps struct {
+		Models []ollamaLoadedModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, err
+	}
+	return ps.Models, nil
+}
+
+// loadedModelsCommand shows the Ollama models in memory, with the host of
+// each if there are several.
+func loadedModelsCommand() error {
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	hosts := ollamaHosts()
+	type hostModel struct {
+		host string
+		ollamaLoadedModel
+	}
+	var loaded []hostModel
+	for _, host := range hosts {
+		models, err := fetchLoadedModels(ctx, host.URL)
+		if err != nil {
+			if len(hosts) == 1 {
+				return err
+			}
+			notef("Warning: %v\n", err)
+			continue
+		}
+		for _, m := range models {
+			loaded = append(loaded, hostModel{host.Name, m})
+		}
+	}
+	if len(loaded) == 0 {
+		fmt.Println("No models loaded.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "MODEL\tSIZE\tVRAM\tPROCESSOR\tUNTIL"
+	if len(hosts) > 1 {
+		header += "\tHOST"
+	}
+	fmt.Fprintln(w, header)
+	for _, m := range loaded {
+		until := "-"
+		if !m.ExpiresAt.IsZero() {
+			until = m.ExpiresAt.Local().Format("15:04:05")
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", m.Name, formatBytes(int(m.Size)), formatBytes(int(m.SizeVRAM)), m.processor(), until)
+		if len(hosts) > 1 {
+			line += "\t" + m.host
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+// warnModelSwap warns if loading model will likely push other large models
+// out of memory, which makes both this request and the next use of the
+// evicted model slow. Failures to find out are ignored.
+func warnModelSwap(config *Config, model string) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	host := ollamaHostFor(model)
+	loaded, err := fetchLoadedModels(ctx, host)
+	if err != nil {
+		return
+	}
+
+	var others []ollamaLoadedModel
+	var resident int64
+	for _, m := range loaded {
+		if m.Name == model {
+			return // already in memory
+		}
+		others = append(others, m)
+		resident += m.Size
+	}
+	if len(others) == 0 {
+		return
+	}
+
+	size := installedModelSize(model)
+	if memory := ollamaMemory(config, host); memory > 0 {
+		if resident+size <= memory {
+			return
+		}
+	} else if !hasLargeModel(others) {
+		return
+	}
+
+	var names []string
+	for _, m := range others {
+		names = append(names, fmt.Sprintf("%s (%s)", m.Name, formatBytes(int(m.Size))))
+	}
+	what := model
+	if size > 0 {
+		what += " (" + formatBytes(int(size)) + ")"
+	}
+	notef("Warning: loading %s will likely evict %s from memory; the model swap can be slow\n", what, strings.Join(names, ", "))
+}
+
+func hasLargeModel(models []ollamaLoadedModel) bool {
+	for _, m := range models {
+		if m.Size >= largeModelBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// installedModelSize returns the size of an installed model as listed by
+// "ollama list", or 0 if unknown.
+func installedModelSize(model string) int64 {
+	models, err := listOllamaModels()
+	if err != nil {
+		return 0
+	}
+	for _, m := range models {
+		if m.Name == model {
+			return parseOllamaSize(m.Size)
+		}
+	}
+	return 0
+}
+
+// isLoopback reports whether host names this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// parseOllamaSize parses sizes like "4.7 GB" as printed by "ollama list".
+func parseOllamaSize(size string) int64 {
+	number, unit, ok := strings.Cut(size, " ")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "KB":
+		n *= 1e3
+	case "MB":
+		n *= 1e6
+	case "GB":
+		n *= 1e9
+	case "TB":
+		n *= 1e12
+	}
+	return int64(n)
+}
+
+// ollamaMemory returns the memory available to the Ollama at host:
+// ollama_memory_gb from the configuration, or the machine's memory where it
+// is known.
+func ollamaMemory(config *Config, host string) int64 {
+	if config.OllamaMemoryGB > 0 {
+		return int64(config.OllamaMemoryGB * (1 << 30))
+	}
+	if u, err := url.Parse(host); err != nil || !isLoopback(u.Hostname()) {
+		return 0 // the memory of another machine is unknown
+	}
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       32795412 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb << 10
+		}
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// contentPart is an element of message content sent as an array, as some
+// OpenAI-compatible APIs (OpenRouter, vLLM) do.
+type contentPart struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Refusal string `json:"refusal"`
+}
+
+// UnmarshalJSON accepts the content of a message as a string, as null, or
+// as an array of typed parts. The text parts of an array are joined, and
+// refusal parts are added to Refusal.
+func (m *OpenAIMessage) UnmarshalJSON(data []byte) error {
+	type message OpenAIMessage // without this method
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = OpenAIMessage(raw.message)
+
+	content := strings.TrimSpace(string(raw.Content))
+	switch {
+	case content == "" || content == "null":
+	case strings.HasPrefix(content, "["):
+		var parts []contentPart
+		if err := json.Unmarshal(raw.Content, &parts); err != nil {
+			return err
+		}
+		var text strings.Builder
+		for _, part := range parts {
+			switch part.Type {
+			case "refusal":
+				m.Refusal += part.Refusal
+			default:
+				text.WriteString(part.Text)
+			}
+		}
+		m.Content = text.String()
+	default:
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+	return nil
+}
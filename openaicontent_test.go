@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIMessageContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		wantContent string
+		wantRefusal string
+	}{
+		{name: "string", json: `{"role":"assistant","content":"Hello"}`, wantContent: "Hello"},
+		{name: "null", json: `{"role":"assistant","content":null,"refusal":"I can't help with that."}`, wantRefusal: "I can't help with that."},
+		{name: "missing", json: `{"role":"assistant"}`},
+		{name: "empty array", json: `{"role":"assistant","content":[]}`},
+		{
+			name:        "text parts",
+			json:        `{"role":"assistant","content":[{"type":"text","text":"Hello, "},{"type":"text","text":"world"}]}`,
+			wantContent: "Hello, world",
+		},
+		{
+			name:        "output_text parts",
+			json:        `{"role":"assistant","content":[{"type":"output_text","text":"Hi"}]}`,
+			wantContent: "Hi",
+		},
+		{
+			name:        "refusal part",
+			json:        `{"role":"assistant","content":[{"type":"refusal","refusal":"No."}]}`,
+			wantRefusal: "No.",
+		},
+		{
+			name:        "text and refusal parts",
+			json:        `{"role":"assistant","content":[{"type":"text","text":"Partly: "},{"type":"refusal","refusal":"the rest, no."}]}`,
+			wantContent: "Partly: ",
+			wantRefusal: "the rest, no.",
+		},
+		{name: "array with whitespace", json: "{\"content\": \n [ {\"type\":\"text\",\"text\":\"x\"} ]}", wantContent: "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m OpenAIMessage
+			if err := json.Unmarshal([]byte(tt.json), &m); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if m.Content != tt.wantContent || m.Refusal != tt.wantRefusal {
+				t.Errorf("content = %q, refusal = %q; want %q, %q", m.Content, m.Refusal, tt.wantContent, tt.wantRefusal)
+			}
+		})
+	}
+}
+
+func TestOpenAIMessageKeepsOtherFields(t *testing.T) {
+	var m OpenAIMessage
+	data := `{"role":"assistant","content":[{"type":"text","text":"Let me check."}],"reasoning_content":"thinking",` +
+		`"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{}"}}]}`
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Role != "assistant" || m.Content != "Let me check." || m.ReasoningContent != "thinking" || len(m.ToolCalls) != 1 || m.ToolCalls[0].ID != "call_1" {
+		t.Errorf("message = %+v", m)
+	}
+}
+
+func TestOpenAIMessageInvalidContent(t *testing.T) {
+	for _, data := range []string{`{"content":42}`, `{"content":[1,2]}`, `{"content":{"text":"x"}}`} {
+		var m OpenAIMessage
+		if err := json.Unmarshal([]byte(data), &m); err == nil {
+			t.Errorf("Unmarshal(%s) accepted the content as %q", data, m.Content)
+		}
+	}
+}
+
+// serveOpenAI answers every chat completion with body.
+func serveOpenAI(t *testing.T, contentType, body string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "test")
+	previous := openAIBaseURL
+	openAIBaseURL = srv.URL
+	t.Cleanup(func() { openAIBaseURL = previous })
+}
+
+func TestExecuteOpenAIContentParts(t *testing.T) {
+	// shaped like an OpenRouter response
+	serveOpenAI(t, "application/json", `{
+		"id": "gen-1", "provider": "Anthropic", "model": "anthropic/claude-sonnet-4", "object": "chat.completion",
+		"choices": [{"index": 0, "finish_reason": "stop", "native_finish_reason": "end_turn", "message": {
+			"role": "assistant",
+			"content": [{"type": "text", "text": "The answer "}, {"type": "text", "text": "is 42."}]
+		}}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`)
+
+	req := &chatRequest{Provider: OpenAI, Model: "anthropic/claude-sonnet-4", Messages: []OpenAIMessage{{Role: "user", Content: "?"}}}
+	result, err := executeRequest(req, nil)
+	if err != nil {
+		t.Fatalf("executeRequest: %v", err)
+	}
+	if result.Content != "The answer is 42." || result.PromptTokens != 10 || result.CompletionTokens != 5 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestExecuteOpenAIRefusal(t *testing.T) {
+	serveOpenAI(t, "application/json", `{"choices": [{"finish_reason": "stop", "message": {
+		"role": "assistant", "content": [{"type": "refusal", "refusal": "I can't help with that."}]
+	}}]}`)
+
+	req := &chatRequest{Provider: OpenAI, Model: "gpt-test", Messages: []OpenAIMessage{{Role: "user", Content: "?"}}}
+	_, err := executeRequest(req, nil)
+	if err == nil || !strings.Contains(err.Error(), "refused to answer: I can't help with that.") {
+		t.Errorf("err = %v, want the refusal", err)
+	}
+}
+
+func TestStreamOpenAIContentParts(t *testing.T) {
+	// shaped like a vLLM stream
+	var events strings.Builder
+	for _, chunk := range []string{
+		`{"id":"cmpl-1","object":"chat.completion.chunk","model":"qwen","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`{"id":"cmpl-1","object":"chat.completion.chunk","model":"qwen","choices":[{"index":0,"delta":{"content":[{"type":"text","text":"Hello"}]},"finish_reason":null}]}`,
+		`{"id":"cmpl-1","object":"chat.completion.chunk","model":"qwen","choices":[{"index":0,"delta":{"content":" there"},"finish_reason":"stop"}]}`,
+	} {
+		fmt.Fprintf(&events, "data: %s\n\n", chunk)
+	}
+	events.WriteString("data: [DONE]\n\n")
+	serveOpenAI(t, "text/event-stream", events.String())
+
+	var streamed bytes.Buffer
+	req := &chatRequest{Provider: OpenAI, Model: "qwen", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+	result, err := streamOpenAI(req, &streamTarget{w: &streamed})
+	if err != nil {
+		t.Fatalf("streamOpenAI: %v", err)
+	}
+	if result.Content != "Hello there" || streamed.String() != "Hello there" {
+		t.Errorf("content = %q, streamed %q; want both parts", result.Content, streamed.String())
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// options holds the global flags that may appear anywhere before a "--"
+// separator.
+type options struct {
+	outputFiles []string // -o may be repeated, the extension picks the format
+	language    string
+	moderate    string   // "", "block" or "warn"
+	scrub       string   // "" (provider default), "redact", "block" or "off"
+	models      []string // --model may be repeated, e.g. for bench
+	temperature *float64
+	maxTokens   int     // limit of the answer's tokens, 0 for the provider's
+	maxInputUSD float64 // refuse prompts estimated above it, 0 for no limit
+	dryRun      bool
+	noWrap      bool
+	overBudget  bool
+	yes         bool   // send large piped input without asking
+	errorFormat string // "" or "text", or "json" for machine-readable errors
+	color       string // "auto", "always" or "never"
+	offline     bool
+	stream      bool
+	noStream    bool
+	verbose     bool
+	rawInput    bool     // don't convert piped HTML to text
+	noSquash    bool     // don't squash repeated lines of piped input
+	noDotenv    bool     // don't read provider keys from a .env file
+	noCitations bool     // don't ask for and check citations of -f files
+	noFileArgs  bool     // send trailing file names as prompt text
+	raw         bool     // print the answer without normalizing whitespace
+	instruction string   // the prompt, given as a flag so stdin is only data
+	json        bool     // ask for a JSON answer (for bench: print JSON)
+	schema      string   // file with the JSON Schema the answer must match
+	urls        []string // pages to fetch and add to the prompt
+	files       []string // files to add to the prompt
+	execs       []string // commands whose output is added to the prompt
+	table       string   // "", "summary" or "full"
+	jsonInput   bool     // shrink piped JSON structurally
+	tools       []string // built-in tools and MCP servers the model may call
+	allTools    bool     // bare --tools: every built-in tool and MCP server
+	code        bool     // print only the code blocks of the answer
+	post        string   // command the answer is piped through
+	copy        bool     // also copy the answer to the clipboard
+	paste       bool     // use the clipboard as the piped input
+	notify      bool     // announce the completed answer
+	tier        string   // routing tier to use
+	role        string   // configured role whose system prompt is added
+	length      string   // "short", "long" or "bullets": answer length preset
+	session     string   // saved conversation to continue
+	tags        []string // attribute the usage of the request, see --tag
+	// autoContinue continues answers cut off at the token limit.
+	autoContinue bool
+	// allowEmpty accepts empty answers instead of failing with
+	// exitEmptyAnswer.
+	allowEmpty bool
+	// allowOutside lets -o names with placeholders lead out of their
+	// directory, see checkOutputName.
+	allowOutside bool
+	// meter shows the tokens per second while an answer streams.
+	meter bool
+	// watch runs the prompt again whenever a -f file changes.
+	watch bool
+	// showThinking prints the reasoning of reasoning models to stderr.
+	showThinking bool
+	// savePrompt and saveExchange keep the assembled prompt, and with
+	// saveExchange the answer, for later reference.
+	savePrompt   string
+	saveExchange string
+	// debugDir is where requests and responses are captured for bug
+	// reports.
+	debugDir string
+	// prompt is the user's prompt, for {slug} in -o names.
+	prompt string
+	// smartTruncate elides function bodies of attached code that doesn't
+	// fit the context window.
+	smartTruncate bool
+	// continueSession continues the most recently used session.
+	continueSession bool
+	stats           bool // print statistics about the answer
+	quiet           bool // no footer after the answer
+	webSearch       bool // let the model search the web
+
+	// task names the built-in task the prompt belongs to (e.g. "run"), used
+	// to look up per-task models. It is not set by a flag.
+	task string
+	// batch is set while running many requests concurrently, which rules out
+	// interactive recovery.
+	batch bool
+	// noRetry keeps a request from replacing the one "retry" sends again,
+	// e.g. for the requests of editors through the local server.
+	noRetry bool
+	// streamed is set once the answer was already printed while streaming.
+	streamed bool
+	// streamWriter receives the answer as it arrives instead of stdout,
+	// e.g. to pass a stream through the local server.
+	streamWriter io.Writer
+	// journal keeps an answer streamed for -o files on disk until they are
+	// written, see outputjournal.go.
+	journal *outputJournal
+	// titling is closed once the title of a new session is written, see
+	// startSessionTitle.
+	titling chan struct{}
+	// template names the template being run, for its model.
+	template string
+	// chat is set while running the chat REPL.
+	chat bool
+	// autoSession allows the project session of auto_session for plain
+	// prompts and chat; sessionDir is the project root once it is used.
+	autoSession bool
+	sessionDir  string
+	// answered describes the answer for --stats once it has arrived.
+	answered *answerStats
+	// sources are the URLs cited in a --web-search answer.
+	sources []string
+}
+
+// validateOptions checks the options that depend on the configuration.
+func validateOptions(config *Config, opts *options) error {
+	if err := validateTools(config, opts); err != nil {
+		return err
+	}
+	if _, ok := config.Roles[opts.role]; opts.role != "" && !ok {
+		return &exitError{code: exitUsage, err: fmt.Errorf("unknown role: %s (see 'ai-cli tpl list')", opts.role)}
+	}
+	return checkTier(config, opts)
+}
+
+// model returns the model given with --model, or "" if none was given. If
+// the flag was repeated, the last one wins.
+func (o *options) model() string {
+	if len(o.models) == 0 {
+		return ""
+	}
+	return o.models[len(o.models)-1]
+}
+
+// parseOptions extracts global flags from args and returns the remaining
+// arguments. Parsing stops at "--", which is kept in the remaining arguments
+// so subcommands can interpret it. On error, the options parsed so far are
+// returned, so the error can be reported in the requested format.
+func parseOptions(args []string) (*options, []string, error) {
+	opts := &options{}
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s flag requires an argument", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch name {
+		case "-o":
+			var file string
+			file, err = takeValue()
+			opts.outputFiles = append(opts.outputFiles, file)
+		case "--short", "--long", "--bullets":
+			length := strings.TrimPrefix(name, "--")
+			if opts.length != "" && opts.length != length {
+				return opts, nil, &exitError{code: exitUsage, err: fmt.Errorf("--%s and --%s can't be combined", opts.length, length)}
+			}
+			opts.length = length
+		case "--lang":
+			opts.language, err = takeValue()
+		case "--model":
+			var model string
+			model, err = takeValue()
+			opts.models = append(opts.models, model)
+		case "--temperature":
+			var raw string
+			if raw, err = takeValue(); err == nil {
+				t, parseErr := strconv.ParseFloat(raw, 64)
+				if parseErr != nil || t < 0 || t > 2 {
+					return opts, nil, fmt.Errorf("invalid --temperature value: %s (use 0 to 2)", raw)
+				}
+				opts.temperature = &t
+			}
+		case "--max-tokens":
+			var raw string
+			if raw, err = takeValue(); err == nil {
+				n, parseErr := strconv.Atoi(raw)
+				if parseErr != nil || n < 1 {
+					return opts, nil, fmt.Errorf("invalid --max-tokens value: %s (use a positive number)", raw)
+				}
+				opts.maxTokens = n
+			}
+		case "--max-input-cost":
+			var raw string
+			if raw, err = takeValue(); err == nil {
+				cost, parseErr := strconv.ParseFloat(strings.TrimPrefix(raw, "$"), 64)
+				if parseErr != nil || cost <= 0 {
+					return opts, nil, fmt.Errorf("invalid --max-input-cost value: %s (use a positive amount in dollars)", raw)
+				}
+				opts.maxInputUSD = cost
+			}
+		case "--auto-continue":
+			opts.autoContinue = true
+		case "--allow-empty":
+			opts.allowEmpty = true
+		case "--allow-outside":
+			opts.allowOutside = true
+		case "--watch":
+			opts.watch = true
+		case "--show-thinking":
+			opts.showThinking = true
+		case "--smart-truncate":
+			opts.smartTruncate = true
+		case "-f":
+			var file string
+			file, err = takeValue()
+			opts.files = append(opts.files, file)
+		case "--table":
+			opts.table = "summary"
+			if hasValue {
+				if value != "summary" && value != "full" {
+					return opts, nil, fmt.Errorf("invalid --table value: %s (use summary or full)", value)
+				}
+				opts.table = value
+			}
+		case "--tools":
+			// names are checked against the configured MCP servers later
+			opts.tools, opts.allTools = nil, !hasValue
+			if hasValue {
+				for _, name := range strings.Split(value, ",") {
+					opts.tools = append(opts.tools, strings.TrimSpace(name))
+				}
+			}
+		case "--code":
+			opts.code = true
+		case "--post":
+			opts.post, err = takeValue()
+		case "--copy":
+			opts.copy = true
+		case "--paste":
+			opts.paste = true
+		case "--notify":
+			opts.notify = true
+		case "--web-search":
+			opts.webSearch = true
+		case "--session":
+			opts.session, err = takeValue()
+		case "-c", "--continue":
+			opts.continueSession = true
+		case "--role":
+			opts.role, err = takeValue()
+		case "--tag":
+			var tag string
+			tag, err = takeValue()
+			opts.tags = append(opts.tags, tag)
+		case "--tier":
+			opts.tier, err = takeValue()
+		case "--stats":
+			opts.stats = true
+		case "--quiet":
+			opts.quiet = true
+		case "--json-input":
+			opts.jsonInput = true
+		case "--url":
+			var url string
+			url, err = takeValue()
+			opts.urls = append(opts.urls, url)
+		case "--exec":
+			var command string
+			command, err = takeValue()
+			opts.execs = append(opts.execs, command)
+		case "--raw-input":
+			opts.rawInput = true
+		case "--no-squash":
+			opts.noSquash = true
+		case "--no-dotenv":
+			opts.noDotenv = true
+		case "--no-citations":
+			opts.noCitations = true
+		case "--no-file-args":
+			opts.noFileArgs = true
+		case "--save-prompt":
+			opts.savePrompt, err = takeValue()
+		case "--save-exchange":
+			opts.saveExchange, err = takeValue()
+		case "--debug-dir":
+			opts.debugDir, err = takeValue()
+		case "--json":
+			opts.json = true
+		case "--schema":
+			opts.schema, err = takeValue()
+		case "--instruction":
+			opts.instruction, err = takeValue()
+		case "--raw":
+			opts.raw = true
+		case "--verbose":
+			opts.verbose = true
+		case "--dry-run":
+			opts.dryRun = true
+		case "--no-wrap":
+			opts.noWrap = true
+		case "--stream":
+			opts.stream, opts.noStream = true, false
+		case "--no-stream":
+			opts.stream, opts.noStream = false, true
+		case "--meter":
+			opts.meter = true
+		case "--offline":
+			opts.offline = true
+		case "--errors":
+			if opts.errorFormat, err = takeValue(); err == nil && opts.errorFormat != "text" && opts.errorFormat != "json" {
+				return opts, nil, fmt.Errorf("invalid --errors value: %s (use text or json)", opts.errorFormat)
+			}
+		case "--color":
+			if opts.color, err = takeValue(); err == nil && opts.color != "auto" && opts.color != "always" && opts.color != "never" {
+				return opts, nil, fmt.Errorf("invalid --color value: %s (use auto, always or never)", opts.color)
+			}
+		case "--yes":
+			opts.yes = true
+		case "--over-budget":
+			opts.overBudget = true
+		case "--scrub":
+			opts.scrub = "redact"
+			if hasValue {
+				if value != "redact" && value != "block" && value != "off" {
+					return opts, nil, fmt.Errorf("invalid --scrub value: %s (use redact, block or off)", value)
+				}
+				opts.scrub = value
+			}
+		case "--moderate":
+			opts.moderate = "block"
+			if hasValue {
+				if value != "block" && value != "warn" {
+					return opts, nil, fmt.Errorf("invalid --moderate value: %s (use block or warn)", value)
+				}
+				opts.moderate = value
+			}
+		default:
+			rest = append(rest, arg)
+		}
+		if err != nil {
+			return opts, nil, err
+		}
+	}
+
+	return opts, rest, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeFencePattern matches a fenced Markdown code block and captures its
+// content.
+var codeFencePattern = regexp.MustCompile("(?ms)^[ \t]*```[^\n]*\n(.*?)^[ \t]*```[ \t]*$")
+
+// transformsOutput reports whether the answer is changed or checked before
+// it is printed, which rules out streaming it to the terminal.
+func (o *options) transformsOutput(config *Config) bool {
+	return o.code || o.json || o.schema != "" || o.postCommand(config) != ""
+}
+
+// streamsCode reports whether --code is the only transformation, so the
+// code blocks can be printed as they arrive.
+func (o *options) streamsCode(config *Config) bool {
+	return o.code && !o.json && o.schema == "" && o.postCommand(config) == ""
+}
+
+// postCommand is the --post command, or else the configured
+// post_process_cmd.
+func (o *options) postCommand(config *Config) string {
+	if o.post != "" {
+		return o.post
+	}
+	return config.PostProcessCmd
+}
+
+// processOutput normalizes an answer (unless --raw) and applies --code and
+// then the post-processing command to it.
+func processOutput(output string, config *Config, opts *options) string {
+	if !opts.raw {
+		output = normalizeOutput(output)
+	}
+	if opts.code {
+		output = extractCode(output)
+	}
+	if command := opts.postCommand(config); command != "" {
+		output = postProcess(command, output)
+	}
+	return output
+}
+
+// postProcess pipes the answer through a shell command and returns its
+// stdout. If the command fails, the original answer is kept.
+func postProcess(command, output string) string {
+	cmd := shellCommand(command)
+	cmd.Stdin = strings.NewReader(output)
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		notef("Warning: post-processing command failed (%v), keeping the original answer\n", err)
+		return output
+	}
+	return stdout.String()
+}
+
+// preProcessPrompt pipes the assembled prompt through the configured
+// pre_process_cmd. A failing hook aborts the request with its stderr.
+func preProcessPrompt(config *Config, prompt string) (string, error) {
+	if config.PreProcessCmd == "" {
+		return prompt, nil
+	}
+	cmd := shellCommand(config.PreProcessCmd)
+	cmd.Stdin = strings.NewReader(prompt)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("pre_process_cmd failed (%v): %s", err, msg)
+		}
+		return "", fmt.Errorf("pre_process_cmd failed: %v", err)
+	}
+	return stdout.String(), nil
+}
+
+// shellCommand runs a command line through the platform's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// clipboardCommands are tried in order until one is installed.
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"clip.exe"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// pasteCommands print the text on the clipboard; they are tried in order
+// until one is installed.
+var pasteCommands = [][]string{
+	{"pbpaste"},
+	{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+	{"wl-paste", "--no-newline", "--type", "text"},
+	{"xclip", "-selection", "clipboard", "-out"},
+	{"xsel", "--clipboard", "--output"},
+}
+
+// pasteFromClipboard returns the text on the system clipboard. An empty
+// clipboard and one holding an image or other binary data are errors.
+func pasteFromClipboard() (string, error) {
+	for _, args := range pasteCommands {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return "", fmt.Errorf("failed to read the clipboard: %s: %s", args[0], message)
+			}
+			return "", fmt.Errorf("failed to read the clipboard: %s: %w", args[0], err)
+		}
+		text := stdout.String()
+		switch {
+		case strings.TrimSpace(text) == "":
+			return "", &exitError{code: exitUsage, err: fmt.Errorf("the clipboard is empty")}
+		case !utf8.ValidString(text) || strings.ContainsRune(text, 0):
+			return "", &exitError{code: exitUsage, err: fmt.Errorf("the clipboard holds binary data, not text")}
+		}
+		return text, nil
+	}
+	return "", fmt.Errorf("no clipboard tool found (install wl-paste, xclip or xsel)")
+}
+
+// copyToClipboard puts text on the system clipboard.
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (install wl-copy, xclip or xsel)")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// outputJournal keeps an answer streamed for -o files on disk as it
+// arrives, in a ".partial" file next to the first of them, since the files
+// themselves are only written once the answer is complete. A successful
+// run removes it; after Ctrl-C or a failed request it is kept with a
+// marker at the end, and after a crash it is kept as it was.
+type outputJournal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	written bool
+	signals chan os.Signal
+	stopped sync.Once
+}
+
+// openOutputJournal creates the journal for the -o file name, whose
+// placeholders are filled in as far as they are known before the answer.
+func openOutputJournal(name string, req *chatRequest, opts *options) (*outputJournal, error) {
+	known := *opts
+	known.answered = &answerStats{provider: req.Provider, model: req.Model}
+	path, _ := expandOutputName(name, time.Now(), &known)
+	if err := checkOutputName(name, path, opts); err != nil {
+		return nil, err
+	}
+	path += ".partial"
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &outputJournal{path: path, f: f, signals: make(chan os.Signal, 1)}
+	signal.Notify(j.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-j.signals; ok {
+			j.abandon("interrupted")
+			os.Exit(exitInterrupted)
+		}
+	}()
+	return j, nil
+}
+
+// Write adds a piece of the answer. It goes straight to the file, so it is
+// on disk even if ai-cli dies right after.
+func (j *outputJournal) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return len(p), nil
+	}
+	j.written = j.written || len(p) > 0
+	return j.f.Write(p)
+}
+
+// abandon ends the journal with a marker saying why the answer is
+// incomplete and keeps it, unless nothing of the answer arrived.
+func (j *outputJournal) abandon(reason string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	written := j.written
+	j.mu.Unlock()
+	if !written {
+		j.remove()
+		return
+	}
+	j.stop()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return
+	}
+	fmt.Fprintf(j.f, "\n\n[ai-cli: answer truncated, %s]\n", reason)
+	j.f.Close()
+	j.f = nil
+	notef("The partial answer was kept in %s\n", j.path)
+}
+
+// remove deletes the journal once the answer is in the -o files.
+func (j *outputJournal) remove() {
+	if j == nil {
+		return
+	}
+	j.stop()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return
+	}
+	j.f.Close()
+	j.f = nil
+	os.Remove(j.path)
+}
+
+func (j *outputJournal) stop() {
+	j.stopped.Do(func() {
+		signal.Stop(j.signals)
+		close(j.signals)
+	})
+}
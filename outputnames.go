@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// slugWords is how many words of the prompt make up {slug}.
+const slugWords = 6
+
+var (
+	outputPlaceholderPattern = regexp.MustCompile(`\{(date|time|model|slug)\}`)
+	slugSeparators           = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// expandOutputName fills in the placeholders of an -o name: {date}
+// (YYYY-MM-DD), {time} (HHMMSS), {model} and {slug}, the first words of
+// the prompt. It reports whether the name had any. What is filled in is
+// never a path, see outputNamePart.
+func expandOutputName(name string, now time.Time, opts *options) (string, bool) {
+	if !outputPlaceholderPattern.MatchString(name) {
+		return name, false
+	}
+	model := ""
+	if opts.answered != nil {
+		model = outputNamePart(opts.answered.model)
+	}
+	return outputPlaceholderPattern.ReplaceAllStringFunc(name, func(placeholder string) string {
+		switch placeholder {
+		case "{date}":
+			return now.Format("2006-01-02")
+		case "{time}":
+			return now.Format("150405")
+		case "{model}":
+			return model
+		default:
+			return promptSlug(opts.prompt)
+		}
+	}), true
+}
+
+// outputNamePart makes text safe to fill into a file name: it can't
+// contain a path separator, or be "." or "..", so a placeholder stays one
+// part of the name, whatever the model or prompt is.
+func outputNamePart(text string) string {
+	part := strings.Trim(unsafeNameChars.ReplaceAllString(text, "_"), ".")
+	if part == "" {
+		return "_"
+	}
+	return part
+}
+
+// checkOutputName refuses an expanded -o name that leads out of the
+// directory the name starts in, before its first placeholder, e.g.
+// "answers" for "answers/{date}-{slug}.md". Filled-in placeholders can't
+// do that, see outputNamePart, but they can name a symbolic link that
+// does, so links are followed. The file is only written if it is certain.
+// --allow-outside skips the check; names without placeholders are the
+// user's own and aren't checked.
+func checkOutputName(name, path string, opts *options) error {
+	loc := outputPlaceholderPattern.FindStringIndex(name)
+	if loc == nil || opts.allowOutside {
+		return nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(name[:loc[0]] + "x"))
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(resolveSymlinks(dir), resolveSymlinks(resolved))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &exitError{code: exitUsage, err: fmt.Errorf("-o %s would write %s, outside %s; pass --allow-outside to allow it", name, path, dir)}
+	}
+	return nil
+}
+
+// resolveSymlinks follows the symbolic links in the part of path that
+// exists; the rest is kept as is.
+func resolveSymlinks(path string) string {
+	rest := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// promptSlug turns the first words of a prompt into a file name part, e.g.
+// "explain-how-binary-search-works".
+func promptSlug(prompt string) string {
+	words := strings.Fields(strings.ToLower(prompt))
+	if len(words) > slugWords {
+		words = words[:slugWords]
+	}
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.Join(words, " "), "-"), "-")
+	if len(slug) > 50 {
+		slug = strings.TrimRight(slug[:50], "-")
+	}
+	if slug == "" {
+		return "answer"
+	}
+	return slug
+}
+
+// createOutputFile creates the file for an -o name with placeholders,
+// along with its directories. An existing file is never overwritten: a
+// numeric suffix is added instead, e.g. "notes-2.md".
+func createOutputFile(path string, data []byte) (string, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		name := path
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return name, err
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputNamePart(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"gpt-5-mini", "gpt-5-mini"},
+		{"llama3.2:latest", "llama3.2_latest"},
+		{"..", "_"},
+		{".", "_"},
+		{"", "_"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{"/etc/passwd", "_etc_passwd"},
+		{`..\..\windows`, "_.._windows"},
+	}
+	for _, tt := range tests {
+		got := outputNamePart(tt.text)
+		if got != tt.want {
+			t.Errorf("outputNamePart(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if strings.ContainsRune(got, filepath.Separator) || got == "." || got == ".." {
+			t.Errorf("outputNamePart(%q) = %q is a path", tt.text, got)
+		}
+	}
+}
+
+func TestExpandOutputName(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 5, 7, 0, time.UTC)
+	opts := &options{prompt: "Explain ../../etc/passwd to me, please, in detail", answered: &answerStats{model: "../../evil"}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"answers/{date}-{slug}.md", "answers/2026-10-16-explain-etc-passwd-to-me-please-in.md"},
+		{"{time}.md", "090507.md"},
+		{"out/{model}/{date}.md", "out/_.._evil/2026-10-16.md"},
+		{"/tmp/answers/{date}.md", "/tmp/answers/2026-10-16.md"},
+	}
+	for _, tt := range tests {
+		got, templated := expandOutputName(tt.name, now, opts)
+		if got != tt.want || !templated {
+			t.Errorf("expandOutputName(%q) = %q, %v; want %q", tt.name, got, templated, tt.want)
+		}
+	}
+	if got, templated := expandOutputName("answer.md", now, opts); got != "answer.md" || templated {
+		t.Errorf("a name without placeholders became %q, %v", got, templated)
+	}
+}
+
+func TestCheckOutputName(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	t.Chdir(root)
+	for _, dir := range []string{"answers", "answers/sub"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a link in the directory leading out of it, and the directory itself
+	// reached through a link
+	if err := os.Symlink(outside, filepath.Join("answers", "evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "answers"), "linked"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 16, 9, 5, 7, 0, time.UTC)
+	tests := []struct {
+		name    string
+		model   string
+		prompt  string
+		outside bool
+	}{
+		{name: "answers/{date}-{slug}.md", prompt: "../../etc/passwd"},
+		{name: "answers/{model}.md", model: ".."},
+		{name: "answers/{model}/x.md", model: "../../tmp"},
+		{name: "{slug}.md", prompt: "/etc/passwd"},
+		{name: "answers/sub/{date}.md"},
+		{name: filepath.Join(root, "answers", "{date}.md")},
+		{name: filepath.Join(outside, "{date}.md")},
+		{name: "linked/{date}.md"},
+		{name: "../{date}.md"},
+		{name: "answers/{date}/../../x.md", outside: true},
+		{name: "answers/{date}/../sub/x.md"},
+		{name: "answers/{model}/x.md", model: "evil", outside: true},
+		{name: "answers/{model}", model: "evil", outside: true},
+		{name: "linked/{model}/x.md", model: "evil", outside: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.model, func(t *testing.T) {
+			opts := &options{prompt: tt.prompt, answered: &answerStats{model: tt.model}}
+			path, _ := expandOutputName(tt.name, now, opts)
+
+			err := checkOutputName(tt.name, path, opts)
+			var exit *exitError
+			switch {
+			case tt.outside && (!errors.As(err, &exit) || exit.code != exitUsage):
+				t.Errorf("%s: err = %v, want it refused", path, err)
+			case !tt.outside && err != nil:
+				t.Errorf("%s: err = %v", path, err)
+			}
+
+			opts.allowOutside = true
+			if err := checkOutputName(tt.name, path, opts); err != nil {
+				t.Errorf("%s with --allow-outside: err = %v", path, err)
+			}
+		})
+	}
+}
+
+func TestWriteAnswerRefusesLinkOutside(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	t.Chdir(root)
+	if err := os.Mkdir("answers", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join("answers", "evil")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{outputFiles: []string{"answers/{model}/answer.md"}, answered: &answerStats{model: "evil"}}
+	if err := writeAnswer("hi", opts); err == nil {
+		t.Error("writeAnswer followed the link out of answers")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) > 0 {
+		t.Errorf("wrote %s outside", entries[0].Name())
+	}
+
+	opts.allowOutside = true
+	if err := writeAnswer("hi", opts); err != nil {
+		t.Fatalf("writeAnswer with --allow-outside: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outside, "answer.md")); err != nil || string(data) != "hi" {
+		t.Errorf("answer = %q, %v; want it written through the link", data, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// outputSink renders an answer for an -o file of a certain format.
+type outputSink func(answer string, opts *options) ([]byte, error)
+
+// outputSinks chooses the format of an -o file by its extension.
+var outputSinks = map[string]outputSink{
+	"":          plainOutput,
+	".txt":      plainOutput,
+	".text":     plainOutput,
+	".md":       plainOutput,
+	".markdown": plainOutput,
+	".html":     htmlOutput,
+	".htm":      htmlOutput,
+	".json":     jsonOutput,
+}
+
+// answerEnvelope is the content of a .json output file: the answer and
+// what is known about how it was produced.
+type answerEnvelope struct {
+	Answer           string   `json:"answer"`
+	Provider         Provider `json:"provider,omitempty"`
+	Model            string   `json:"model,omitempty"`
+	ElapsedMS        int64    `json:"elapsed_ms,omitempty"`
+	PromptTokens     int      `json:"prompt_tokens,omitempty"`
+	CompletionTokens int      `json:"completion_tokens,omitempty"`
+	CostUSD          float64  `json:"cost_usd,omitempty"`
+	Sources          []string `json:"sources,omitempty"`
+}
+
+// writeAnswer prints the answer, or writes it to every -o file in the
+// format of the file's extension. Files with an unknown extension get the
+// plain text. Names with placeholders are expanded, see expandOutputName,
+// and kept in their directory, see checkOutputName.
+func writeAnswer(answer string, opts *options) error {
+	if len(opts.outputFiles) == 0 {
+		fmt.Print(answer)
+		return nil
+	}
+	now := time.Now()
+	for _, name := range opts.outputFiles {
+		path, templated := expandOutputName(name, now, opts)
+		if err := checkOutputName(name, path, opts); err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		sink, ok := outputSinks[ext]
+		if !ok {
+			if opts.verbose {
+				notef("Writing %s as plain text: unknown extension %s\n", path, ext)
+			}
+			sink = plainOutput
+		}
+		data, err := sink(answer, opts)
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", path, err)
+		}
+		if templated {
+			written, err := createOutputFile(path, data)
+			if err != nil {
+				return fmt.Errorf("failed to write output file: %w", err)
+			}
+			if opts.verbose {
+				notef("Wrote %s\n", written)
+			}
+			continue
+		}
+		if err := writeOutputFile(path, data); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+	return nil
+}
+
+func plainOutput(answer string, opts *options) ([]byte, error) {
+	return []byte(answer), nil
+}
+
+// htmlOutput renders the Markdown of the answer as a standalone page.
+func htmlOutput(answer string, opts *options) ([]byte, error) {
+	return []byte(markdownPage(answer)), nil
+}
+
+func jsonOutput(answer string, opts *options) ([]byte, error) {
+	envelope := answerEnvelope{Answer: answer, Sources: opts.sources}
+	if s := opts.answered; s != nil {
+		envelope.Provider, envelope.Model = s.provider, s.model
+		envelope.ElapsedMS = s.elapsed.Milliseconds()
+		envelope.PromptTokens, envelope.CompletionTokens = s.promptTokens, s.completionTokens
+		envelope.CostUSD = s.cost
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false) // answers are full of code
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(envelope); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeOutput prints output, or writes it as is to every file in files.
+func writeOutput(output string, files []string) error {
+	if len(files) == 0 {
+		fmt.Print(output)
+		return nil
+	}
+	for _, path := range files {
+		if err := writeOutputFile(path, []byte(output)); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeOutputFile writes data to the -o file path. A regular file is
+// replaced at once, so a failure leaves the old one; a symlink to it is
+// kept and its mode too. Anything else, such as /dev/stdout or a FIFO,
+// can't be replaced and is written to as is.
+func writeOutputFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if _, err := os.Lstat(path); err == nil {
+			// a dangling symlink, whose target is created
+			return os.WriteFile(path, data, 0644)
+		}
+		return writeFileAtomic(path, data, 0644)
+	case err != nil:
+		return err
+	case !info.Mode().IsRegular():
+		return os.WriteFile(path, data, 0644)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(target, data, info.Mode().Perm())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdownHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"heading", "# Title", "<h1>Title</h1>\n"},
+		{"code block", "```go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}</code></pre>\n"},
+		{"list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"numbered list", "1. one\n2. two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"emphasis", "some *em* and **strong** and `code`", "<p>some <em>em</em> and <strong>strong</strong> and <code>code</code></p>\n"},
+		{"link", "[link](https://example.com)", "<p><a href=\"https://example.com\">link</a></p>\n"},
+		{"quote", "> quote", "<blockquote>\n<p>quote</p>\n</blockquote>\n"},
+		{"table", "| a | b |\n|---|---|\n| 1 | 2 |", "<table>\n<tr><th>a</th><th>b</th></tr>\n<tr><td>1</td><td>2</td></tr>\n</table>\n"},
+		{"escapes HTML", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownHTML(tt.markdown); got != tt.want {
+				t.Errorf("markdownHTML(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteAnswerFormats(t *testing.T) {
+	dir := t.TempDir()
+	answer := "# Binary search\n\nHalve the range until `lo > hi`.\n"
+	opts := &options{
+		outputFiles: []string{
+			filepath.Join(dir, "answer.md"),
+			filepath.Join(dir, "answer.txt"),
+			filepath.Join(dir, "answer.log"),
+			filepath.Join(dir, "answer.html"),
+			filepath.Join(dir, "answer.json"),
+		},
+		answered: &answerStats{provider: Ollama, model: "llama3.2", elapsed: 1500 * time.Millisecond, promptTokens: 12, completionTokens: 34},
+		sources:  []string{"https://example.com"},
+	}
+	if err := writeAnswer(answer, opts); err != nil {
+		t.Fatalf("writeAnswer: %v", err)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	// plain text, including extensions that are unknown
+	for _, name := range []string{"answer.md", "answer.txt", "answer.log"} {
+		if got := read(name); got != answer {
+			t.Errorf("%s = %q, want the plain answer", name, got)
+		}
+	}
+
+	page := read("answer.html")
+	for _, want := range []string{"<!DOCTYPE html>", "<h1>Binary search</h1>", "<code>lo &gt; hi</code>", "</html>"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("answer.html lacks %q", want)
+		}
+	}
+
+	var envelope answerEnvelope
+	if err := json.Unmarshal([]byte(read("answer.json")), &envelope); err != nil {
+		t.Fatalf("answer.json isn't valid JSON: %v", err)
+	}
+	want := answerEnvelope{
+		Answer: answer, Provider: Ollama, Model: "llama3.2", ElapsedMS: 1500,
+		PromptTokens: 12, CompletionTokens: 34, Sources: []string{"https://example.com"},
+	}
+	if envelope.Answer != want.Answer || envelope.Provider != want.Provider || envelope.Model != want.Model ||
+		envelope.ElapsedMS != want.ElapsedMS || envelope.PromptTokens != want.PromptTokens ||
+		envelope.CompletionTokens != want.CompletionTokens || strings.Join(envelope.Sources, ",") != "https://example.com" {
+		t.Errorf("answer.json = %+v, want %+v", envelope, want)
+	}
+	// code in answers isn't escaped for HTML
+	if strings.Contains(read("answer.json"), `\u003e`) {
+		t.Error("answer.json escapes > as \\u003e")
+	}
+}
+
+func TestJSONOutputWithoutStats(t *testing.T) {
+	data, err := jsonOutput("hi", &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields["answer"] != "hi" {
+		t.Errorf("envelope = %v, want only the answer", fields)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pluginPrefix starts the names of provider plugins on PATH: the
+	// program ai-cli-provider-<name> provides the provider <name>.
+	pluginPrefix = "ai-cli-provider-"
+	// pluginProtocolVersion is the version of the plugin protocol. It is
+	// sent with every call, and every reply must carry it too, so a plugin
+	// written for another version fails with a clear error instead of
+	// being misunderstood.
+	pluginProtocolVersion = 1
+	// defaultPluginTimeout bounds a call to a plugin without plugin_timeout.
+	defaultPluginTimeout = 2 * time.Minute
+)
+
+// pluginCall is the JSON a plugin gets on stdin, one per run of the
+// program. Op is "models", which lists the models, or "complete", which
+// answers the messages.
+type pluginCall struct {
+	Version     int             `json:"version"`
+	Op          string          `json:"op"`
+	Model       string          `json:"model,omitempty"`
+	Messages    []OpenAIMessage `json:"messages,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Format      *answerFormat   `json:"format,omitempty"`
+	// Stream asks for the answer in pieces, one reply per line.
+	Stream bool `json:"stream,omitempty"`
+}
+
+// pluginReply is the JSON a plugin writes to stdout. A complete call is
+// answered with one reply holding the whole answer or, when streaming,
+// with JSON lines holding a piece of it each, of which the last one has
+// Done set; the token counts and finish reason may come with any of them.
+type pluginReply struct {
+	Version          int      `json:"version"`
+	Error            string   `json:"error,omitempty"`
+	Models           []string `json:"models,omitempty"`
+	Content          string   `json:"content,omitempty"`
+	Done             bool     `json:"done,omitempty"`
+	FinishReason     string   `json:"finish_reason,omitempty"`
+	PromptTokens     int      `json:"prompt_tokens,omitempty"`
+	CompletionTokens int      `json:"completion_tokens,omitempty"`
+}
+
+// providerPlugins returns the programs of the provider plugins by name:
+// the ai-cli-provider-<name> programs on PATH, where the first one found
+// wins as with commands, and those in provider_plugins, which win over
+// PATH. Plugins can't replace the built-in providers. It reads every
+// directory on PATH, so it is only for listing the plugins; pluginPath
+// looks up a single one.
+var providerPlugins = sync.OnceValue(func() map[Provider]string {
+	plugins := make(map[Provider]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+			name = strings.TrimSuffix(name, ".exe")
+			provider := Provider(name)
+			if !ok || validatePluginName(name) != nil || plugins[provider] != "" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if _, err := exec.LookPath(path); err == nil {
+				plugins[provider] = path
+			}
+		}
+	}
+	for name, path := range configuredPlugins() {
+		plugins[Provider(name)] = expandHome(path)
+	}
+	return plugins
+})
+
+// pluginPaths caches the lookups of pluginPath, with "" for a provider
+// that isn't a plugin.
+var pluginPaths sync.Map
+
+// pluginPath returns the program of the plugin p, found the same way as
+// by providerPlugins but without reading every directory on PATH.
+func pluginPath(p Provider) (string, bool) {
+	if validatePluginName(string(p)) != nil {
+		return "", false
+	}
+	if path, ok := pluginPaths.Load(p); ok {
+		return path.(string), path != ""
+	}
+	path := ""
+	if configured, ok := configuredPlugins()[string(p)]; ok {
+		path = expandHome(configured)
+	} else if found, err := exec.LookPath(pluginPrefix + string(p)); err == nil {
+		path = found
+	}
+	pluginPaths.Store(p, path)
+	return path, path != ""
+}
+
+// configuredPlugins reads provider_plugins from the configuration file.
+// The configuration isn't loaded for it, since loading it checks the
+// provider of model references, which needs the plugins.
+func configuredPlugins() map[string]string {
+	if statelessMode() {
+		return nil
+	}
+	data, err := os.ReadFile(getConfigPath())
+	if err != nil {
+		return nil
+	}
+	var config struct {
+		ProviderPlugins map[string]string `json:"provider_plugins"`
+	}
+	if json.Unmarshal(data, &config) != nil || validateProviderPlugins(config.ProviderPlugins) != nil {
+		return nil
+	}
+	return config.ProviderPlugins
+}
+
+// validateProviderPlugins checks the names and programs in
+// provider_plugins.
+func validateProviderPlugins(plugins map[string]string) error {
+	for name, path := range plugins {
+		if err := validatePluginName(name); err != nil {
+			return fmt.Errorf("provider_plugins: %w", err)
+		}
+		if path == "" {
+			return fmt.Errorf("provider_plugins: plugin %s needs a program", name)
+		}
+	}
+	return nil
+}
+
+func validatePluginName(name string) error {
+	switch {
+	case name == "" || strings.ContainsAny(name, "/\\ "):
+		return fmt.Errorf("invalid plugin name '%s'", name)
+	case slices.Contains(knownProviders, Provider(name)):
+		return fmt.Errorf("plugin name %s is taken by a built-in provider", name)
+	}
+	return nil
+}
+
+// pluginNames returns the names of the provider plugins, sorted.
+func pluginNames() []Provider {
+	return slices.Sorted(maps.Keys(providerPlugins()))
+}
+
+// allProviders returns the built-in providers followed by the plugins.
+func allProviders() []Provider {
+	return append(slices.Clone(knownProviders), pluginNames()...)
+}
+
+// isPlugin reports whether the provider is a plugin.
+func (p Provider) isPlugin() bool {
+	_, ok := pluginPath(p)
+	return ok
+}
+
+// pluginTimeout returns the configured time a call to a plugin may take.
+func pluginTimeout() time.Duration {
+	config, err := loadConfigOrDefault()
+	if err != nil || config.PluginTimeout <= 0 {
+		return defaultPluginTimeout
+	}
+	return time.Duration(config.PluginTimeout) * time.Second
+}
+
+// listPluginModels asks a plugin for its models. It is bounded by
+// providerListTimeout, since it runs whenever the models are listed.
+func listPluginModels(provider Provider) ([]string, error) {
+	var models []string
+	err := runPlugin(provider, pluginCall{Op: "models"}, min(pluginTimeout(), providerListTimeout), nil, func(reply pluginReply) {
+		models = append(models, reply.Models...)
+	})
+	return models, err
+}
+
+// executePlugin has a plugin answer req, streaming the answer to target
+// if set.
+func executePlugin(req *chatRequest, target *streamTarget) (*completion, error) {
+	if len(req.Tools) > 0 {
+		return nil, &exitError{code: exitUsage, err: fmt.Errorf("provider plugins can't use tools")}
+	}
+	call := pluginCall{
+		Op:          "complete",
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Format:      req.Format,
+		Stream:      target != nil,
+	}
+	if target != nil {
+		target.thinking.begin()
+		defer target.thinking.end()
+	}
+
+	result := &completion{}
+	var content strings.Builder
+	err := runPlugin(req.Provider, call, pluginTimeout(), target, func(reply pluginReply) {
+		if reply.Content != "" {
+			content.WriteString(reply.Content)
+			if target != nil {
+				target.thinking.answer()
+				io.WriteString(target.w, reply.Content)
+			}
+		}
+		if reply.FinishReason != "" {
+			result.FinishReason = finishReason(reply.FinishReason)
+			result.RawFinishReason = reply.FinishReason
+		}
+		result.PromptTokens = max(result.PromptTokens, reply.PromptTokens)
+		result.CompletionTokens = max(result.CompletionTokens, reply.CompletionTokens)
+	})
+	// with a stalled stream, the answer so far is kept
+	result.Content = content.String()
+	return result, err
+}
+
+// runPlugin runs the program of a plugin with call on stdin and hands
+// every reply it writes to handle. The program is killed after timeout, or
+// when streaming to target, after target's idle timeout without output.
+func runPlugin(provider Provider, call pluginCall, timeout time.Duration, target *streamTarget, handle func(pluginReply)) error {
+	path, ok := pluginPath(provider)
+	if !ok {
+		return fmt.Errorf("unknown provider: %s", provider)
+	}
+	call.Version = pluginProtocolVersion
+	input, err := json.Marshal(call)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run plugin %s: %w", provider, err)
+	}
+
+	var out io.Reader = stdout
+	var body *idleReader
+	if target != nil {
+		body = newIdleReader(stdout, target.idleTimeout, cancel)
+		defer body.stop()
+		out = body
+	}
+	done, readErr := readPluginReplies(provider, out, call, handle)
+	if readErr != nil {
+		// the rest of the output is of no use
+		cancel()
+	}
+	waitErr := cmd.Wait()
+
+	switch {
+	case body != nil && body.stalled.Load():
+		return body.truncated()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return apiError(provider, 0, "plugin %s timed out after %s; raise plugin_timeout if it needs longer", provider, timeout)
+	case readErr != nil:
+		return readErr
+	case waitErr != nil:
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = waitErr.Error()
+		}
+		return apiError(provider, 0, "plugin %s failed: %s", provider, message)
+	case !done && call.Stream:
+		return apiError(provider, 0, "plugin %s ended the stream without a reply with done set", provider)
+	case !done:
+		return apiError(provider, 0, "plugin %s wrote no reply", provider)
+	}
+	return nil
+}
+
+// readPluginReplies decodes the replies of a plugin until the last one:
+// the only one, or when streaming, the one with Done set. It reports
+// whether that arrived. Since the replies are decoded as a JSON stream,
+// one may span several lines.
+func readPluginReplies(provider Provider, out io.Reader, call pluginCall, handle func(pluginReply)) (done bool, err error) {
+	decoder := json.NewDecoder(out)
+	for !done {
+		var reply pluginReply
+		if err := decoder.Decode(&reply); err == io.EOF {
+			break
+		} else if err != nil {
+			return false, apiError(provider, 0, "plugin %s wrote invalid JSON: %v", provider, err)
+		}
+		if reply.Version != pluginProtocolVersion {
+			return false, apiError(provider, 0, "plugin %s speaks protocol version %d, but ai-cli speaks version %d", provider, reply.Version, pluginProtocolVersion)
+		}
+		if reply.Error != "" {
+			return false, apiError(provider, 0, "plugin %s: %s", provider, reply.Error)
+		}
+		handle(reply)
+		done = reply.Done || !call.Stream
+	}
+	return done, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPluginPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	program := filepath.Join(dir, pluginPrefix+"pathtest")
+	if err := os.WriteFile(program, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pluginPrefix+"notexecutable"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	configured := filepath.Join(t.TempDir(), "plugin")
+	if err := saveConfig(&Config{ProviderPlugins: map[string]string{"configuredtest": configured}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		provider Provider
+		want     string
+	}{
+		{"pathtest", program},
+		{"configuredtest", configured},
+		{"notexecutable", ""},
+		{"missingtest", ""},
+		{OpenAI, ""},
+		{"../pathtest", ""},
+	}
+	for _, test := range tests {
+		path, ok := pluginPath(test.provider)
+		if path != test.want || ok != (test.want != "") {
+			t.Errorf("pluginPath(%q) = %q, %v, want %q", test.provider, path, ok, test.want)
+		}
+		if got := test.provider.isPlugin(); got != (test.want != "") {
+			t.Errorf("%q.isPlugin() = %v", test.provider, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	progressBarWidth = 24
+	// progressLogInterval is how often a plain progress line is printed when
+	// stderr is not a terminal.
+	progressLogInterval = 10 * time.Second
+)
+
+// progress renders a progress bar on stderr for long batch runs. On a
+// terminal it is redrawn in place; otherwise a plain line is printed
+// periodically.
+type progress struct {
+	mu       sync.Mutex
+	total    int
+	done     int
+	cost     float64
+	start    time.Time
+	tty      bool
+	drawn    bool
+	lastLine time.Time
+	signals  chan os.Signal
+}
+
+var (
+	activeProgressMu sync.Mutex
+	activeProgress   *progress
+)
+
+// notef prints a message to stderr without garbling an active progress bar.
+func notef(format string, args ...any) {
+	activeProgressMu.Lock()
+	p := activeProgress
+	activeProgressMu.Unlock()
+
+	if p == nil {
+		fmt.Fprintf(os.Stderr, format, args...)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(os.Stderr, format, args...)
+	p.draw()
+}
+
+// startProgress shows a progress bar for total items until finish is called.
+// An interrupt removes the bar before the process exits.
+func startProgress(total int) *progress {
+	p := &progress{
+		total:   total,
+		start:   time.Now(),
+		tty:     isTerminal(os.Stderr),
+		signals: make(chan os.Signal, 1),
+	}
+
+	activeProgressMu.Lock()
+	activeProgress = p
+	activeProgressMu.Unlock()
+
+	signal.Notify(p.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-p.signals; ok {
+			p.mu.Lock()
+			p.clear()
+			fmt.Fprintf(os.Stderr, "Interrupted after %d of %d items\n", p.done, p.total)
+			os.Exit(exitInterrupted)
+		}
+	}()
+
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+	return p
+}
+
+// complete marks one item as done and adds its estimated cost.
+func (p *progress) complete(cost float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.cost += cost
+	p.draw()
+}
+
+// finish removes the bar; without a terminal a final line is printed.
+func (p *progress) finish() {
+	signal.Stop(p.signals)
+	close(p.signals)
+
+	activeProgressMu.Lock()
+	activeProgress = nil
+	activeProgressMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		p.clear()
+	} else if p.total > 0 {
+		fmt.Fprintln(os.Stderr, p.line())
+	}
+}
+
+// draw must be called with p.mu held.
+func (p *progress) draw() {
+	if p.total == 0 {
+		return
+	}
+	if !p.tty {
+		if time.Since(p.lastLine) >= progressLogInterval && p.done > 0 && p.done < p.total {
+			fmt.Fprintln(os.Stderr, p.line())
+			p.lastLine = time.Now()
+		}
+		return
+	}
+
+	filled := progressBarWidth * p.done / p.total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r\033[K[%s] %s", bar, p.line())
+	p.drawn = true
+}
+
+// clear must be called with p.mu held.
+func (p *progress) clear() {
+	if p.tty && p.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// line formats the counters, throughput, cost and ETA.
+func (p *progress) line() string {
+	elapsed := time.Since(p.start)
+	parts := []string{fmt.Sprintf("%d/%d", p.done, p.total)}
+
+	if p.done > 0 {
+		perMinute := float64(p.done) / elapsed.Minutes()
+		parts = append(parts, fmt.Sprintf("%.1f req/min", perMinute))
+	}
+	if p.cost > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", p.cost))
+	}
+	if p.done > 0 && p.done < p.total {
+		eta := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// purgeTarget is a kind of local state that purge deletes, selected with
+// --<name>.
+type purgeTarget struct {
+	name  string
+	paths func() []string
+}
+
+// purgeTargets are in the order they are listed. --all selects all of
+// them except the configuration.
+var purgeTargets = []purgeTarget{
+	{"history", func() []string { return []string{getLastRequestPath()} }},
+	{"sessions", func() []string { return []string{filepath.Join(getStateDir(), sessionsDirName)} }},
+	{"cache", func() []string {
+		limits, _ := filepath.Glob(filepath.Join(getStateDir(), "ratelimit-*.json"))
+		return append([]string{filepath.Join(getStateDir(), "cache")}, limits...)
+	}},
+	{"usage", func() []string { return []string{getUsageLogPath()} }},
+	{"config", func() []string { return []string{getConfigPath()} }},
+}
+
+// purgeCommand deletes local state, e.g. on a shared machine: ai-cli purge
+// --history --sessions --cache --usage, or --all for those four, plus
+// --config for the configuration. It lists what will be deleted with the
+// sizes and asks first, unless --yes is given; --dry-run only lists.
+func purgeCommand(args []string, opts *options) error {
+	selected := make(map[string]bool)
+	for _, arg := range args {
+		name := strings.TrimPrefix(arg, "--")
+		switch {
+		case arg == "--all":
+			for _, target := range purgeTargets {
+				if target.name != "config" {
+					selected[target.name] = true
+				}
+			}
+		case strings.HasPrefix(arg, "--") && slices.ContainsFunc(purgeTargets, func(t purgeTarget) bool { return t.name == name }):
+			selected[name] = true
+		default:
+			return &exitError{code: exitUsage, err: fmt.Errorf("unknown purge flag: %s", arg)}
+		}
+	}
+	if len(selected) == 0 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("usage: ai-cli purge [--history] [--sessions] [--cache] [--usage] [--all] [--config] [--dry-run] [--yes]")}
+	}
+
+	type found struct {
+		target string
+		path   string
+		files  int
+		size   int64
+	}
+	var paths []found
+	for _, target := range purgeTargets {
+		if !selected[target.name] {
+			continue
+		}
+		for _, path := range target.paths() {
+			if files, size, ok := stateSize(path); ok && files > 0 {
+				paths = append(paths, found{target.name, path, files, size})
+			}
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Println("Nothing to delete.")
+		return nil
+	}
+
+	fmt.Println("Will delete:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var total int64
+	for _, p := range paths {
+		files := ""
+		if p.files != 1 {
+			files = fmt.Sprintf(" (%d files)", p.files)
+		}
+		fmt.Fprintf(w, "  %s\t%s%s\t%s\n", p.target, p.path, files, formatBytes(int(p.size)))
+		total += p.size
+	}
+	w.Flush()
+	if opts.dryRun {
+		fmt.Printf("Dry run: %s would be deleted.\n", formatBytes(int(total)))
+		return nil
+	}
+
+	if !opts.yes {
+		tty, err := openTerminal()
+		if err != nil || !isTerminal(os.Stderr) {
+			return &exitError{code: exitUsage, err: fmt.Errorf("nothing was deleted; use --yes to delete without a terminal to confirm on")}
+		}
+		defer tty.Close()
+		notef("Delete %s? [y/N]: ", formatBytes(int(total)))
+		answer, _ := bufio.NewReader(tty).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return fmt.Errorf("cancelled, nothing was deleted")
+		}
+	}
+
+	for _, p := range paths {
+		if err := os.RemoveAll(p.path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", p.path, err)
+		}
+		os.Remove(p.path + ".lock") // see withFileLock
+	}
+	fmt.Printf("Deleted %s.\n", formatBytes(int(total)))
+	if selected["cache"] {
+		if client, _ := connectDaemon(); client != nil {
+			notef("The daemon keeps recent answers in memory until it is stopped: ai-cli daemon stop\n")
+		}
+	}
+	return nil
+}
+
+// stateSize returns the number of files at path, a file or a directory,
+// and their total size, and false if there is nothing at path.
+func stateSize(path string) (files int, size int64, ok bool) {
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	return files, size, err == nil
+}
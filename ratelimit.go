@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RateLimit limits how fast requests are sent to a cloud provider. Zero
+// values disable the respective limit.
+type RateLimit struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"`
+}
+
+// rateLimitState holds the two token buckets. It is shared by all ai-cli
+// processes through a small state file per provider.
+type rateLimitState struct {
+	Requests float64   `json:"requests"`
+	Tokens   float64   `json:"tokens"`
+	Updated  time.Time `json:"updated"`
+}
+
+func getRateLimitPath(provider Provider) string {
+	return filepath.Join(getStateDir(), fmt.Sprintf("ratelimit-%s.json", provider))
+}
+
+// waitForRateLimit blocks until the provider's buckets allow a request with
+// the estimated number of tokens, printing a note whenever it has to wait.
+// Requests to local providers are not limited.
+func waitForRateLimit(limit *RateLimit, provider Provider, tokens int) error {
+	if limit == nil || provider.isLocal() || (limit.RequestsPerMinute <= 0 && limit.TokensPerMinute <= 0) {
+		return nil
+	}
+
+	// a single request larger than the per-minute budget would never fit
+	if limit.TokensPerMinute > 0 {
+		tokens = min(tokens, limit.TokensPerMinute)
+	}
+
+	path := getRateLimitPath(provider)
+	for {
+		var wait time.Duration
+		err := withFileLock(path, func() error {
+			state := loadRateLimitState(path, limit)
+			state.refill(limit, time.Now())
+
+			wait = state.waitTime(limit, tokens)
+			if wait == 0 {
+				if limit.RequestsPerMinute > 0 {
+					state.Requests--
+				}
+				if limit.TokensPerMinute > 0 {
+					state.Tokens -= float64(tokens)
+				}
+			}
+
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			return writeFileAtomic(path, data, 0600)
+		})
+		if err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+		if wait == 0 {
+			return nil
+		}
+
+		notef("Rate limit reached, waiting %.1fs...\n", wait.Seconds())
+		time.Sleep(wait)
+	}
+}
+
+// loadRateLimitState reads the buckets, starting with full buckets if there
+// is no usable state yet.
+func loadRateLimitState(path string, limit *RateLimit) *rateLimitState {
+	full := &rateLimitState{
+		Requests: float64(limit.RequestsPerMinute),
+		Tokens:   float64(limit.TokensPerMinute),
+		Updated:  time.Now(),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return full
+	}
+	var state rateLimitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return full
+	}
+	return &state
+}
+
+// refill adds the capacity that accrued since the last update.
+func (s *rateLimitState) refill(limit *RateLimit, now time.Time) {
+	elapsed := now.Sub(s.Updated).Minutes()
+	if elapsed > 0 {
+		s.Requests = min(s.Requests+elapsed*float64(limit.RequestsPerMinute), float64(limit.RequestsPerMinute))
+		s.Tokens = min(s.Tokens+elapsed*float64(limit.TokensPerMinute), float64(limit.TokensPerMinute))
+	}
+	s.Updated = now
+}
+
+// waitTime returns how long to wait until a request with tokens fits into
+// both buckets, or 0 if it fits now.
+func (s *rateLimitState) waitTime(limit *RateLimit, tokens int) time.Duration {
+	var wait float64 // minutes
+	if limit.RequestsPerMinute > 0 && s.Requests < 1 {
+		wait = max(wait, (1-s.Requests)/float64(limit.RequestsPerMinute))
+	}
+	if limit.TokensPerMinute > 0 && s.Tokens < float64(tokens) {
+		wait = max(wait, (float64(tokens)-s.Tokens)/float64(limit.TokensPerMinute))
+	}
+	return time.Duration(wait * float64(time.Minute))
+}
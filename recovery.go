@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// modelUnavailableError reports that a provider doesn't (or no longer) offer
+// the requested model, e.g. a retired OpenAI model or an Ollama model that
+// was removed with "ollama rm".
+type modelUnavailableError struct {
+	provider Provider
+	model    string
+	reason   string
+}
+
+func (e *modelUnavailableError) Error() string {
+	return fmt.Sprintf("model '%s' is not available from %s: %s", e.model, e.provider, strings.TrimSuffix(e.reason, "."))
+}
+
+// recoverUnavailableModel explains why the model is unavailable and what
+// could be used instead. In a terminal it offers to pick a new model and
+// re-sends the request with it.
+func recoverUnavailableModel(req *chatRequest, unavailable *modelUnavailableError, opts *options, stream *streamTarget) (*completion, error) {
+	alternatives := modelAlternatives(unavailable.provider)
+
+	switch unavailable.provider {
+	case Ollama:
+		fmt.Fprintf(os.Stderr, "Model '%s' is not installed in Ollama (was it removed with 'ollama rm'?).\n", unavailable.model)
+		fmt.Fprintf(os.Stderr, "Reinstall it with: ollama pull %s\n", unavailable.model)
+		if len(alternatives) > 0 {
+			fmt.Fprintf(os.Stderr, "Installed models: %s\n", strings.Join(alternatives, ", "))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Model '%s' is no longer available from %s: %s\n", unavailable.model, unavailable.provider, unavailable.reason)
+		if len(alternatives) > 0 {
+			fmt.Fprintf(os.Stderr, "Available replacements: %s\n", strings.Join(alternatives, ", "))
+		}
+	}
+
+	if !isInteractive() {
+		return nil, fmt.Errorf("%w. Please run 'ai-cli set-model'", unavailable)
+	}
+
+	fmt.Fprint(os.Stderr, "Choose a different model now? [Y/n]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "" && answer != "y" && answer != "yes" {
+		return nil, unavailable
+	}
+
+	if err := setModelCommand(nil); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr)
+
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOffline(config, opts, config.Provider); err != nil {
+		return nil, err
+	}
+	req.Provider, req.Model = config.Provider, config.Model
+	return executeRequest(req, stream)
+}
+
+// modelAlternatives lists the models a user could switch to. For OpenAI the
+// list is fetched from the API, since retired models disappear from it, and
+// falls back to the built-in list.
+func modelAlternatives(provider Provider) []string {
+	if provider.isPlugin() {
+		models, _ := listPluginModels(provider)
+		return models
+	}
+	switch provider {
+	case Ollama:
+		models, _ := getInstalledModels()
+		return models
+	case LMStudio:
+		models, _ := listLMStudioModels()
+		return models
+	case OpenAI:
+		accessible, err := fetchOpenAIModels()
+		if err != nil {
+			return getOpenAIModels()
+		}
+		var alternatives []string
+		for _, model := range getOpenAIModels() {
+			if slices.Contains(accessible, model) {
+				alternatives = append(alternatives, model)
+			}
+		}
+		if len(alternatives) == 0 {
+			for _, model := range accessible {
+				if strings.HasPrefix(model, "gpt-") {
+					alternatives = append(alternatives, model)
+				}
+			}
+		}
+		return alternatives
+	}
+	return nil
+}
+
+// fetchOpenAIModels returns the ids of all models the API key can access.
+func fetchOpenAIModels() ([]string, error) {
+	req, err := http.NewRequest("GET", openAIBaseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing models: %s", resp.Status)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// providerKeyEnv names the environment variable holding the API key of each
+// provider that needs one.
+var providerKeyEnv = map[Provider]string{
+	OpenAI: "OPENAI_API_KEY",
+}
+
+// checkProviderKey catches a missing API key before anything is sent, e.g.
+// in a new shell without the key. In a terminal with local models installed
+// it offers to send the prompt to one of them instead, or to choose a new
+// default model; req is changed accordingly.
+func checkProviderKey(req *chatRequest, opts *options) error {
+	env, ok := providerKeyEnv[req.Provider]
+	if !ok || os.Getenv(env) != "" {
+		return nil
+	}
+	missing := fmt.Errorf("%s is not set, but the model is %s/%s: export %s or choose another model with 'ai-cli set-model'",
+		env, req.Provider, req.Model, env)
+
+	local, _ := getInstalledModels()
+	if !isInteractive() || opts.batch || len(local) == 0 {
+		return missing
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is not set, so %s/%s can't be used.\n", env, req.Provider, req.Model)
+	fmt.Fprintln(os.Stderr, "  1. Send this prompt to a local Ollama model")
+	fmt.Fprintln(os.Stderr, "  2. Choose a new default model")
+	fmt.Fprint(os.Stderr, "Choice [1-2, anything else cancels]: ")
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+
+	switch strings.TrimSpace(answer) {
+	case "1":
+		model := local[0]
+		if len(local) > 1 {
+			for i, name := range local {
+				fmt.Fprintf(os.Stderr, "  %d. %s\n", i+1, name)
+			}
+			fmt.Fprintf(os.Stderr, "Local model [1-%d]: ", len(local))
+			input, _ := reader.ReadString('\n')
+			var choice int
+			fmt.Sscanf(strings.TrimSpace(input), "%d", &choice)
+			if choice < 1 || choice > len(local) {
+				return fmt.Errorf("invalid choice")
+			}
+			model = local[choice-1]
+		}
+		req.Provider, req.Model = Ollama, model
+	case "2":
+		if err := setModelCommand(nil); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr)
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		req.Provider, req.Model = config.Provider, config.Model
+	default:
+		return missing
+	}
+	return checkProviderKey(req, opts)
+}
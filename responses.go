@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The OpenAI Responses API (/v1/responses) is used instead of chat
+// completions with "openai_api": "responses". It takes the conversation as
+// input items and returns output items.
+
+type ResponsesRequest struct {
+	Model       string              `json:"model"`
+	Input       []responsesItem     `json:"input"`
+	Temperature *float64            `json:"temperature,omitempty"`
+	MaxTokens   int                 `json:"max_output_tokens,omitempty"`
+	Tools       []responsesTool     `json:"tools,omitempty"`
+	Stream      bool                `json:"stream,omitempty"`
+	Text        *responsesText      `json:"text,omitempty"`
+	Reasoning   *responsesReasoning `json:"reasoning,omitempty"`
+	Metadata    map[string]string   `json:"metadata,omitempty"`
+	User        string              `json:"user,omitempty"`
+}
+
+// responsesReasoning asks reasoning models for a summary of their
+// reasoning, see --show-thinking.
+type responsesReasoning struct {
+	Summary string `json:"summary"`
+}
+
+// responsesText configures the text output, e.g. as JSON.
+type responsesText struct {
+	Format any `json:"format"`
+}
+
+// responsesItem is a message, a function call of the model or the output
+// of such a call.
+type responsesItem struct {
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"` // a string in input, content parts in output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// responsesTool is a function tool in the flat format of the Responses API,
+// or a hosted tool such as web search.
+type responsesTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type ResponsesResponse struct {
+	Output []struct {
+		Type    string `json:"type"`
+		CallID  string `json:"call_id"`
+		Name    string `json:"name"`
+		Args    string `json:"arguments"`
+		Content []struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			Refusal     string `json:"refusal"`
+			Annotations []struct {
+				Type string `json:"type"`
+				URL  string `json:"url"`
+			} `json:"annotations"`
+		} `json:"content"`
+	} `json:"output"`
+	Status string `json:"status"` // "completed" or "incomplete"
+	Usage  struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+	} `json:"usage"`
+	// IncompleteDetails tells why an incomplete response stopped.
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	} `json:"error,omitempty"`
+}
+
+// ResponsesEvent is one server-sent event of a streamed response.
+type ResponsesEvent struct {
+	Type     string             `json:"type"`
+	Delta    string             `json:"delta"`
+	Response *ResponsesResponse `json:"response,omitempty"`
+	Message  string             `json:"message"` // of "error" events
+}
+
+// useResponsesAPI reports whether OpenAI requests go to the Responses API.
+func useResponsesAPI() bool {
+	config, err := loadConfigOrDefault()
+	return err == nil && config.OpenAIAPI == "responses"
+}
+
+// toResponsesInput converts chat messages into input items.
+func toResponsesInput(messages []OpenAIMessage) []responsesItem {
+	var items []responsesItem
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "tool":
+			items = append(items, responsesItem{Type: "function_call_output", CallID: msg.ToolCallID, Output: msg.Content})
+		case len(msg.ToolCalls) > 0:
+			if msg.Content != "" {
+				items = append(items, responsesItem{Role: msg.Role, Content: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				items = append(items, responsesItem{Type: "function_call", CallID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+			}
+		default:
+			items = append(items, responsesItem{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	return items
+}
+
+func toResponsesTools(tools []toolDefinition) []responsesTool {
+	var converted []responsesTool
+	for _, tool := range tools {
+		converted = append(converted, responsesTool{
+			Type:        "function",
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	return converted
+}
+
+// completion extracts the output text, function calls and cited URLs.
+func (r *ResponsesResponse) completion() *completion {
+	result := &completion{
+		PromptTokens:     r.Usage.InputTokens,
+		CachedTokens:     r.Usage.InputTokensDetails.CachedTokens,
+		CompletionTokens: r.Usage.OutputTokens,
+		RawFinishReason:  r.Status,
+	}
+	if r.IncompleteDetails != nil {
+		result.FinishReason = finishReason(r.IncompleteDetails.Reason)
+		result.RawFinishReason = r.IncompleteDetails.Reason
+	}
+	var text strings.Builder
+	for _, item := range r.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				if part.Type == "refusal" {
+					result.Refusal += part.Refusal
+				}
+				if part.Type != "output_text" {
+					continue
+				}
+				text.WriteString(part.Text)
+				for _, annotation := range part.Annotations {
+					if annotation.Type == "url_citation" {
+						result.Citations = append(result.Citations, annotation.URL)
+					}
+				}
+			}
+		case "function_call":
+			call := toolCall{ID: item.CallID, Type: "function"}
+			call.Function.Name, call.Function.Arguments = item.Name, item.Args
+			result.ToolCalls = append(result.ToolCalls, call)
+		}
+	}
+	result.Content = text.String()
+	return result
+}
+
+// responsesError converts an API error into the errors used for chat
+// completions.
+func responsesError(model string, status int, code, message string) error {
+	if code == "model_not_found" {
+		return &modelUnavailableError{provider: OpenAI, model: model, reason: message}
+	}
+	return apiError(OpenAI, status, "OpenAI API error: %s", message)
+}
+
+// executeOpenAIResponses sends req to the Responses API. With a stream
+// target the output text is copied to it as the events arrive.
+func executeOpenAIResponses(chatReq *chatRequest, target *streamTarget) (*completion, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+
+	reqBody := ResponsesRequest{
+		Model:       chatReq.Model,
+		Input:       toResponsesInput(chatReq.Messages),
+		Temperature: chatReq.Temperature,
+		MaxTokens:   chatReq.MaxTokens,
+		Tools:       toResponsesTools(chatReq.Tools),
+		Stream:      target != nil,
+		Text:        chatReq.Format.responses(),
+		Metadata:    openAIMetadata(chatReq.Tags),
+		User:        chatReq.User,
+	}
+	if chatReq.Think {
+		reqBody.Reasoning = &responsesReasoning{Summary: "auto"}
+	}
+	if chatReq.WebSearch {
+		reqBody.Tools = append(reqBody.Tools, responsesTool{Type: "web_search"})
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL+"/responses", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || target == nil {
+		var response ResponsesResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			if resp.StatusCode != http.StatusOK {
+				return nil, apiError(OpenAI, resp.StatusCode, "OpenAI API error: %s", resp.Status)
+			}
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if response.Error != nil {
+			return nil, responsesError(chatReq.Model, resp.StatusCode, response.Error.Code, response.Error.Message)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, apiError(OpenAI, resp.StatusCode, "OpenAI API error: %s", resp.Status)
+		}
+		return response.completion(), nil
+	}
+
+	body := newIdleReader(resp.Body, target.idleTimeout, cancel)
+	defer body.stop()
+	target.thinking.begin()
+	defer target.thinking.end()
+
+	result := &completion{}
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event ResponsesEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		switch event.Type {
+		case "response.reasoning_summary_text.delta":
+			target.thinking.reasoning(event.Delta)
+		case "response.output_text.delta":
+			target.thinking.answer()
+			content.WriteString(event.Delta)
+			io.WriteString(target.w, event.Delta)
+		case "response.completed", "response.incomplete":
+			if event.Response != nil {
+				result = event.Response.completion()
+			}
+		case "response.failed":
+			if event.Response != nil && event.Response.Error != nil {
+				return nil, responsesError(chatReq.Model, 0, event.Response.Error.Code, event.Response.Error.Message)
+			}
+			return nil, fmt.Errorf("OpenAI API error: response failed")
+		case "error":
+			return nil, fmt.Errorf("OpenAI API error: %s", event.Message)
+		}
+	}
+	result.Content = content.String()
+	return result, streamError(scanner.Err(), body, target)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lastRequestFileName = "last-request.json"
+	// maxLastRequestBytes caps the message content kept for "retry", so a
+	// huge piped input isn't duplicated into the state directory.
+	maxLastRequestBytes = 1 << 20
+)
+
+// lastRequest is the persisted state of the most recent request.
+type lastRequest struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Request *chatRequest `json:"request,omitempty"`
+	// Size is the total message size. If it exceeds maxLastRequestBytes the
+	// messages are not stored and Request is nil.
+	Size     int      `json:"size"`
+	Provider Provider `json:"provider"`
+	Model    string   `json:"model"`
+}
+
+func getLastRequestPath() string {
+	return filepath.Join(getStateDir(), lastRequestFileName)
+}
+
+func saveLastRequest(req *chatRequest) error {
+	if stateDisabled() {
+		return nil
+	}
+	size := 0
+	for _, msg := range req.Messages {
+		size += len(msg.Content)
+	}
+
+	state := lastRequest{
+		SavedAt:  time.Now(),
+		Size:     size,
+		Provider: req.Provider,
+		Model:    req.Model,
+	}
+	if size <= maxLastRequestBytes {
+		state.Request = req
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(getLastRequestPath(), data, 0600)
+}
+
+func loadLastRequest() (*lastRequest, error) {
+	if stateDisabled() {
+		return nil, errNoState
+	}
+	data, err := os.ReadFile(getLastRequestPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no previous request to retry")
+		}
+		return nil, err
+	}
+
+	var state lastRequest
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse last request: %w", err)
+	}
+	return &state, nil
+}
+
+// retryCommand re-sends the last request, optionally with --model and
+// --temperature overrides.
+func retryCommand(args []string, opts *options) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ai-cli retry [--model <model>] [--temperature <t>]")
+	}
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	return resendLastRequest(config, opts.model(), "--model flag", opts)
+}
+
+// escalateCommand re-sends the last request to the configured
+// escalation_model, typically a bigger model than the one that gave a bad
+// answer.
+func escalateCommand(args []string, opts *options) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ai-cli escalate [--temperature <t>]")
+	}
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	if config.EscalationModel == "" {
+		return fmt.Errorf(`no escalation model configured: add e.g. "escalation_model": "openai/gpt-5.2" to %s`, getConfigPath())
+	}
+
+	state, err := loadLastRequest()
+	if err != nil {
+		return err
+	}
+	if provider, model := config.resolveModel(config.EscalationModel); state.Provider == provider && state.Model == model {
+		return fmt.Errorf("the last request already went to the escalation model [%s] %s; use 'ai-cli retry' to send it again", provider, model)
+	}
+	return resendLastRequest(config, config.EscalationModel, "escalation_model", opts)
+}
+
+// resendLastRequest sends the last request again, to the model spec if
+// given (with source describing where it came from) and with the
+// --temperature override.
+func resendLastRequest(config *Config, spec, specSource string, opts *options) error {
+	state, err := loadLastRequest()
+	if err != nil {
+		return err
+	}
+	if state.Request == nil {
+		return fmt.Errorf("the last request (%d KB) was larger than the %d KB retry limit and was not stored; please run it again manually",
+			state.Size/1024, maxLastRequestBytes/1024)
+	}
+
+	req := state.Request
+	source := "last request"
+	if spec != "" {
+		source = specSource
+		if provider, model := config.resolveModel(spec); provider != "" {
+			req.Provider, req.Model = provider, model
+		} else {
+			req.Model = model
+		}
+	}
+	if opts.temperature != nil {
+		req.Temperature = opts.temperature
+	}
+	if opts.maxTokens > 0 {
+		req.MaxTokens = opts.maxTokens
+	}
+
+	if opts.dryRun {
+		printDryRun(req, source)
+		return nil
+	}
+
+	start := time.Now()
+	result, err := sendRequest(req, opts)
+	if result == nil {
+		return deliver("", err, opts)
+	}
+	opts.answered = newAnswerStats(req, result, source, time.Since(start))
+	return deliver(result.Content, err, opts)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ollamaCreateTimeout = 5 * time.Minute
+
+// rolesCommand manages roles. "bake" builds a derived Ollama model with the
+// role's system prompt built in.
+func rolesCommand(args []string, opts *options) error {
+	if len(args) == 0 || args[0] != "bake" {
+		return fmt.Errorf("usage: ai-cli roles bake <role> [--base <ollama model>] [--remove]")
+	}
+
+	name, base := "", ""
+	remove := false
+	rest := args[1:]
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case "--remove":
+			remove = true
+		case "--base":
+			if i+1 >= len(rest) {
+				return fmt.Errorf("--base flag requires a model")
+			}
+			base = rest[i+1]
+			i++
+		default:
+			if name != "" {
+				return fmt.Errorf("usage: ai-cli roles bake <role> [--base <ollama model>] [--remove]")
+			}
+			name = rest[i]
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("usage: ai-cli roles bake <role> [--base <ollama model>] [--remove]")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	role, ok := config.Roles[name]
+	if !ok {
+		return fmt.Errorf("unknown role: %s (see 'ai-cli tpl list')", name)
+	}
+
+	if remove {
+		return unbakeRole(config, name, role)
+	}
+	return bakeRole(config, name, role, base, opts)
+}
+
+// bakedModelName is the name of the Ollama model derived for a role.
+func bakedModelName(role string) string {
+	return "ai-cli-" + strings.ToLower(role)
+}
+
+// bakedAlias is the alias registered for a baked role.
+func bakedAlias(role string) string {
+	return "role-" + role
+}
+
+// bakeBase returns the Ollama model a role is baked from: --base, the
+// role's own model or the configured default, whichever is an Ollama model.
+func bakeBase(config *Config, role Role, base string) (string, error) {
+	for _, spec := range []string{base, role.Model} {
+		if spec == "" {
+			continue
+		}
+		provider, model := config.resolveModel(spec)
+		if provider == "" {
+			provider = Ollama
+		}
+		if provider != Ollama {
+			return "", fmt.Errorf("%s is not an Ollama model", spec)
+		}
+		return model, nil
+	}
+	if config.Provider != Ollama {
+		return "", fmt.Errorf("the default model is not an Ollama model, use --base <model>")
+	}
+	return config.Model, nil
+}
+
+func bakeRole(config *Config, name string, role Role, base string, opts *options) error {
+	base, err := bakeBase(config, role, base)
+	if err != nil {
+		return err
+	}
+	if err := checkOffline(config, opts, Ollama); err != nil {
+		return err
+	}
+
+	model := bakedModelName(name)
+	if opts.dryRun || opts.verbose {
+		fmt.Printf("# Modelfile for %s\nFROM %s\nSYSTEM \"\"\"%s\"\"\"\n", model, base, role.SystemPrompt)
+		if opts.dryRun {
+			return nil
+		}
+	}
+
+	notef("Creating %s from %s...\n", model, base)
+	payload := map[string]any{"model": model, "from": base, "system": role.SystemPrompt, "stream": false}
+	if err := ollamaModelRequest(ollamaHostFor(base), "POST", "/api/create", payload, ollamaCreateTimeout); err != nil {
+		return err
+	}
+
+	role.BakedModel, role.BakedFrom = model, base
+	config.Roles[name] = role
+	if config.Aliases == nil {
+		config.Aliases = make(map[string]string)
+	}
+	config.Aliases[bakedAlias(name)] = string(Ollama) + "/" + model
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	fmt.Printf("Baked role %s into ollama/%s (alias %s)\n", name, model, bakedAlias(name))
+	return nil
+}
+
+func unbakeRole(config *Config, name string, role Role) error {
+	if role.BakedModel == "" {
+		return fmt.Errorf("role %s is not baked", name)
+	}
+	if err := ollamaModelRequest(ollamaHostFor(role.BakedModel), "DELETE", "/api/delete", map[string]any{"model": role.BakedModel}, modelDetailsTimeout); err != nil {
+		notef("Warning: failed to delete %s: %v\n", role.BakedModel, err)
+	}
+
+	model := role.BakedModel
+	role.BakedModel, role.BakedFrom = "", ""
+	config.Roles[name] = role
+	delete(config.Aliases, bakedAlias(name))
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	fmt.Printf("Removed ollama/%s\n", model)
+	return nil
+}
+
+// ollamaModelRequest sends a model management request to the Ollama at host.
+func ollamaModelRequest(host, method, path string, payload any, timeout time.Duration) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, host+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("ollama %s: %s", path, apiErr.Error)
+		}
+		return fmt.Errorf("ollama %s: %s", path, resp.Status)
+	}
+	return nil
+}
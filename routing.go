@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Routing picks the model per prompt. Tiers name models (aliases or
+// provider/model references) and the first matching rule chooses the tier.
+type Routing struct {
+	Tiers map[string]string `json:"tiers"`
+	Rules []RoutingRule     `json:"rules,omitempty"`
+}
+
+// RoutingRule matches prompts by their estimated size and whether they
+// contain code fences. Conditions that are not set always match.
+type RoutingRule struct {
+	MinTokens int    `json:"min_tokens,omitempty"`
+	MaxTokens int    `json:"max_tokens,omitempty"`
+	Code      *bool  `json:"code,omitempty"`
+	Tier      string `json:"tier"`
+}
+
+// validateRouting rejects rules and tiers that can't be resolved.
+func validateRouting(c *Config) error {
+	if c.Routing == nil {
+		return nil
+	}
+	for name, spec := range c.Routing.Tiers {
+		if provider, _ := c.resolveModel(spec); provider == "" {
+			return fmt.Errorf("routing tier '%s' points to '%s', which is neither an alias nor a provider/model reference", name, spec)
+		}
+	}
+	for i, rule := range c.Routing.Rules {
+		if _, ok := c.Routing.Tiers[rule.Tier]; !ok {
+			return fmt.Errorf("routing rule %d uses unknown tier '%s'", i+1, rule.Tier)
+		}
+	}
+	return nil
+}
+
+// checkTier fails if --tier names a tier that isn't configured.
+func checkTier(config *Config, opts *options) error {
+	if opts.tier == "" {
+		return nil
+	}
+	var tiers []string
+	if config.Routing != nil {
+		if _, ok := config.Routing.Tiers[opts.tier]; ok {
+			return nil
+		}
+		for name := range config.Routing.Tiers {
+			tiers = append(tiers, name)
+		}
+	}
+	if len(tiers) == 0 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("--tier needs tiers under \"routing\" in the configuration")}
+	}
+	slices.Sort(tiers)
+	return &exitError{code: exitUsage, err: fmt.Errorf("unknown tier: %s (available: %s)", opts.tier, strings.Join(tiers, ", "))}
+}
+
+// route returns the model spec the routing configuration picks for the
+// messages, with a description of why. The spec is empty if nothing matches.
+func (c *Config) route(messages []OpenAIMessage, opts *options) (string, string) {
+	if c.Routing == nil {
+		return "", ""
+	}
+	if opts.tier != "" {
+		return c.Routing.Tiers[opts.tier], fmt.Sprintf("--tier %s", opts.tier)
+	}
+
+	tokens := estimateMessageTokens(messages)
+	code := slices.ContainsFunc(messages, func(m OpenAIMessage) bool {
+		return m.Role == "user" && strings.Contains(m.Content, "```")
+	})
+	for i, rule := range c.Routing.Rules {
+		if rule.MinTokens > 0 && tokens < rule.MinTokens ||
+			rule.MaxTokens > 0 && tokens > rule.MaxTokens ||
+			rule.Code != nil && *rule.Code != code {
+			continue
+		}
+		content := "no code"
+		if code {
+			content = "code"
+		}
+		return c.Routing.Tiers[rule.Tier], fmt.Sprintf("routing rule %d, tier %s: ~%d tokens, %s", i+1, rule.Tier, tokens, content)
+	}
+	return "", ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretPattern finds one kind of credential. If the pattern has a group
+// named "secret", only that part is redacted.
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var secretPatterns = []secretPattern{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`)},
+	{"openai-key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{16,}=*)`)},
+	{"url-password", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:(?P<secret>[^/\s@]+)@`)},
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token)["']?\s*[=:]\s*["']?(?P<secret>[^\s"',;]{6,})`)},
+}
+
+// scrubSecrets replaces credentials in text with placeholders such as
+// "[REDACTED:aws-access-key]" and counts them by kind.
+func scrubSecrets(text string, found map[string]int) string {
+	for _, p := range secretPatterns {
+		secret := p.re.SubexpIndex("secret")
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.Contains(match, "[REDACTED:") {
+				return match
+			}
+			found[p.kind]++
+			placeholder := "[REDACTED:" + p.kind + "]"
+			if secret < 0 {
+				return placeholder
+			}
+			// keep the context around the secret, e.g. "password=" or the
+			// user name of a URL
+			m := p.re.FindStringSubmatchIndex(match)
+			return match[:m[2*secret]] + placeholder + match[m[2*secret+1]:]
+		})
+	}
+	return text
+}
+
+// scrubMessages redacts credentials in the messages in place, or with mode
+// "block" refuses to send them. Findings are reported by kind and count,
+// never with the secret itself.
+func scrubMessages(messages []OpenAIMessage, mode string) error {
+	found := make(map[string]int)
+	scrubbed := make([]string, len(messages))
+	for i, msg := range messages {
+		scrubbed[i] = scrubSecrets(msg.Content, found)
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	summary := summarizeFindings(found)
+	if mode == "block" {
+		return &exitError{
+			code: exitSecretsFound,
+			err:  fmt.Errorf("prompt contains possible secrets (%s), not sent; use --scrub to redact them", summary),
+		}
+	}
+	for i := range messages {
+		messages[i].Content = scrubbed[i]
+	}
+	notef("Redacted possible secrets from the prompt: %s\n", summary)
+	return nil
+}
+
+// summarizeFindings formats counts by kind, e.g. "2 aws-access-key, 1 password".
+func summarizeFindings(found map[string]int) string {
+	kinds := make([]string, 0, len(found))
+	for kind := range found {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", found[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scrubMode returns how secrets are handled for a request to provider:
+// redacted by default for cloud providers, left alone for local Ollama unless
+// --scrub is given explicitly.
+func scrubMode(opts *options, provider Provider) string {
+	if opts.scrub != "" {
+		return opts.scrub
+	}
+	// moderation sends the prompt to OpenAI even for local requests
+	if provider.isLocal() && opts.moderate == "" {
+		return "off"
+	}
+	return "redact"
+}
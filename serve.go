@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const defaultServePort = 8099
+
+// serveChatRequest is the part of an OpenAI chat completion request the
+// server understands.
+type serveChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens replaces max_tokens in current OpenAI clients and
+	// wins over it.
+	MaxCompletionTokens int  `json:"max_completion_tokens,omitempty"`
+	Stream              bool `json:"stream,omitempty"`
+}
+
+// maxTokens returns the limit of the answer the client asked for.
+func (in *serveChatRequest) maxTokens() int {
+	if in.MaxCompletionTokens > 0 {
+		return in.MaxCompletionTokens
+	}
+	return in.MaxTokens
+}
+
+// serveModel is an entry of the /v1/models list.
+type serveModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// serveCommand runs an OpenAI-compatible HTTP server on localhost that sends
+// requests through the configured providers.
+func serveCommand(args []string, opts *options) error {
+	port := defaultServePort
+	token := os.Getenv("AI_CLI_SERVE_TOKEN")
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--port":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--port flag requires a number")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid --port value: %s", args[i+1])
+			}
+			port = n
+			i++
+		case "--token":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--token flag requires an argument")
+			}
+			token = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown serve flag: %s", args[i])
+		}
+	}
+
+	if err := ensureConfigExists(); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		handleServeChat(w, r, opts)
+	})
+	mux.HandleFunc("GET /v1/models", handleServeModels)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	fmt.Fprintf(os.Stderr, "Serving the OpenAI API on http://%s/v1\n", addr)
+	return http.ListenAndServe(addr, localOnly(requireToken(token, mux)))
+}
+
+// localOnly rejects requests a web page could make: from another origin,
+// or through a DNS name rebound to 127.0.0.1. Editors and scripts send no
+// Origin and address the server as localhost.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, err := url.Parse("http://" + r.Host); err != nil || !isLoopback(host.Hostname()) {
+			writeServeError(w, http.StatusForbidden, "invalid_request_error", "the server only answers requests to localhost")
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || !isLoopback(u.Hostname()) {
+				writeServeError(w, http.StatusForbidden, "invalid_request_error", "requests from web pages are not allowed")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireToken rejects requests without the bearer token, if one is set.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeServeError(w, http.StatusUnauthorized, "invalid_api_key", "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func handleServeChat(w http.ResponseWriter, r *http.Request, globalOpts *options) {
+	var in serveChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || len(in.Messages) == 0 {
+		writeServeError(w, http.StatusBadRequest, "invalid_request_error", "request needs model and messages")
+		return
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// aliases and provider/model references pick a model, anything else
+	// (e.g. a model name the editor has hardcoded) uses the configured one
+	req := &chatRequest{
+		Provider: config.Provider, Model: config.Model, Messages: in.Messages, Temperature: in.Temperature, MaxTokens: in.maxTokens(),
+		Tags: requestTags(globalOpts), User: requestUser(config),
+	}
+	if provider, model := config.resolveModel(in.Model); provider != "" {
+		req.Provider, req.Model = provider, model
+	}
+
+	opts := *globalOpts
+	opts.batch = true      // no interactive recovery
+	opts.allowEmpty = true // clients see the finish_reason themselves
+	opts.noRetry = true    // "retry" is for the user's own requests
+	id := "chatcmpl-" + randomID()
+	created := time.Now().Unix()
+	modelName := string(req.Provider) + "/" + req.Model
+
+	if !in.Stream {
+		result, err := sendRequest(req, &opts)
+		if err != nil {
+			writeServeRequestError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   modelName,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       OpenAIMessage{Role: "assistant", Content: result.Content},
+				"finish_reason": serveFinishReason(result),
+			}},
+			"usage": map[string]int{
+				"prompt_tokens":     result.PromptTokens,
+				"completion_tokens": result.CompletionTokens,
+				"total_tokens":      result.PromptTokens + result.CompletionTokens,
+			},
+		})
+		return
+	}
+
+	// stream the provider's answer through as server-sent events
+	flusher, _ := w.(http.Flusher)
+	started := false
+	sendChunk := func(delta map[string]string, finish any) {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		data, _ := json.Marshal(map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   modelName,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	opts.streamWriter = writerFunc(func(chunk string) {
+		if !started {
+			sendChunk(map[string]string{"role": "assistant"}, nil)
+		}
+		sendChunk(map[string]string{"content": chunk}, nil)
+	})
+	result, err := sendRequest(req, &opts)
+	var truncated *streamTruncatedError
+	switch {
+	case err != nil && !started:
+		writeServeRequestError(w, err)
+		return
+	case errors.As(err, &truncated):
+		sendChunk(map[string]string{}, "length")
+	case err != nil:
+		// the stream has started, so the error can only be reported inline
+		data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": err.Error(), "type": "server_error"}})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	default:
+		sendChunk(map[string]string{}, serveFinishReason(result))
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// serveFinishReason passes on why the provider ended the answer.
+func serveFinishReason(result *completion) string {
+	if result.FinishReason != "" {
+		return result.FinishReason
+	}
+	return "stop"
+}
+
+func handleServeModels(w http.ResponseWriter, r *http.Request) {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	available, _, _ := getAllAvailableModels(false)
+
+	var models []serveModel
+	for _, option := range modelOptions(available) {
+		models = append(models, serveModel{ID: string(option.Provider) + "/" + option.Model, Object: "model", OwnedBy: string(option.Provider)})
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Aliases)) {
+		models = append(models, serveModel{ID: name, Object: "model", OwnedBy: "ai-cli"})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": models})
+}
+
+// writeServeRequestError maps errors from sending a request to OpenAI-style
+// error responses.
+func writeServeRequestError(w http.ResponseWriter, err error) {
+	var unavailable *modelUnavailableError
+	var exit *exitError
+	switch {
+	case errors.As(err, &unavailable):
+		writeServeError(w, http.StatusNotFound, "model_not_found", err.Error())
+	case errors.As(err, &exit) && exit.code == exitBudgetExceeded:
+		writeServeError(w, http.StatusTooManyRequests, "insufficient_quota", err.Error())
+	case errors.As(err, &exit) && (exit.code == exitSecretsFound || exit.code == exitModerationFlagged):
+		writeServeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+	default:
+		writeServeError(w, http.StatusBadGateway, "server_error", err.Error())
+	}
+}
+
+func writeServeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{"message": message, "type": code, "code": code},
+	})
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalOnly(t *testing.T) {
+	handler := localOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{name: "editor", host: "127.0.0.1:8099", want: http.StatusOK},
+		{name: "localhost", host: "localhost:8099", want: http.StatusOK},
+		{name: "IPv6", host: "[::1]:8099", want: http.StatusOK},
+		{name: "local web app", host: "localhost:8099", origin: "http://localhost:3000", want: http.StatusOK},
+		{name: "web page", host: "127.0.0.1:8099", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "sandboxed page", host: "127.0.0.1:8099", origin: "null", want: http.StatusForbidden},
+		{name: "DNS rebinding", host: "evil.example:8099", want: http.StatusForbidden},
+		{name: "rebinding with local origin", host: "evil.example:8099", origin: "http://localhost:8099", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeChatKeepsRetryRequest(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "pong"}, "finish_reason": "stop"}},
+		})
+	}))
+	defer provider.Close()
+	defer func(url string) { openAIBaseURL = url }(openAIBaseURL)
+	openAIBaseURL = provider.URL
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "test")
+	if err := saveConfig(&Config{Provider: OpenAI, Model: "gpt-5-mini"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"x","messages":[{"role":"user","content":"ping"}]}`))
+	w := httptest.NewRecorder()
+	handleServeChat(w, r, &options{})
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "pong") {
+		t.Fatalf("response = %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(getLastRequestPath()); !os.IsNotExist(err) {
+		t.Errorf("the served request was saved for retry (err = %v)", err)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// importedConversation is a conversation read from the export of a chat
+// service, before it becomes a session.
+type importedConversation struct {
+	Title    string
+	Created  time.Time
+	Updated  time.Time
+	Messages []OpenAIMessage
+	// Skipped counts the attachments and images left out, since a session
+	// holds text only.
+	Skipped int
+}
+
+// conversationParsers read the conversations.json of the data exports of
+// ChatGPT and Claude, selected with --from.
+var conversationParsers = map[string]func([]byte) ([]importedConversation, error){
+	"chatgpt": parseChatGPTExport,
+	"claude":  parseClaudeExport,
+}
+
+// sessionsImportCommand turns a conversation exported from ChatGPT or
+// Claude into a session, which --session then continues with the
+// configured model: ai-cli sessions import --from chatgpt|claude <file>
+// [--conversation <number|title>] [--name <session>]. If the file holds
+// several conversations, one is picked in a list.
+func sessionsImportCommand(args []string) error {
+	const usage = "usage: ai-cli sessions import --from chatgpt|claude <file> [--conversation <number|title>] [--name <session>]"
+	var from, file, pick, name string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--from", "--conversation", "--name":
+			if i+1 >= len(args) {
+				return &exitError{code: exitUsage, err: fmt.Errorf("%s requires a value", args[i])}
+			}
+			switch args[i] {
+			case "--from":
+				from = args[i+1]
+			case "--conversation":
+				pick = args[i+1]
+			case "--name":
+				name = args[i+1]
+			}
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") || file != "" {
+				return &exitError{code: exitUsage, err: fmt.Errorf("%s", usage)}
+			}
+			file = args[i]
+		}
+	}
+	parse, ok := conversationParsers[from]
+	if !ok || file == "" {
+		return &exitError{code: exitUsage, err: fmt.Errorf("%s", usage)}
+	}
+	if name != "" {
+		if err := validateSessionName(name); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	conversations, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to read the %s export: %w", from, err)
+	}
+	for i := range conversations {
+		conversations[i].Messages = completeExchanges(conversations[i].Messages)
+	}
+	conversations = slices.DeleteFunc(conversations, func(c importedConversation) bool { return len(c.Messages) == 0 })
+	if len(conversations) == 0 {
+		return fmt.Errorf("no conversations with text found in %s", file)
+	}
+	slices.SortStableFunc(conversations, func(a, b importedConversation) int { return b.Updated.Compare(a.Updated) })
+
+	conversation, err := pickConversation(conversations, pick)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = "imported"
+		if conversation.Title != "" {
+			name = promptSlug(conversation.Title)
+		}
+	}
+	if _, err := os.Stat(getSessionPath(name)); err == nil {
+		return fmt.Errorf("session '%s' already exists; choose another name with --name", name)
+	}
+	s, err := loadSession(name)
+	if err != nil {
+		return err
+	}
+	if !conversation.Created.IsZero() {
+		s.Created = conversation.Created
+	}
+	s.Messages = conversation.Messages
+	s.Title = conversation.Title
+	if err := saveSession(s); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", name, err)
+	}
+
+	fmt.Printf("Imported %q as session %s, exchanges: %d\n", conversation.Title, name, countExchanges(s.Messages))
+	if conversation.Skipped > 0 {
+		fmt.Printf("Attachments and images skipped, since sessions hold text only: %d\n", conversation.Skipped)
+	}
+	fmt.Printf("Continue it with: ai-cli --session %s \"...\"\n", name)
+	return nil
+}
+
+// pickConversation selects the conversation to import: by --conversation,
+// the number in the list or a part of the title, the only one, or else by
+// asking in the terminal.
+func pickConversation(conversations []importedConversation, pick string) (importedConversation, error) {
+	if pick != "" {
+		if n, err := strconv.Atoi(pick); err == nil {
+			if n < 1 || n > len(conversations) {
+				return importedConversation{}, fmt.Errorf("no conversation %d; the export holds %d", n, len(conversations))
+			}
+			return conversations[n-1], nil
+		}
+		var matches []importedConversation
+		for _, c := range conversations {
+			if strings.Contains(strings.ToLower(c.Title), strings.ToLower(pick)) {
+				matches = append(matches, c)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return importedConversation{}, fmt.Errorf("no conversation titled '%s'", pick)
+		case 1:
+			return matches[0], nil
+		}
+		conversations = matches
+	}
+	if len(conversations) == 1 {
+		return conversations[0], nil
+	}
+
+	printConversations(conversations)
+	if !isInteractive() {
+		return importedConversation{}, &exitError{code: exitUsage, err: fmt.Errorf("the export holds %d conversations; pick one with --conversation <number>", len(conversations))}
+	}
+	fmt.Fprintf(os.Stderr, "Conversation to import (1-%d): ", len(conversations))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || n < 1 || n > len(conversations) {
+		return importedConversation{}, fmt.Errorf("invalid choice")
+	}
+	return conversations[n-1], nil
+}
+
+func printConversations(conversations []importedConversation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTITLE\tEXCHANGES\tUPDATED")
+	for i, c := range conversations {
+		updated := "-"
+		if !c.Updated.IsZero() {
+			updated = c.Updated.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", i+1, shortTitle(c.Title), countExchanges(c.Messages), updated)
+	}
+	w.Flush()
+}
+
+// appendImported adds a message to the history, joining it to the previous
+// one if it has the same role, since a session alternates between user and
+// assistant.
+func appendImported(messages []OpenAIMessage, role, text string) []OpenAIMessage {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content += "\n\n" + text
+		return messages
+	}
+	return append(messages, OpenAIMessage{Role: role, Content: text})
+}
+
+// completeExchanges drops what doesn't belong to a prompt and its answer:
+// answers before the first prompt and a last prompt that got no answer.
+func completeExchanges(messages []OpenAIMessage) []OpenAIMessage {
+	for len(messages) > 0 && messages[0].Role != "user" {
+		messages = messages[1:]
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		messages = messages[:n-1]
+	}
+	return messages
+}
+
+// unixTime converts the fractional Unix seconds of ChatGPT exports.
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// chatGPTConversation is an entry of ChatGPT's conversations.json. The
+// messages form a tree, as every edited prompt and regenerated answer
+// starts a branch; current_node is the last message of the branch that was
+// shown last.
+type chatGPTConversation struct {
+	Title       string  `json:"title"`
+	CreateTime  float64 `json:"create_time"`
+	UpdateTime  float64 `json:"update_time"`
+	CurrentNode string  `json:"current_node"`
+	Mapping     map[string]struct {
+		Parent  string `json:"parent"`
+		Message *struct {
+			Author struct {
+				Role string `json:"role"`
+			} `json:"author"`
+			Content struct {
+				ContentType string            `json:"content_type"`
+				Parts       []json.RawMessage `json:"parts"`
+			} `json:"content"`
+			Metadata struct {
+				Hidden bool `json:"is_visually_hidden_from_conversation"`
+			} `json:"metadata"`
+		} `json:"message"`
+	} `json:"mapping"`
+}
+
+// parseChatGPTExport reads the conversations.json of a ChatGPT export, or a
+// single conversation of it. Only the user's prompts and the text answers
+// are kept; tool output, hidden messages and custom instructions are left
+// out.
+func parseChatGPTExport(data []byte) ([]importedConversation, error) {
+	var exported []chatGPTConversation
+	if err := json.Unmarshal(data, &exported); err != nil {
+		var single chatGPTConversation
+		if json.Unmarshal(data, &single) != nil || single.Mapping == nil {
+			return nil, err
+		}
+		exported = []chatGPTConversation{single}
+	}
+
+	var conversations []importedConversation
+	for _, c := range exported {
+		imported := importedConversation{Title: c.Title, Created: unixTime(c.CreateTime), Updated: unixTime(c.UpdateTime)}
+		// the branch is followed from its end back to the root
+		var branch []string
+		seen := make(map[string]bool)
+		for id := c.CurrentNode; id != "" && !seen[id]; id = c.Mapping[id].Parent {
+			seen[id] = true
+			branch = append(branch, id)
+		}
+		slices.Reverse(branch)
+
+		for _, id := range branch {
+			msg := c.Mapping[id].Message
+			if msg == nil || msg.Metadata.Hidden {
+				continue
+			}
+			role := msg.Author.Role
+			if role != "user" && role != "assistant" {
+				continue
+			}
+			switch msg.Content.ContentType {
+			case "text", "multimodal_text":
+			default:
+				continue // code run by the model, browsing, instructions
+			}
+			var text []string
+			for _, part := range msg.Content.Parts {
+				var s string
+				if json.Unmarshal(part, &s) == nil {
+					text = append(text, s)
+				} else {
+					imported.Skipped++ // an image or file
+				}
+			}
+			imported.Messages = appendImported(imported.Messages, role, strings.Join(text, "\n"))
+		}
+		conversations = append(conversations, imported)
+	}
+	return conversations, nil
+}
+
+// claudeConversation is an entry of Claude's conversations.json.
+type claudeConversation struct {
+	Name         string    `json:"name"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ChatMessages []struct {
+		Sender  string `json:"sender"` // "human" or "assistant"
+		Text    string `json:"text"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Attachments []json.RawMessage `json:"attachments"`
+		Files       []json.RawMessage `json:"files"`
+	} `json:"chat_messages"`
+}
+
+// parseClaudeExport reads the conversations.json of a Claude export, or a
+// single conversation of it. The text blocks of a message are used where
+// the export has them, since its plain text also holds the tool use.
+func parseClaudeExport(data []byte) ([]importedConversation, error) {
+	var exported []claudeConversation
+	if err := json.Unmarshal(data, &exported); err != nil {
+		var single claudeConversation
+		if json.Unmarshal(data, &single) != nil || single.ChatMessages == nil {
+			return nil, err
+		}
+		exported = []claudeConversation{single}
+	}
+
+	var conversations []importedConversation
+	for _, c := range exported {
+		imported := importedConversation{Title: c.Name, Created: c.CreatedAt, Updated: c.UpdatedAt}
+		for _, msg := range c.ChatMessages {
+			role := "assistant"
+			if msg.Sender == "human" {
+				role = "user"
+			}
+			text := msg.Text
+			if len(msg.Content) > 0 {
+				var parts []string
+				for _, block := range msg.Content {
+					if block.Type == "text" {
+						parts = append(parts, block.Text)
+					}
+				}
+				text = strings.Join(parts, "\n")
+			}
+			imported.Skipped += len(msg.Attachments) + len(msg.Files)
+			imported.Messages = appendImported(imported.Messages, role, text)
+		}
+		conversations = append(conversations, imported)
+	}
+	return conversations, nil
+}
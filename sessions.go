@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	sessionsDirName = "sessions"
+	// maxTitleRunes is the length of an exchange's title before it is cut
+	// off with an ellipsis.
+	maxTitleRunes = 60
+)
+
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// session is a stored conversation. The system prompt is not part of it;
+// it is assembled from the configuration for every turn.
+type session struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Dir is the project root of an automatic project session.
+	Dir string `json:"dir,omitempty"`
+	// Summary replaces exchanges that were summarized to fit the context
+	// window.
+	Summary string `json:"summary,omitempty"`
+	// Title names the conversation, see startSessionTitle.
+	Title    string          `json:"title,omitempty"`
+	Messages []OpenAIMessage `json:"messages"`
+	// Titles describe the most recent exchanges in order, see inputTitle.
+	// Exchanges recorded before titles existed have none.
+	Titles []string `json:"titles,omitempty"`
+}
+
+func getSessionPath(name string) string {
+	return filepath.Join(getStateDir(), sessionsDirName, name+".json")
+}
+
+func validateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name '%s': use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// loadSession reads a session. A session that doesn't exist yet is empty.
+func loadSession(name string) (*session, error) {
+	if err := validateSessionName(name); err != nil {
+		return nil, err
+	}
+	if stateDisabled() {
+		return nil, errNoState
+	}
+	data, err := os.ReadFile(getSessionPath(name))
+	if os.IsNotExist(err) {
+		now := time.Now()
+		return &session{Name: name, Created: now, Updated: now}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", name, err)
+	}
+	return &s, nil
+}
+
+func saveSession(s *session) error {
+	// exchanges dropped to fit the context window take their titles along
+	if exchanges := countExchanges(s.Messages); len(s.Titles) > exchanges {
+		s.Titles = s.Titles[len(s.Titles)-exchanges:]
+	}
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(getSessionPath(s.Name), data, 0600)
+}
+
+// listSessions returns the stored sessions, most recently used first.
+func listSessions() ([]*session, error) {
+	if stateDisabled() {
+		return nil, errNoState
+	}
+	paths, err := filepath.Glob(filepath.Join(getStateDir(), sessionsDirName, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*session
+	for _, path := range paths {
+		s, err := loadSession(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	slices.SortFunc(sessions, func(a, b *session) int { return b.Updated.Compare(a.Updated) })
+	return sessions, nil
+}
+
+// sessionName returns the session the options select: --session, the
+// project's session with auto_session, or with -c the most recently used
+// one ("default" if there is none). The project session is remembered in
+// opts.
+func sessionName(config *Config, opts *options) (string, error) {
+	if opts.session != "" {
+		return opts.session, nil
+	}
+	if opts.autoSession {
+		root, err := autoSessionRoot(config)
+		if err != nil {
+			return "", err
+		}
+		if root != "" {
+			opts.session, opts.sessionDir = projectSessionName(root), root
+			return opts.session, nil
+		}
+	}
+	if !opts.continueSession {
+		return "", nil
+	}
+	sessions, err := listSessions()
+	if err != nil {
+		return "", err
+	}
+	if len(sessions) == 0 {
+		return "default", nil
+	}
+	return sessions[0].Name, nil
+}
+
+// withSession puts the session history between the system messages and the
+// new prompt of req, trimming it to the context window first.
+func withSession(config *Config, req *chatRequest, s *session, opts *options) error {
+	var system []OpenAIMessage
+	for len(req.Messages) > 1 && req.Messages[0].Role == "system" {
+		system = append(system, req.Messages[0])
+		req.Messages = req.Messages[1:]
+	}
+	prompt := req.Messages
+
+	if err := fitSession(config, req, system, s, prompt, opts); err != nil {
+		return err
+	}
+
+	messages := slices.Clone(system)
+	if s.Summary != "" {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: "Summary of the earlier conversation:\n" + s.Summary})
+	}
+	messages = append(messages, s.Messages...)
+	req.Messages = append(messages, prompt...)
+	return nil
+}
+
+// recordSessionTurn appends a completed exchange to the session and saves
+// it.
+func recordSessionTurn(s *session, title, prompt, answer string) error {
+	s.Messages = append(s.Messages,
+		OpenAIMessage{Role: "user", Content: prompt},
+		OpenAIMessage{Role: "assistant", Content: answer})
+	s.Titles = append(s.Titles, title)
+	return saveSession(s)
+}
+
+// inputTitle describes what the user sent in one line: the prompt given as
+// arguments, or else the first line of the piped input, followed by the
+// size of the piped input and the number of attached sources, e.g.
+// "why does this fail? +38.2 KB piped".
+func inputTitle(input userInput) string {
+	title := shortTitle(input.Prompt)
+	var extras []string
+	if input.Piped != "" {
+		if title == "" {
+			title = shortTitle(input.Piped)
+		}
+		extras = append(extras, "+"+formatBytes(len(input.Piped))+" piped")
+	}
+	switch len(input.Sources) {
+	case 0:
+	case 1:
+		extras = append(extras, "+1 source")
+	default:
+		extras = append(extras, fmt.Sprintf("+%d sources", len(input.Sources)))
+	}
+	return strings.TrimSpace(title + " " + strings.Join(extras, " "))
+}
+
+// shortTitle returns the first non-empty line of text, cut off at
+// maxTitleRunes.
+func shortTitle(text string) string {
+	for line := range strings.Lines(text) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if runes := []rune(line); len(runes) > maxTitleRunes {
+			line = strings.TrimSpace(string(runes[:maxTitleRunes-1])) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+// exchangeTitles returns a title for every exchange of the session, taking
+// the first line of the prompt for exchanges without a stored title.
+func (s *session) exchangeTitles() []string {
+	var titles []string
+	for _, msg := range s.Messages {
+		if msg.Role == "user" {
+			titles = append(titles, shortTitle(msg.Content))
+		}
+	}
+	copy(titles[max(len(titles)-len(s.Titles), 0):], s.Titles)
+	return titles
+}
+
+// sessionsCommand lists, shows, removes and imports stored sessions.
+func sessionsCommand(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return sessionsListCommand()
+	}
+	if args[0] == "import" {
+		return sessionsImportCommand(args[1:])
+	}
+	full := len(args) == 3 && args[0] == "show" && args[2] == "--full"
+	if len(args) != 2 && !full {
+		return fmt.Errorf("usage: ai-cli sessions [list | show <name> [--full] | rm <name> | import --from chatgpt|claude <file>]")
+	}
+	name := args[1]
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(getSessionPath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("no session named '%s'", name)
+	}
+
+	switch args[0] {
+	case "show":
+		s, err := loadSession(name)
+		if err != nil {
+			return err
+		}
+		if s.Title != "" {
+			fmt.Printf("%s\n\n", s.Title)
+		}
+		if s.Summary != "" {
+			fmt.Printf("--- summary ---\n%s\n\n", s.Summary)
+		}
+		// prompts are shown by their title, since they can be whole files
+		titles := s.exchangeTitles()
+		exchange := 0
+		for _, msg := range s.Messages {
+			content := msg.Content
+			if msg.Role == "user" {
+				if !full {
+					content = titles[exchange]
+				}
+				exchange++
+			}
+			fmt.Printf("--- %s ---\n%s\n\n", msg.Role, content)
+		}
+		return nil
+	case "rm":
+		if err := os.Remove(getSessionPath(name)); err != nil {
+			return err
+		}
+		fmt.Printf("Removed session %s\n", name)
+		return nil
+	}
+	return fmt.Errorf("usage: ai-cli sessions [list | show <name> [--full] | rm <name> | import --from chatgpt|claude <file>]")
+}
+
+func sessionsListCommand() error {
+	sessions, err := listSessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions yet. Start one with 'ai-cli chat' or --session <name>.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTITLE\tEXCHANGES\tUPDATED\tLAST PROMPT\tDIRECTORY")
+	for _, s := range sessions {
+		last := ""
+		if titles := s.exchangeTitles(); len(titles) > 0 {
+			last = titles[len(titles)-1]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", s.Name, orDash(s.Title), len(s.Messages)/2, s.Updated.Local().Format("2006-01-02 15:04"), orDash(last), s.Dir)
+	}
+	return w.Flush()
+}
+
+// chatCommand runs an interactive conversation. Every line is sent as a
+// turn of the session, which is saved after each answer.
+func chatCommand(args []string, opts *options) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ai-cli chat [--session <name>]")
+	}
+	if err := ensureConfigExists(); err != nil {
+		return err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	opts.autoSession = true
+	name, err := sessionName(config, opts)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "chat-" + time.Now().Format("20060102-150405")
+	}
+	opts.session, opts.chat = name, true
+	fmt.Fprintf(os.Stderr, "Session %s (empty line or Ctrl-D to quit)\n", name)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for {
+		// the prompt line names the conversation once it has a title
+		if s, err := loadSession(name); err == nil && s.Title != "" {
+			fmt.Fprint(os.Stderr, styled(os.Stderr, styleDim, s.Title)+" > ")
+		} else {
+			fmt.Fprint(os.Stderr, "> ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "/exit" {
+			return nil
+		}
+
+		opts.streamed, opts.answered = false, nil
+		output, err := executePrompt(userInput{Prompt: line}, opts)
+		if err := deliver(output, err, opts); err != nil {
+			printError(err, opts)
+		}
+	}
+}
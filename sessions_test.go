@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInputTitle(t *testing.T) {
+	piped := strings.Repeat("x", 38*1024+200)
+	tests := []struct {
+		name  string
+		input userInput
+		want  string
+	}{
+		{name: "argument only", input: userInput{Prompt: "explain binary search"}, want: "explain binary search"},
+		{name: "piped only", input: userInput{Piped: "\npanic: nil map\ngoroutine 1"}, want: "panic: nil map +27 B piped"},
+		{name: "argument and piped", input: userInput{Prompt: "summarize this", Piped: piped}, want: "summarize this +38.2 KB piped"},
+		{name: "one source", input: userInput{Prompt: "review", Sources: []contextSource{{Name: "main.go"}}}, want: "review +1 source"},
+		{
+			name:  "piped and sources",
+			input: userInput{Prompt: "compare", Piped: "abc", Sources: []contextSource{{Name: "a.go"}, {Name: "https://example.com"}}},
+			want:  "compare +3 B piped +2 sources",
+		},
+		{name: "sources only", input: userInput{Sources: []contextSource{{Name: "a.go"}, {Name: "b.go"}, {Name: "c.go"}}}, want: "+3 sources"},
+		{name: "multi-line argument", input: userInput{Prompt: "  \n  first line  \nsecond line"}, want: "first line"},
+		{name: "nothing", input: userInput{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inputTitle(tt.input); got != tt.want {
+				t.Errorf("inputTitle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortTitle(t *testing.T) {
+	exact := strings.Repeat("a", maxTitleRunes)
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "short", text: "hello", want: "hello"},
+		{name: "exactly the limit", text: exact, want: exact},
+		{name: "one rune over", text: exact + "b", want: strings.Repeat("a", maxTitleRunes-1) + "…"},
+		{name: "counts runes, not bytes", text: strings.Repeat("ä", maxTitleRunes+5), want: strings.Repeat("ä", maxTitleRunes-1) + "…"},
+		{name: "no space before the ellipsis", text: strings.Repeat("a", maxTitleRunes-2) + " tail", want: strings.Repeat("a", maxTitleRunes-2) + "…"},
+		{name: "blank lines skipped", text: "\n\t\n  question  \nmore", want: "question"},
+		{name: "only whitespace", text: " \n\n ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shortTitle(tt.text)
+			if got != tt.want {
+				t.Errorf("shortTitle = %q, want %q", got, tt.want)
+			}
+			if n := len([]rune(got)); n > maxTitleRunes {
+				t.Errorf("title has %d runes, more than %d", n, maxTitleRunes)
+			}
+		})
+	}
+}
+
+func TestExchangeTitles(t *testing.T) {
+	s := &session{
+		Messages: []OpenAIMessage{
+			{Role: "user", Content: "first question"},
+			{Role: "assistant", Content: "answer"},
+			{Role: "user", Content: "second question\nwith details"},
+			{Role: "assistant", Content: "answer"},
+		},
+		// only the latest exchange was recorded with its input title
+		Titles: []string{"second +1.0 KB piped"},
+	}
+	got := s.exchangeTitles()
+	if len(got) != 2 || got[0] != "first question" || got[1] != "second +1.0 KB piped" {
+		t.Errorf("exchangeTitles = %q, want the derived title, then the recorded one", got)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// sessionTitleWords is the most words a generated session title has.
+	sessionTitleWords = 8
+	// sessionTitleInput bounds the bytes of the exchange sent to be titled.
+	sessionTitleInput = 4000
+)
+
+// startSessionTitle gives a session without a title one in the background,
+// once it has an exchange: the model that answered, or the one of
+// task_models["title"], names the conversation after its first exchange.
+// It is best effort, so a failure only leaves the session untitled until
+// its next exchange. deliver waits for it, so the answer isn't held up.
+// "session_titles": false turns it off.
+func startSessionTitle(config *Config, req *chatRequest, s *session, opts *options) {
+	if s.Title != "" || len(s.Messages) < 2 || (config.SessionTitles != nil && !*config.SessionTitles) {
+		return
+	}
+	provider, model := req.Provider, req.Model
+	if spec := config.TaskModels["title"]; spec != "" {
+		if p, m := config.resolveModel(spec); p != "" {
+			provider, model = p, m
+		}
+	}
+	done := make(chan struct{})
+	opts.titling = done
+	go func() {
+		defer close(done)
+		title, err := sessionTitle(config, provider, model, s.Messages[:2], opts)
+		if err != nil {
+			if opts.verbose {
+				notef("Note: no title for session %s: %v\n", s.Name, err)
+			}
+			return
+		}
+		s.Title = title
+		if err := saveSession(s); err != nil {
+			notef("Warning: failed to save session %s: %v\n", s.Name, err)
+		}
+	}()
+}
+
+// waitSessionTitle waits for the title started by startSessionTitle, if
+// any.
+func waitSessionTitle(opts *options) {
+	if opts.titling != nil {
+		<-opts.titling
+		opts.titling = nil
+	}
+}
+
+// sessionTitle asks the model for a title of the exchange, under the same
+// policies as the exchange itself.
+func sessionTitle(config *Config, provider Provider, model string, exchange []OpenAIMessage, opts *options) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range exchange {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+	text, _ := truncateText(transcript.String(), sessionTitleInput)
+
+	req := &chatRequest{
+		Provider: provider,
+		Model:    model,
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: fmt.Sprintf("Give the following conversation a title of at most %d words, naming its topic. Reply with the title only, without quotes or punctuation at the end.", sessionTitleWords)},
+			{Role: "user", Content: text},
+		},
+		Tags: requestTags(opts),
+		User: requestUser(config),
+	}
+	result, err := sendSideRequest(config, req, opts, nil)
+	if err != nil {
+		return "", err
+	}
+	title := cleanSessionTitle(result.Content)
+	if title == "" {
+		return "", fmt.Errorf("empty title")
+	}
+	return title, nil
+}
+
+// cleanSessionTitle reduces an answer to a title: its first line without
+// a "Title:" label, Markdown, quotes and final punctuation, cut to
+// sessionTitleWords words.
+func cleanSessionTitle(answer string) string {
+	title := shortTitle(strings.NewReplacer("*", "", "#", "", "`", "").Replace(answer))
+	if label, rest, ok := strings.Cut(title, ":"); ok && strings.EqualFold(strings.TrimSpace(label), "title") {
+		title = rest
+	}
+	title = strings.Trim(title, " \"'“”‘’.")
+	if words := strings.Fields(title); len(words) > sessionTitleWords {
+		title = strings.Join(words[:sessionTitleWords], " ")
+	}
+	return shortTitle(title)
+}
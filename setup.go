@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+const (
+	// recommendedOllamaModel is offered for download when Ollama has no
+	// models yet: small enough for most machines, good enough to try
+	// things out.
+	recommendedOllamaModel     = "llama3.2:3b"
+	recommendedOllamaModelSize = "2.0 GB"
+)
+
+// setupOptions answer the questions of the setup wizard up front, so it can
+// run without a terminal.
+type setupOptions struct {
+	provider Provider // --provider
+	model    string   // --model, a provider/model reference or alias
+	pull     bool     // --pull: download the recommended model if needed
+}
+
+// initSubcommand runs the setup wizard again, e.g. to switch to another
+// provider: ai-cli init [--provider ollama|lmstudio|openai] [--model p/m]
+// [--pull].
+func initSubcommand(args []string, opts *options) error {
+	if statelessMode() {
+		return errStatelessConfig
+	}
+	setup := setupOptions{model: opts.model()}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--provider":
+			if i+1 >= len(args) {
+				return &exitError{code: exitUsage, err: fmt.Errorf("--provider flag requires ollama, lmstudio, openai or a plugin")}
+			}
+			setup.provider = Provider(args[i+1])
+			if !slices.Contains(knownProviders, setup.provider) && !setup.provider.isPlugin() {
+				return &exitError{code: exitUsage, err: fmt.Errorf("invalid --provider value: %s", args[i+1])}
+			}
+			i++
+		case "--pull":
+			setup.pull = true
+		default:
+			return &exitError{code: exitUsage, err: fmt.Errorf("unknown init flag: %s", args[i])}
+		}
+	}
+	return initCommand(setup)
+}
+
+// initCommand is the setup wizard: it explains the providers, lets the
+// user pick one and then one of its models, and offers to pull a small
+// Ollama model if none is installed. The configuration is only written at
+// the end, so Ctrl-C at any point leaves none behind. Without a terminal
+// the defaults and the setupOptions answer the questions.
+func initCommand(setup setupOptions) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		if _, ok := <-signals; ok {
+			fmt.Println("\nSetup cancelled, nothing was saved.")
+			os.Exit(exitInterrupted)
+		}
+	}()
+
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	provider, model := setup.provider, ""
+	if setup.model != "" {
+		var spec Provider
+		spec, model = config.resolveModel(setup.model)
+		switch {
+		case spec == "" && provider == "":
+			return &exitError{code: exitUsage, err: fmt.Errorf("'%s' is neither an alias nor a provider/model reference; give the provider with --provider", setup.model)}
+		case spec != "" && provider != "" && spec != provider:
+			return &exitError{code: exitUsage, err: fmt.Errorf("--model %s is not a model of --provider %s", setup.model, provider)}
+		case spec != "":
+			provider = spec
+		}
+	}
+
+	// a fresh list, since LM Studio may have been started just now
+	available, unavailable, err := getAllAvailableModels(true)
+	if err != nil {
+		return err
+	}
+	w := &setupWizard{interactive: isInteractive(), reader: bufio.NewReader(os.Stdin)}
+
+	fmt.Println("Welcome to ai-cli! Pick where your prompts are answered:")
+	usable := printProviderChoices(available, unavailable)
+	if len(usable) == 0 {
+		fmt.Println("\nNo provider is available yet. Either:")
+		fmt.Println("  1. Install Ollama (https://ollama.com) to run models locally")
+		fmt.Println("  2. Start the local server of LM Studio (https://lmstudio.ai)")
+		fmt.Println("  3. Set the OPENAI_API_KEY environment variable")
+		fmt.Println("and run ai-cli again.")
+		return &exitError{code: exitFailure}
+	}
+
+	switch {
+	case provider != "":
+		if !slices.Contains(usable, provider) {
+			return &exitError{code: exitUsage, err: fmt.Errorf("provider %s is not available", provider)}
+		}
+	case len(usable) == 1:
+		provider = usable[0]
+		fmt.Printf("Using %s, the only available provider.\n", provider)
+	case !w.interactive:
+		provider = usable[0]
+		fmt.Printf("Using %s; pass --provider to choose another.\n", provider)
+	default:
+		choice, err := w.choose("Provider", len(usable))
+		if err != nil {
+			return err
+		}
+		provider = usable[choice]
+	}
+
+	models := available[string(provider)]
+	switch {
+	case model != "":
+		if setup.pull && provider == Ollama && !slices.Contains(models, model) {
+			if err := pullOllamaModel(model); err != nil {
+				return err
+			}
+		}
+	case len(models) == 0 && provider == Ollama:
+		if model, err = w.offerPull(setup.pull); err != nil || model == "" {
+			return err
+		}
+	case len(models) == 1:
+		model = models[0]
+	case !w.interactive:
+		model = models[0]
+		fmt.Printf("Using %s; pass --model to choose another.\n", model)
+	default:
+		options := modelOptions(map[string][]string{string(provider): models})
+		fmt.Println()
+		printModelOptions(options)
+		choice, err := w.choose("Select a model", len(options))
+		if err != nil {
+			return err
+		}
+		model = options[choice].Model
+	}
+
+	config.setModel(provider, model)
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("\nConfiguration saved: [%s] %s\n", provider, model)
+	fmt.Println("Try it:")
+	fmt.Println(`  ai-cli "explain the difference between a process and a thread"`)
+	return nil
+}
+
+// printProviderChoices explains the providers in a line each and numbers
+// those that can be used. It returns the usable ones in that order.
+func printProviderChoices(available map[string][]string, unavailable map[string]string) []Provider {
+	var usable []Provider
+	line := func(provider Provider, description, status string, ok bool) {
+		number := "  "
+		if ok {
+			usable = append(usable, provider)
+			number = fmt.Sprintf("%d.", len(usable))
+		}
+		fmt.Printf("  %s %-8s %s (%s)\n", number, provider, description, status)
+	}
+
+	const local = "local: private and free, runs on this machine"
+	const cloud = "cloud: paid per use, better answers"
+	ollamaModels := len(available[string(Ollama)])
+	switch reason, failed := unavailable[string(Ollama)]; {
+	case failed:
+		line(Ollama, local, "unavailable: "+reason, false)
+	case !isOllamaInstalled() && !hasOllamaHosts():
+		line(Ollama, local, "not installed, see https://ollama.com", false)
+	case ollamaModels == 0 && !isOllamaInstalled():
+		line(Ollama, local, "no models pulled on the Ollama host", false)
+	case ollamaModels == 0:
+		line(Ollama, local, "installed, no models yet", true)
+	default:
+		line(Ollama, local, fmt.Sprintf("%d models installed", ollamaModels), true)
+	}
+
+	switch reason, failed := unavailable[string(LMStudio)]; {
+	case failed:
+		line(LMStudio, local, "unavailable: "+reason, false)
+	case len(available[string(LMStudio)]) == 0:
+		line(LMStudio, local, "start its server on "+lmStudioURL()+" to use it", false)
+	default:
+		line(LMStudio, local, "server running on "+lmStudioURL(), true)
+	}
+
+	switch reason, failed := unavailable[string(OpenAI)]; {
+	case failed:
+		line(OpenAI, cloud, "unavailable: "+reason, false)
+	case !hasOpenAIToken():
+		line(OpenAI, cloud, "set OPENAI_API_KEY to use it", false)
+	default:
+		line(OpenAI, cloud, "OPENAI_API_KEY is set", true)
+	}
+
+	for _, plugin := range pluginNames() {
+		description := "plugin: " + providerPlugins()[plugin]
+		switch reason, failed := unavailable[string(plugin)]; {
+		case failed:
+			line(plugin, description, "unavailable: "+reason, false)
+		case len(available[string(plugin)]) == 0:
+			line(plugin, description, "lists no models", false)
+		default:
+			line(plugin, description, fmt.Sprintf("models: %d", len(available[string(plugin)])), true)
+		}
+	}
+	return usable
+}
+
+// setupWizard asks the questions of the setup on the terminal. Without one
+// no question is asked; initCommand takes the defaults instead.
+type setupWizard struct {
+	interactive bool
+	reader      *bufio.Reader
+}
+
+// ask prints question and returns the answer, or def for an empty answer.
+func (w *setupWizard) ask(question, def string) string {
+	fmt.Print(question)
+	answer, _ := w.reader.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
+
+// choose asks for a number from 1 to n, 1 by default, and returns its
+// index.
+func (w *setupWizard) choose(what string, n int) (int, error) {
+	var choice int
+	fmt.Sscanf(w.ask(fmt.Sprintf("%s (1-%d) [1]: ", what, n), "1"), "%d", &choice)
+	if choice < 1 || choice > n {
+		return 0, fmt.Errorf("invalid choice")
+	}
+	return choice - 1, nil
+}
+
+// offerPull offers to download recommendedOllamaModel, which --pull
+// accepts up front. It returns "" if nothing was pulled.
+func (w *setupWizard) offerPull(pull bool) (string, error) {
+	if !pull && w.interactive {
+		answer := w.ask(fmt.Sprintf("No Ollama models installed yet. Pull %s (%s), a small general-purpose model? [Y/n]: ", recommendedOllamaModel, recommendedOllamaModelSize), "y")
+		answer = strings.ToLower(answer)
+		pull = answer == "y" || answer == "yes"
+	}
+	if !pull {
+		fmt.Printf("Pull a model with 'ollama pull <model>', or run 'ai-cli init --pull' to get %s.\n", recommendedOllamaModel)
+		return "", &exitError{code: exitFailure}
+	}
+	if err := pullOllamaModel(recommendedOllamaModel); err != nil {
+		return "", err
+	}
+	return recommendedOllamaModel, nil
+}
+
+// pullOllamaModel downloads model with "ollama pull", which shows its
+// progress on the terminal. The cached model list no longer holds, so it is
+// dropped.
+func pullOllamaModel(model string) error {
+	fmt.Printf("Pulling %s...\n", model)
+	cmd := exec.Command("ollama", "pull", model)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", model, err)
+	}
+	os.Remove(modelListCachePath())
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// signerTimeout bounds a run of the request_signer command.
+const signerTimeout = 10 * time.Second
+
+// RequestSigner is a command that adds headers to the requests sent to the
+// providers, e.g. the HMAC signature and team header of an enterprise
+// gateway. It receives the JSON body on stdin and prints the headers as a
+// JSON object on stdout.
+type RequestSigner struct {
+	Command string `json:"command"`
+	// Hosts are the hosts (or host:port) whose requests are signed. By
+	// default the requests to the OpenAI API and to Ollama are.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// signingTransport runs the request_signer for the requests it applies to
+// before they are sent. A failing signer fails the request.
+type signingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	config, err := loadConfigOrDefault()
+	if err != nil || config.RequestSigner == nil || !config.RequestSigner.signs(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	headers, err := config.RequestSigner.sign(req.Context(), req.Method, req.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a RoundTripper must not change the request it was given
+	signed := req.Clone(req.Context())
+	signed.Body = io.NopCloser(bytes.NewReader(body))
+	for name, value := range headers {
+		signed.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(signed)
+}
+
+// signs reports whether requests to u are signed.
+func (s *RequestSigner) signs(u *url.URL) bool {
+	if len(s.Hosts) > 0 {
+		return slices.Contains(s.Hosts, u.Host) || slices.Contains(s.Hosts, u.Hostname())
+	}
+	hosts := []string{openAIBaseURL}
+	for _, host := range ollamaHosts() {
+		hosts = append(hosts, host.URL)
+	}
+	for _, host := range hosts {
+		if provider, err := url.Parse(host); err == nil && provider.Host == u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// sign runs the command for a request and returns the headers it printed.
+// The method and URL are passed in AI_CLI_REQUEST_METHOD and
+// AI_CLI_REQUEST_URL, for signatures that cover them.
+func (s *RequestSigner) sign(ctx context.Context, method string, u *url.URL, body []byte) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, signerTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.Command)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(), "AI_CLI_REQUEST_METHOD="+method, "AI_CLI_REQUEST_URL="+u.String())
+	cmd.Stdin = bytes.NewReader(body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("request_signer failed (%v): %s", err, msg)
+		}
+		return nil, fmt.Errorf("request_signer failed: %v", err)
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &headers); err != nil {
+		return nil, fmt.Errorf("request_signer must print the headers as a JSON object of strings: %v", err)
+	}
+	return headers, nil
+}
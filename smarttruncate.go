@@ -0,0 +1,145 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// elidedBody replaces the function bodies --smart-truncate removes.
+const elidedBody = "{ /* ... elided ... */ }"
+
+// elidableBody is a function body in a code source that can be elided.
+type elidableBody struct {
+	source    int    // index into the sources
+	name      string // e.g. "Server.handle"
+	start     int    // byte offset of the opening brace
+	end       int    // byte offset after the closing brace
+	mentioned bool   // the name appears in the prompt
+}
+
+// codeBodyFinders find the function bodies of the code languages
+// --smart-truncate understands, by file extension.
+var codeBodyFinders = map[string]func(content string) []elidableBody{
+	".go": goFunctionBodies,
+}
+
+// smartTruncate shrinks the code among sources by about excess tokens by
+// eliding function bodies, largest first. The package clause, imports,
+// types and signatures are kept, and functions named in the prompt are
+// elided last. It reports whether anything was elided.
+func smartTruncate(sources []contextSource, prompt string, excess int, opts *options) bool {
+	mentioned := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(prompt, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		mentioned[word] = true
+	}
+
+	var bodies []elidableBody
+	for i, source := range sources {
+		find := codeBodyFinders[strings.ToLower(filepath.Ext(source.Name))]
+		if find == nil {
+			continue
+		}
+		for _, body := range find(source.Content) {
+			body.source = i
+			_, method, _ := strings.Cut(body.name, ".")
+			body.mentioned = mentioned[body.name] || mentioned[method]
+			bodies = append(bodies, body)
+		}
+	}
+	slices.SortStableFunc(bodies, func(a, b elidableBody) int {
+		if a.mentioned != b.mentioned {
+			if a.mentioned {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(b.end-b.start, a.end-a.start)
+	})
+
+	// elide until enough is saved, then cut each source from the back so
+	// the offsets stay valid
+	needed := excess * charsPerToken
+	var elided []elidableBody
+	for _, body := range bodies {
+		if needed <= 0 || body.end-body.start <= len(elidedBody) {
+			break
+		}
+		elided = append(elided, body)
+		needed -= body.end - body.start - len(elidedBody)
+	}
+	if needed > 0 {
+		notef("Warning: the prompt is still ~%s tokens over the context window after eliding function bodies\n", formatTokenCount(needed/charsPerToken))
+	}
+	slices.SortFunc(elided, func(a, b elidableBody) int {
+		return cmp.Or(cmp.Compare(a.source, b.source), cmp.Compare(b.start, a.start))
+	})
+	names := make(map[int][]string)
+	for _, body := range elided {
+		content := sources[body.source].Content
+		sources[body.source].Content = content[:body.start] + elidedBody + content[body.end:]
+		names[body.source] = append(names[body.source], fmt.Sprintf("%s (%s)", body.name, formatBytes(body.end-body.start)))
+	}
+
+	if opts.verbose {
+		for i, source := range sources {
+			if len(names[i]) > 0 {
+				slices.Reverse(names[i])
+				notef("Elided in %s: %s\n", source.Name, strings.Join(names[i], ", "))
+			}
+		}
+	}
+	return len(elided) > 0
+}
+
+// goFunctionBodies finds the bodies of the functions and methods of Go
+// source. Files that don't parse have none.
+func goFunctionBodies(content string) []elidableBody {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var bodies []elidableBody
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		name := fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			name = receiverName(fn.Recv.List[0].Type) + "." + name
+		}
+		bodies = append(bodies, elidableBody{
+			name:  name,
+			start: fset.Position(fn.Body.Lbrace).Offset,
+			end:   fset.Position(fn.Body.Rbrace).Offset + 1,
+		})
+	}
+	return bodies
+}
+
+// receiverName returns the type name of a method receiver, e.g. "Server"
+// for *Server or Set[T].
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minSquashRun is the number of identical consecutive lines from which
+// they are replaced by a single line and a repeat marker.
+const minSquashRun = 3
+
+// squashPipedInput shrinks whitespace-heavy piped input such as logs: runs
+// of identical lines become the line and a «line repeated N times» marker,
+// more than two blank lines in a row become two, and trailing whitespace
+// is removed, as are blank lines at the start and end. It is applied to piped input for cloud providers unless
+// --no-squash is given.
+func squashPipedInput(piped string, opts *options) string {
+	lines := strings.Split(piped, "\n")
+	var b strings.Builder
+	blank := 0
+	for i := 0; i < len(lines); {
+		line := strings.TrimRight(lines[i], " \t\r")
+		run := 1
+		for i+run < len(lines) && strings.TrimRight(lines[i+run], " \t\r") == line {
+			run++
+		}
+		i += run
+
+		if line == "" {
+			blank += run
+			continue
+		}
+		// leading and trailing blank lines are dropped
+		if b.Len() > 0 {
+			b.WriteString(strings.Repeat("\n", 1+min(blank, 2)))
+		}
+		blank = 0
+		b.WriteString(line)
+		if run >= minSquashRun {
+			fmt.Fprintf(&b, "\n«line repeated %d times»", run)
+		} else if run == 2 {
+			b.WriteString("\n" + line)
+		}
+	}
+	squashed := b.String()
+
+	if opts.verbose && len(squashed) < len(piped) {
+		notef("Squashed piped input: %s -> %s (~%s -> ~%s tokens)\n", formatBytes(len(piped)), formatBytes(len(squashed)),
+			formatTokenCount(estimateTokens(piped)), formatTokenCount(estimateTokens(squashed)))
+	}
+	return squashed
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string // relative to the test directory
+		existing []byte // written before, if not nil
+		data     []byte
+		perm     os.FileMode
+	}{
+		{name: "new file", path: "state.json", data: []byte(`{"a":1}`), perm: 0600},
+		{name: "replaces file", path: "state.json", existing: []byte("old content that is longer"), data: []byte("new"), perm: 0600},
+		{name: "creates directories", path: "cache/models/list.json", data: []byte("[]"), perm: 0600},
+		{name: "empty data", path: "empty", existing: []byte("something"), data: []byte{}, perm: 0600},
+		{name: "permissions", path: "answer.md", data: []byte("# Answer\n"), perm: 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.path)
+			if tt.existing != nil {
+				if err := os.WriteFile(path, tt.existing, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writeFileAtomic(path, tt.data, tt.perm); err != nil {
+				t.Fatalf("writeFileAtomic: %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("content = %q, want %q", got, tt.data)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != tt.perm {
+				t.Errorf("permissions = %v, want %v", perm, tt.perm)
+			}
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				var names []string
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				t.Errorf("directory holds %v, want only %s", names, filepath.Base(path))
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last.json")
+	const writers = 20
+	contents := make(map[string]bool)
+	for i := range writers {
+		// sizes differ, so a torn write would show as a mix of two
+		contents[fmt.Sprintf("%d:%s", i, bytes.Repeat([]byte{'a' + byte(i)}, 1000*(i+1)))] = true
+	}
+
+	var wg sync.WaitGroup
+	for content := range contents {
+		wg.Go(func() {
+			if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+				t.Errorf("writeFileAtomic: %v", err)
+			}
+		})
+		wg.Go(func() {
+			data, err := os.ReadFile(path)
+			if err == nil && !contents[string(data)] {
+				t.Errorf("read a partial file of %d bytes", len(data))
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contents[string(data)] {
+		t.Errorf("final file of %d bytes is none of the written ones", len(data))
+	}
+}
+
+func TestWithFileLockConcurrent(t *testing.T) {
+	// every writer reads, increments and rewrites a counter; without the
+	// lock, increments get lost
+	path := filepath.Join(t.TempDir(), "counter")
+	const writers = 50
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Go(func() {
+			err := withFileLock(path, func() error {
+				data, err := os.ReadFile(path)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				n, _ := strconv.Atoi(string(data))
+				return writeFileAtomic(path, []byte(strconv.Itoa(n+1)), 0600)
+			})
+			if err != nil {
+				t.Errorf("withFileLock: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := strconv.Atoi(string(data)); n != writers {
+		t.Errorf("counter = %d, want %d", n, writers)
+	}
+}
+
+func TestAppendJSONLineConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	const writers, lines = 10, 50
+	type entry struct {
+		Writer int    `json:"writer"`
+		Line   int    `json:"line"`
+		Prompt string `json:"prompt"`
+	}
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Go(func() {
+			for l := range lines {
+				e := entry{Writer: w, Line: l, Prompt: string(bytes.Repeat([]byte("x"), 5000))}
+				if err := appendJSONLine(path, e); err != nil {
+					t.Errorf("appendJSONLine: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := make(map[[2]int]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %d isn't valid JSON: %v", len(seen)+1, err)
+		}
+		seen[[2]int{e.Writer, e.Line}] = true
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("%d distinct lines, want %d", len(seen), writers*lines)
+	}
+}
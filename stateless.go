@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Stateless mode runs with the model from the environment and without the
+// home directory: no configuration is read or created and no state is
+// stored, for cron jobs and containers. AI_CLI_STATE_DIR keeps the state
+// (last request, usage log, sessions, caches) in a directory of its own.
+const (
+	statelessProviderEnv = "AI_CLI_PROVIDER"
+	statelessModelEnv    = "AI_CLI_MODEL"
+	stateDirEnv          = "AI_CLI_STATE_DIR"
+)
+
+// statelessMode reports whether AI_CLI_PROVIDER and AI_CLI_MODEL are set.
+func statelessMode() bool {
+	return os.Getenv(statelessProviderEnv) != "" && os.Getenv(statelessModelEnv) != ""
+}
+
+// statelessConfig returns the configuration of stateless mode.
+func statelessConfig() (*Config, error) {
+	provider := Provider(os.Getenv(statelessProviderEnv))
+	if !slices.Contains(knownProviders, provider) && !provider.isPlugin() {
+		return nil, fmt.Errorf("invalid %s %q: must be ollama, lmstudio, openai or a plugin on PATH", statelessProviderEnv, provider)
+	}
+	return &Config{Provider: provider, Model: os.Getenv(statelessModelEnv)}, nil
+}
+
+// stateDisabled reports whether no state may be stored: in stateless mode
+// unless AI_CLI_STATE_DIR names a directory for it.
+func stateDisabled() bool {
+	return statelessMode() && os.Getenv(stateDirEnv) == ""
+}
+
+// errStatelessConfig is the error of changes to the configuration.
+var errStatelessConfig = fmt.Errorf("stateless mode: the model comes from %s and %s, the configuration can't be changed", statelessProviderEnv, statelessModelEnv)
+
+// errNoState is the error of features that need the stored state.
+var errNoState = fmt.Errorf("stateless mode: nothing is stored (set %s to keep state)", stateDirEnv)
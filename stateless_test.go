@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatelessEnvironment(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     string
+		model        string
+		stateDir     string
+		stateless    bool
+		noState      bool
+		wantProvider Provider
+		wantErr      bool
+	}{
+		{name: "not set"},
+		{name: "provider only", provider: "ollama"},
+		{name: "model only", model: "llama3.2"},
+		{name: "both", provider: "ollama", model: "llama3.2", stateless: true, noState: true, wantProvider: Ollama},
+		{name: "with state dir", provider: "openai", model: "gpt-5-mini", stateDir: "/tmp/ai-state", stateless: true, wantProvider: OpenAI},
+		{name: "unknown provider", provider: "nope", model: "x", stateless: true, noState: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(statelessProviderEnv, tt.provider)
+			t.Setenv(statelessModelEnv, tt.model)
+			t.Setenv(stateDirEnv, tt.stateDir)
+
+			if got := statelessMode(); got != tt.stateless {
+				t.Errorf("statelessMode = %v, want %v", got, tt.stateless)
+			}
+			if got := stateDisabled(); got != tt.noState {
+				t.Errorf("stateDisabled = %v, want %v", got, tt.noState)
+			}
+			if !tt.stateless {
+				return
+			}
+			config, err := loadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadConfig accepted provider %q", tt.provider)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if config.Provider != tt.wantProvider || config.Model != tt.model {
+				t.Errorf("config = [%s] %s, want [%s] %s", config.Provider, config.Model, tt.wantProvider, tt.model)
+			}
+			if err := saveConfig(config); err != errStatelessConfig {
+				t.Errorf("saveConfig = %v, want errStatelessConfig", err)
+			}
+		})
+	}
+}
+
+func TestStatelessRunWithoutHome(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "pong"}, "finish_reason": "stop"}},
+			"usage":   map[string]int{"prompt_tokens": 3, "completion_tokens": 1},
+		})
+	}))
+	defer provider.Close()
+	defer func(url string) { openAIBaseURL = url }(openAIBaseURL)
+	openAIBaseURL = provider.URL
+
+	// without HOME, paths below the home directory would end up in the
+	// working directory, which must stay empty
+	work := t.TempDir()
+	t.Chdir(work)
+	t.Setenv("HOME", "")
+	os.Unsetenv("HOME")
+	t.Setenv(statelessProviderEnv, "openai")
+	t.Setenv(statelessModelEnv, "gpt-5-mini")
+	t.Setenv(stateDirEnv, "")
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	stdout := captureStdout(t)
+	opts, args, err := parseOptions([]string{"--quiet", "ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := run(opts, args); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(stdout()); got != "pong" {
+		t.Errorf("answer = %q, want pong", got)
+	}
+
+	entries, err := os.ReadDir(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("stateless run created %s", entry.Name())
+	}
+}
+
+// captureStdout redirects os.Stdout to a file for the rest of the test.
+// The returned function reads what was written so far.
+func captureStdout(t *testing.T) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdout
+	os.Stdout = f
+	t.Cleanup(func() {
+		os.Stdout = previous
+		f.Close()
+	})
+	return func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
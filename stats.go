@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// answerStats describes how an answer was produced.
+type answerStats struct {
+	provider         Provider
+	model            string
+	source           string // where the model choice came from
+	elapsed          time.Duration
+	evalDuration     time.Duration // the pure generation time, if known
+	promptTokens     int
+	cachedTokens     int
+	completionTokens int
+	// estimatedTokens is set if the provider reported no usage and the
+	// token counts are estimated from the text.
+	estimatedTokens bool
+	cost            float64
+	jsonAnswer      bool // a JSON answer was requested
+	repairRounds    int  // requests it took to fix invalid JSON
+}
+
+func newAnswerStats(req *chatRequest, result *completion, source string, elapsed time.Duration) *answerStats {
+	stats := &answerStats{
+		provider:         req.Provider,
+		model:            req.Model,
+		source:           source,
+		elapsed:          elapsed,
+		evalDuration:     result.EvalDuration,
+		promptTokens:     result.PromptTokens,
+		cachedTokens:     result.CachedTokens,
+		completionTokens: result.CompletionTokens,
+		cost:             completionCost(req, result),
+		jsonAnswer:       req.Format != nil,
+		repairRounds:     result.RepairRounds,
+	}
+	// some OpenAI-compatible servers, e.g. LM Studio when streaming, report
+	// no usage
+	if result.PromptTokens == 0 && result.CompletionTokens == 0 && result.Content != "" {
+		stats.promptTokens = estimateMessageTokens(req.Messages)
+		stats.completionTokens = estimateTokens(result.Content)
+		stats.estimatedTokens = true
+	}
+	return stats
+}
+
+// showFooter reports whether the footer is printed after an answer: only
+// for a person watching stderr, and not with --quiet or show_footer false.
+func showFooter(config *Config, opts *options) bool {
+	if opts.answered == nil || opts.quiet || (config.ShowFooter != nil && !*config.ShowFooter) {
+		return false
+	}
+	return isTerminal(os.Stderr)
+}
+
+// printFooter writes a dim one-line summary such as
+// "— openai/gpt-5-mini · 1.8s · 412 tok" to stderr.
+func (s *answerStats) printFooter() {
+	tokens := fmt.Sprint(s.promptTokens + s.completionTokens)
+	if s.estimatedTokens {
+		tokens = "~" + tokens
+	}
+	footer := fmt.Sprintf("— %s/%s · %.1fs · %s tok", s.provider, s.model, s.elapsed.Seconds(), tokens)
+	fmt.Fprintln(os.Stderr, styled(os.Stderr, styleDim, footer))
+}
+
+// print writes the statistics to stderr.
+func (s *answerStats) print() {
+	fmt.Fprintf(os.Stderr, "Model:  [%s] %s (from %s)\n", s.provider, s.model, s.source)
+	fmt.Fprintf(os.Stderr, "Time:   %s\n", formatMS(s.elapsed.Milliseconds()))
+	switch {
+	case s.estimatedTokens:
+		fmt.Fprintf(os.Stderr, "Tokens: ~%d prompt, ~%d completion (estimated, not reported by %s)\n", s.promptTokens, s.completionTokens, s.provider.displayName())
+	case s.cachedTokens > 0:
+		fmt.Fprintf(os.Stderr, "Tokens: %d prompt (%d cached), %d completion\n", s.promptTokens, s.cachedTokens, s.completionTokens)
+	default:
+		fmt.Fprintf(os.Stderr, "Tokens: %d prompt, %d completion\n", s.promptTokens, s.completionTokens)
+	}
+	if speed := s.speed(); speed > 0 {
+		fmt.Fprintf(os.Stderr, "Speed:  %.1f tok/s\n", speed)
+	}
+	if !s.provider.isLocal() {
+		outdated := ""
+		if s.provider == OpenAI && catalogOutdated() {
+			outdated = " (prices may be outdated)"
+		}
+		fmt.Fprintf(os.Stderr, "Cost:   $%.4f%s\n", s.cost, outdated)
+	}
+	if s.jsonAnswer {
+		fmt.Fprintf(os.Stderr, "JSON:   valid (repair rounds: %d)\n", s.repairRounds)
+	}
+}
+
+// speed returns the completion tokens per second: of the generation alone
+// where the provider reports its time, else of the whole request.
+func (s *answerStats) speed() float64 {
+	duration := s.evalDuration
+	if duration <= 0 {
+		duration = s.elapsed
+	}
+	if s.completionTokens == 0 || duration <= 0 {
+		return 0
+	}
+	return float64(s.completionTokens) / duration.Seconds()
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultStreamIdleTimeout = 30 * time.Second
+
+// streamFirstByteTimeout is how long a stream may stay silent before its
+// first data: reasoning models can think for minutes before they send
+// anything, so the idle timeout only applies once data has arrived.
+const streamFirstByteTimeout = 5 * time.Minute
+
+// streamTarget receives a streamed answer as it arrives.
+type streamTarget struct {
+	w           io.Writer
+	idleTimeout time.Duration // give up if no data arrives for this long
+	// thinking shows the wait for the answer on the terminal, if set.
+	thinking *thinkingDisplay
+	// meter shows the speed of the answer with --meter, if set.
+	meter *streamMeter
+}
+
+// streamTruncatedError reports that a stream stalled. The completion
+// returned with it holds the part of the answer received until then.
+type streamTruncatedError struct {
+	idle time.Duration
+}
+
+func (e *streamTruncatedError) Error() string {
+	return fmt.Sprintf("response truncated after %s of inactivity", e.idle)
+}
+
+// streamIdleTimeout returns the configured inter-chunk timeout.
+func streamIdleTimeout(config *Config) time.Duration {
+	if config.StreamIdleTimeout > 0 {
+		return time.Duration(config.StreamIdleTimeout) * time.Second
+	}
+	return defaultStreamIdleTimeout
+}
+
+// idleReader cancels a request when no data arrived for a while: for the
+// idle timeout once data arrived, and for streamFirstByteTimeout before.
+// Every read that returns data restarts the timer.
+type idleReader struct {
+	r        io.Reader
+	timer    *time.Timer
+	idle     time.Duration
+	first    time.Duration
+	received atomic.Bool
+	stalled  atomic.Bool
+}
+
+func newIdleReader(r io.Reader, idle time.Duration, cancel context.CancelFunc) *idleReader {
+	ir := &idleReader{r: r, idle: idle, first: max(idle, streamFirstByteTimeout)}
+	ir.timer = time.AfterFunc(ir.first, func() {
+		ir.stalled.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.received.Store(true)
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+// truncated returns the error of a stalled stream, with the time it was
+// waited for.
+func (r *idleReader) truncated() *streamTruncatedError {
+	if r.received.Load() {
+		return &streamTruncatedError{idle: r.idle}
+	}
+	return &streamTruncatedError{idle: r.first}
+}
+
+func (r *idleReader) stop() {
+	r.timer.Stop()
+}
+
+// streamOpenAI sends req with streaming enabled and copies the answer to
+// target as server-sent events arrive.
+func streamOpenAI(chatReq *chatRequest, target *streamTarget) (*completion, error) {
+	baseURL, apiKey, err := openAIEndpoint(chatReq.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody := OpenAIRequest{
+		Model:          chatReq.Model,
+		Messages:       chatReq.Messages,
+		Temperature:    chatReq.Temperature,
+		MaxTokens:      chatReq.MaxTokens,
+		Stream:         true,
+		StreamOptions:  &OpenAIStreamOptions{IncludeUsage: true},
+		ResponseFormat: chatReq.Format.openAI(),
+		User:           chatReq.User,
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, sendError(chatReq.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// errors come as a plain JSON body, not as events
+		var openAIResp OpenAIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil || openAIResp.Error == nil {
+			return nil, apiError(chatReq.Provider, resp.StatusCode, "%s API error: %s", chatReq.Provider.displayName(), resp.Status)
+		}
+		if openAIResp.Error.Code == "model_not_found" {
+			return nil, &modelUnavailableError{provider: chatReq.Provider, model: chatReq.Model, reason: openAIResp.Error.Message}
+		}
+		return nil, apiError(chatReq.Provider, resp.StatusCode, "%s API error: %s", chatReq.Provider.displayName(), openAIResp.Error.Message)
+	}
+
+	body := newIdleReader(resp.Body, target.idleTimeout, cancel)
+	defer body.stop()
+	target.thinking.begin()
+	defer target.thinking.end()
+
+	result := &completion{}
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("%s API error: %s", chatReq.Provider.displayName(), chunk.Error.Message)
+		}
+		if len(chunk.Choices) > 0 {
+			target.thinking.reasoning(chunk.Choices[0].Delta.ReasoningContent)
+			result.Refusal += chunk.Choices[0].Delta.Refusal
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			target.thinking.answer()
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			io.WriteString(target.w, chunk.Choices[0].Delta.Content)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			result.FinishReason = finishReason(chunk.Choices[0].FinishReason)
+			result.RawFinishReason = chunk.Choices[0].FinishReason
+		}
+		if chunk.Usage != nil {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CachedTokens = chunk.Usage.PromptTokensDetails.CachedTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+	}
+	result.Content = content.String()
+	return result, streamError(scanner.Err(), body, target)
+}
+
+// streamOllama sends req with streaming enabled and copies the answer to
+// target as the JSON lines arrive.
+func streamOllama(chatReq *chatRequest, target *streamTarget) (*completion, error) {
+	installed, err := isModelInstalled(chatReq.Model)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, &modelUnavailableError{provider: Ollama, model: chatReq.Model, reason: "not installed"}
+	}
+
+	reqBody := OllamaChatRequest{
+		Model:    chatReq.Model,
+		Messages: toOllamaMessages(chatReq.Messages),
+		Stream:   true,
+		Format:   chatReq.Format.ollama(),
+		Think:    chatReq.Think,
+	}
+	reqBody.Options = ollamaOptions(chatReq)
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, err := postOllama(ctx, chatReq.Model, "/api/chat", jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body := newIdleReader(resp.Body, target.idleTimeout, cancel)
+	defer body.stop()
+	target.thinking.begin()
+	defer target.thinking.end()
+
+	result := &completion{}
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk OllamaChatResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+		target.thinking.reasoning(chunk.Message.Thinking)
+		if chunk.Message.Content != "" {
+			target.thinking.answer()
+		}
+		content.WriteString(chunk.Message.Content)
+		io.WriteString(target.w, chunk.Message.Content)
+		if chunk.Done {
+			result.PromptTokens = chunk.PromptEvalCount
+			result.CompletionTokens = chunk.EvalCount
+			result.EvalDuration = time.Duration(chunk.EvalDuration)
+			result.FinishReason = finishReason(chunk.DoneReason)
+			result.RawFinishReason = chunk.DoneReason
+			break
+		}
+	}
+	result.Content = content.String()
+	return result, streamError(scanner.Err(), body, target)
+}
+
+// streamError turns a read error into a streamTruncatedError if the stream
+// was cancelled for inactivity.
+func streamError(err error, body *idleReader, target *streamTarget) error {
+	if body.stalled.Load() {
+		return body.truncated()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil
+}
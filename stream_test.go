@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stallingSSE serves the events, then sends nothing until the client gives
+// up.
+func stallingSSE(events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+}
+
+func TestIdleReaderStalls(t *testing.T) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("partial answer"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		pw.CloseWithError(ctx.Err())
+	}()
+	r := newIdleReader(pr, 50*time.Millisecond, cancel)
+	defer r.stop()
+
+	start := time.Now()
+	data, err := io.ReadAll(r)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the cancellation", err)
+	}
+	if string(data) != "partial answer" {
+		t.Errorf("data = %q, want the part read before the stall", data)
+	}
+	if !r.stalled.Load() {
+		t.Error("the reader isn't marked as stalled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want about the idle timeout", elapsed)
+	}
+}
+
+func TestIdleReaderKeepsActiveStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		// every piece comes within the idle timeout, the whole stream not
+		for range 5 {
+			time.Sleep(20 * time.Millisecond)
+			pw.Write([]byte("."))
+		}
+		pw.Close()
+	}()
+	r := newIdleReader(pr, 60*time.Millisecond, func() { pw.CloseWithError(context.Canceled) })
+	defer r.stop()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if string(data) != "....." || r.stalled.Load() {
+		t.Errorf("data = %q, stalled = %v; want the whole stream", data, r.stalled.Load())
+	}
+}
+
+func TestIdleReaderWaitsLongerForFirstData(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		// a reasoning model thinking for longer than the idle timeout
+		time.Sleep(150 * time.Millisecond)
+		pw.Write([]byte("answer"))
+		pw.Close()
+	}()
+	r := newIdleReader(pr, 30*time.Millisecond, func() { pw.CloseWithError(context.Canceled) })
+	defer r.stop()
+
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "answer" || r.stalled.Load() {
+		t.Errorf("data = %q, err = %v, stalled = %v; want the answer after the silence", data, err, r.stalled.Load())
+	}
+	if got := r.truncated().idle; got != 30*time.Millisecond {
+		t.Errorf("truncated after data: idle = %s, want the idle timeout", got)
+	}
+	silent := newIdleReader(pr, time.Second, func() {})
+	defer silent.stop()
+	if got := silent.truncated().idle; got != streamFirstByteTimeout {
+		t.Errorf("truncated before data: idle = %s, want %s", got, streamFirstByteTimeout)
+	}
+}
+
+func TestStreamOpenAIStallKeepsPartialAnswer(t *testing.T) {
+	srv := stallingSSE(
+		`{"choices":[{"delta":{"content":"Hello"},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{"content":" from"},"finish_reason":null}]}`,
+	)
+	defer srv.Close()
+	t.Setenv("OPENAI_API_KEY", "test")
+	defer func(url string) { openAIBaseURL = url }(openAIBaseURL)
+	openAIBaseURL = srv.URL
+
+	var streamed bytes.Buffer
+	req := &chatRequest{Provider: OpenAI, Model: "gpt-test", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+	result, err := streamOpenAI(req, &streamTarget{w: &streamed, idleTimeout: 100 * time.Millisecond})
+
+	var truncated *streamTruncatedError
+	if !errors.As(err, &truncated) {
+		t.Fatalf("err = %v, want a streamTruncatedError", err)
+	}
+	if !strings.Contains(err.Error(), "inactivity") {
+		t.Errorf("err = %q, want it to mention the inactivity", err)
+	}
+	if result == nil || result.Content != "Hello from" {
+		t.Errorf("result = %+v, want the partial answer", result)
+	}
+	if streamed.String() != "Hello from" {
+		t.Errorf("streamed %q, want the partial answer", streamed.String())
+	}
+}
+
+func TestDeliverTruncatedAnswer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	output := filepath.Join(dir, "answer.md")
+	opts := &options{outputFiles: []string{output}, quiet: true}
+
+	err := deliver("Hello from", &streamTruncatedError{idle: 30 * time.Second}, opts)
+
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != exitTruncated {
+		t.Fatalf("err = %v, want exit code %d", err, exitTruncated)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("the partial answer wasn't written: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "Hello from") {
+		t.Errorf("-o file = %q, want the partial answer", data)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import "strings"
+
+// commands lists the subcommands recognized as the first argument. It is
+// used to catch typos before they are sent to the model as a prompt.
+var commands = []string{
+	"ask",
+	"init",
+	"set-model",
+	"use",
+	"models",
+	"unload",
+	"usage",
+	"purge",
+	"run",
+	"config",
+	"bench",
+	"compare",
+	"batch",
+	"retry",
+	"escalate",
+	"daemon",
+	"serve",
+	"tools",
+	"tpl",
+	"chat",
+	"sessions",
+	"roles",
+	"help",
+	"--help",
+}
+
+// suggestCommand returns the known command closest to arg if arg looks like
+// a mistyped command, or "" if arg should be treated as a prompt.
+func suggestCommand(arg string) string {
+	// multi-word arguments are prompts, not commands
+	if arg == "" || strings.ContainsAny(arg, " \t\n") {
+		return ""
+	}
+
+	best := ""
+	bestDistance := -1
+	for _, command := range commands {
+		d := levenshtein(strings.ToLower(arg), command)
+		if d == 0 {
+			return ""
+		}
+		if d > maxTypoDistance(command) {
+			continue
+		}
+		if bestDistance < 0 || d < bestDistance {
+			best = command
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// maxTypoDistance is the largest edit distance still considered a typo of
+// command. Short commands only tolerate a single edit.
+func maxTypoDistance(command string) int {
+	if len(command) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
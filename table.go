@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tableSampleRows is how many rows from the start and the end of a table
+	// are shown in --table mode.
+	tableSampleRows = 5
+	// tableTypeSampleRows is how many rows are used to infer column types.
+	tableTypeSampleRows = 1000
+)
+
+// tabularInput reduces CSV/TSV data to a summary when --table is given. Data
+// that isn't tabular, or --table=full, leaves it unchanged.
+func tabularInput(name, data string, opts *options) string {
+	if opts.table != "summary" || data == "" {
+		return data
+	}
+	summary, ok := summarizeTable(data)
+	if !ok {
+		notef("Warning: %s doesn't look like CSV/TSV, sending it unchanged\n", name)
+		return data
+	}
+	if opts.verbose {
+		notef("Summarized table %s: %s -> %s\n", name, formatBytes(len(data)), formatBytes(len(summary)))
+	}
+	return summary
+}
+
+// summarizeTable describes CSV or TSV data by its header, inferred column
+// types, row count and the first and last rows. It reports false if data
+// doesn't look like a table.
+func summarizeTable(data string) (string, bool) {
+	comma, format := detectDelimiter(data)
+	if comma == 0 {
+		return "", false
+	}
+
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil || len(records) < 2 || len(records[0]) < 2 {
+		return "", false
+	}
+	header, rows := records[0], records[1:]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Table summary (%s, %d rows plus header, %d columns)\n\nColumns:\n", format, len(rows), len(header))
+	for i, column := range header {
+		fmt.Fprintf(&b, "- %s: %s\n", column, inferColumnType(rows, i))
+	}
+
+	if len(rows) <= 2*tableSampleRows {
+		b.WriteString("\nAll rows:\n")
+		writeRecords(&b, comma, append([][]string{header}, rows...))
+		return b.String(), true
+	}
+	fmt.Fprintf(&b, "\nFirst %d rows:\n", tableSampleRows)
+	writeRecords(&b, comma, append([][]string{header}, rows[:tableSampleRows]...))
+	fmt.Fprintf(&b, "...\n\nLast %d rows:\n", tableSampleRows)
+	writeRecords(&b, comma, rows[len(rows)-tableSampleRows:])
+	return b.String(), true
+}
+
+// detectDelimiter guesses the delimiter from the first line: tabs for TSV,
+// commas or semicolons for CSV. It returns 0 if there is none.
+func detectDelimiter(data string) (rune, string) {
+	first, _, _ := strings.Cut(data, "\n")
+	best, bestCount := rune(0), 0
+	for _, c := range []rune{'\t', ',', ';'} {
+		if n := strings.Count(first, string(c)); n > bestCount {
+			best, bestCount = c, n
+		}
+	}
+	if best == '\t' {
+		return best, "TSV"
+	}
+	return best, "CSV"
+}
+
+// inferColumnType names the type of a column from a sample of its values.
+func inferColumnType(rows [][]string, column int) string {
+	isInt, isFloat, isBool, isDate := true, true, true, true
+	seen, empty := 0, 0
+	for _, row := range rows[:min(len(rows), tableTypeSampleRows)] {
+		if column >= len(row) {
+			continue
+		}
+		value := strings.TrimSpace(row[column])
+		if value == "" {
+			empty++
+			continue
+		}
+		seen++
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			isInt = false
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			isFloat = false
+		}
+		if _, err := strconv.ParseBool(value); err != nil {
+			isBool = false
+		}
+		if !isDateValue(value) {
+			isDate = false
+		}
+	}
+
+	kind := "string"
+	switch {
+	case seen == 0:
+		return "empty"
+	case isBool && !isInt:
+		kind = "boolean"
+	case isInt:
+		kind = "integer"
+	case isFloat:
+		kind = "number"
+	case isDate:
+		kind = "date"
+	}
+	if empty > 0 {
+		kind += " (some empty)"
+	}
+	return kind
+}
+
+func isDateValue(value string) bool {
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRecords writes records to b in the table's own format.
+func writeRecords(b *strings.Builder, comma rune, records [][]string) {
+	w := csv.NewWriter(b)
+	w.Comma = comma
+	w.WriteAll(records)
+}
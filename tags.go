@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// tagsEnv holds comma-separated tags added to every request, for scripts
+// that can't pass --tag.
+const tagsEnv = "AI_CLI_TAGS"
+
+// userEnv sets the user of requests, overriding user_id.
+const userEnv = "AI_CLI_USER"
+
+// maxMetadataValue is the longest metadata value OpenAI accepts.
+const maxMetadataValue = 512
+
+// requestTags returns the tags of AI_CLI_TAGS followed by the --tag
+// values, without duplicates.
+func requestTags(opts *options) []string {
+	var tags []string
+	for _, tag := range append(strings.Split(os.Getenv(tagsEnv), ","), opts.tags...) {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// openAIMetadata passes the tags of a request to OpenAI, so its usage
+// dashboard can be filtered by them.
+func openAIMetadata(tags []string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	value := strings.Join(tags, ",")
+	if len(value) > maxMetadataValue {
+		value = value[:maxMetadataValue]
+	}
+	return map[string]string{"tags": value}
+}
+
+// requestUser returns the end user sent with OpenAI requests for abuse
+// monitoring: AI_CLI_USER, else user_id, else none.
+func requestUser(config *Config) string {
+	if user := strings.TrimSpace(os.Getenv(userEnv)); user != "" {
+		return user
+	}
+	return config.UserID
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingOpenAI answers every request with "ok" and returns the request
+// bodies received so far.
+func recordingOpenAI(t *testing.T) func() []OpenAIRequest {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []OpenAIRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "ok"}, "finish_reason": "stop"}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	previous := openAIBaseURL
+	openAIBaseURL = srv.URL
+	t.Cleanup(func() { openAIBaseURL = previous })
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("HOME", t.TempDir())
+	return func() []OpenAIRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestEveryRequestHasUser(t *testing.T) {
+	requests := recordingOpenAI(t)
+	t.Setenv(userEnv, "alice@example.com")
+	config := &Config{Provider: OpenAI, Model: "gpt-5-mini"}
+	if err := saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	opts := &options{}
+	exchange := []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"x","messages":[{"role":"user","content":"hi"}]}`))
+	handleServeChat(httptest.NewRecorder(), r, opts)
+	if _, err := sessionTitle(config, OpenAI, "gpt-5-mini", exchange, opts); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := buildRequest(config, opts, "hi")
+	if _, err := summarizeHistory(config, req, "", exchange, 1000, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want serve, title and summary", len(got))
+	}
+	for i, req := range got {
+		if req.User != "alice@example.com" {
+			t.Errorf("request %d: user = %q", i, req.User)
+		}
+	}
+}
+
+func TestEveryRequestIsTagged(t *testing.T) {
+	recordingOpenAI(t)
+	t.Setenv(tagsEnv, "ci")
+	config := &Config{Provider: OpenAI, Model: "gpt-5-mini"}
+	if err := saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	opts := &options{tags: []string{"deploy"}}
+	exchange := []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"x","messages":[{"role":"user","content":"hi"}]}`))
+	handleServeChat(httptest.NewRecorder(), r, opts)
+	if _, err := sessionTitle(config, OpenAI, "gpt-5-mini", exchange, opts); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := buildRequest(config, opts, "hi")
+	if _, err := summarizeHistory(config, req, "", exchange, 1000, opts); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t)
+	if err := compareCommand([]string{"hi"}, &options{models: []string{"openai/gpt-5-mini", "openai/gpt-5-nano"}, tags: opts.tags}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := loadUsage(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("%d usage records, want serve, title, summary and two from compare", len(records))
+	}
+	for i, record := range records {
+		if strings.Join(record.Tags, ",") != "ci,deploy" {
+			t.Errorf("record %d: tags = %q", i, record.Tags)
+		}
+	}
+}
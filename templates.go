@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// templateInputPlaceholder is replaced by the words given after the
+// template name.
+const templateInputPlaceholder = "{{input}}"
+
+// includePattern matches {{include "name"}}, which is replaced by the
+// fragment of that name.
+var includePattern = regexp.MustCompile(`\{\{\s*include\s+"([^"]*)"\s*\}\}`)
+
+// reservedTemplateNames are tpl subcommands and can't name a template.
+var reservedTemplateNames = []string{"list", "import", "export", "test", "show", "help"}
+
+// Template is a reusable prompt run with "ai-cli tpl <name>".
+type Template struct {
+	Description string `json:"description,omitempty"`
+	// Prompt is the instruction. "{{input}}" is replaced by the words given
+	// on the command line; without it they are appended. {{include "name"}}
+	// inserts a fragment.
+	Prompt string `json:"prompt"`
+	// Extends names a template whose prompt comes before this one's and
+	// whose model and description are used unless this one sets them.
+	Extends string `json:"extends,omitempty"`
+	// Model overrides the default model for this template.
+	Model string `json:"model,omitempty"`
+	// Source is the file or URL the template was imported from.
+	Source string `json:"source,omitempty"`
+	// Tests are example runs checked by "ai-cli tpl test".
+	Tests []TemplateTest `json:"tests,omitempty"`
+}
+
+// Role is a named system prompt selected with --role.
+type Role struct {
+	Description  string `json:"description,omitempty"`
+	SystemPrompt string `json:"system_prompt"`
+	// Model overrides the default model while the role is used.
+	Model string `json:"model,omitempty"`
+	// Source is the file or URL the role was imported from.
+	Source string `json:"source,omitempty"`
+	// BakedModel is the Ollama model "roles bake" derived from BakedFrom
+	// with the system prompt built in.
+	BakedModel string `json:"baked_model,omitempty"`
+	BakedFrom  string `json:"baked_from,omitempty"`
+}
+
+// templateLibrary is the format of "tpl import" and "tpl export".
+type templateLibrary struct {
+	Templates map[string]Template `json:"templates,omitempty"`
+	Roles     map[string]Role     `json:"roles,omitempty"`
+	Fragments map[string]string   `json:"fragments,omitempty"`
+}
+
+// validate rejects entries that couldn't be used.
+func (l *templateLibrary) validate() error {
+	for name, tpl := range l.Templates {
+		if err := validateTemplateName(name); err != nil {
+			return err
+		}
+		if slices.Contains(reservedTemplateNames, name) {
+			return fmt.Errorf("template name '%s' is reserved", name)
+		}
+		if strings.TrimSpace(tpl.Prompt) == "" && tpl.Extends == "" {
+			return fmt.Errorf("template '%s' has no prompt", name)
+		}
+		for i, test := range tpl.Tests {
+			for _, assertion := range test.Expect {
+				if err := assertion.validate(); err != nil {
+					return fmt.Errorf("template '%s' test %d: %w", name, i+1, err)
+				}
+			}
+		}
+	}
+	for name, role := range l.Roles {
+		if err := validateTemplateName(name); err != nil {
+			return err
+		}
+		if strings.TrimSpace(role.SystemPrompt) == "" {
+			return fmt.Errorf("role '%s' has no system_prompt", name)
+		}
+	}
+	for name := range l.Fragments {
+		if err := validateTemplateName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateTemplateName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n/") {
+		return fmt.Errorf("invalid name '%s': names can't be empty or contain spaces or slashes", name)
+	}
+	return nil
+}
+
+// expandTemplate returns the prompt of a template for the given input words.
+func expandTemplate(tpl Template, input string) string {
+	if strings.Contains(tpl.Prompt, templateInputPlaceholder) {
+		return strings.ReplaceAll(tpl.Prompt, templateInputPlaceholder, input)
+	}
+	if input == "" {
+		return tpl.Prompt
+	}
+	return tpl.Prompt + "\n\n" + input
+}
+
+// resolveTemplate returns a template with the templates it extends merged
+// in and all includes expanded. Templates and fragments may build on each
+// other in any depth; a cycle or a missing name is an error that shows the
+// chain leading to it, e.g. "template review -> fragment tone -> fragment
+// style".
+func resolveTemplate(config *Config, name string) (Template, error) {
+	if _, ok := config.Templates[name]; !ok {
+		return Template{}, fmt.Errorf("unknown template: %s (see 'ai-cli tpl list')", name)
+	}
+	return resolveTemplateChain(config, name, nil)
+}
+
+func resolveTemplateChain(config *Config, name string, chain []string) (Template, error) {
+	link := "template " + name
+	next := append(slices.Clone(chain), link)
+	if slices.Contains(chain, link) {
+		return Template{}, fmt.Errorf("template cycle: %s", strings.Join(next, " -> "))
+	}
+	tpl, ok := config.Templates[name]
+	if !ok {
+		return Template{}, fmt.Errorf("unknown template %s: %s", name, strings.Join(next, " -> "))
+	}
+
+	prompt, err := expandIncludes(config, tpl.Prompt, next)
+	if err != nil {
+		return Template{}, err
+	}
+	tpl.Prompt = prompt
+	if tpl.Extends == "" {
+		return tpl, nil
+	}
+	parent, err := resolveTemplateChain(config, tpl.Extends, next)
+	if err != nil {
+		return Template{}, err
+	}
+	switch {
+	case strings.TrimSpace(parent.Prompt) == "":
+	case strings.TrimSpace(tpl.Prompt) == "":
+		tpl.Prompt = parent.Prompt
+	default:
+		tpl.Prompt = parent.Prompt + "\n\n" + tpl.Prompt
+	}
+	if tpl.Model == "" {
+		tpl.Model = parent.Model
+	}
+	if tpl.Description == "" {
+		tpl.Description = parent.Description
+	}
+	tpl.Extends = ""
+	return tpl, nil
+}
+
+// expandIncludes replaces the includes in text by their fragments, which
+// may include further fragments. chain leads to text, for errors.
+func expandIncludes(config *Config, text string, chain []string) (string, error) {
+	var err error
+	expanded := includePattern.ReplaceAllStringFunc(text, func(include string) string {
+		if err != nil {
+			return include
+		}
+		name := includePattern.FindStringSubmatch(include)[1]
+		link := "fragment " + name
+		next := append(slices.Clone(chain), link)
+		if slices.Contains(chain, link) {
+			err = fmt.Errorf("include cycle: %s", strings.Join(next, " -> "))
+			return include
+		}
+		fragment, ok := config.Fragments[name]
+		if !ok {
+			err = fmt.Errorf("unknown fragment %s: %s", name, strings.Join(next, " -> "))
+			return include
+		}
+		var fragmentErr error
+		fragment, fragmentErr = expandIncludes(config, fragment, next)
+		if fragmentErr != nil {
+			err = fragmentErr
+		}
+		return strings.TrimRight(fragment, "\n")
+	})
+	return expanded, err
+}
+
+// tplCommand runs a template or one of the template subcommands.
+func tplCommand(args []string, opts *options) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ai-cli tpl <name> [input...] | list | show <name> [--resolved] | import <file|url> [--force] | export | test [name]")
+	}
+	switch args[0] {
+	case "list":
+		return tplListCommand()
+	case "show":
+		return tplShowCommand(args[1:])
+	case "import":
+		return tplImportCommand(args[1:], opts)
+	case "export":
+		return tplExportCommand(args[1:], opts)
+	case "test":
+		return tplTestCommand(args[1:], opts)
+	}
+	return tplRunCommand(args[0], args[1:], opts)
+}
+
+// tplRunCommand sends the prompt of a template, with piped input as data.
+func tplRunCommand(name string, args []string, opts *options) error {
+	if err := ensureConfigExists(); err != nil {
+		return err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	tpl, err := resolveTemplate(config, name)
+	if err != nil {
+		return err
+	}
+
+	input := userInput{Prompt: expandTemplate(tpl, strings.Join(args, " "))}
+	if isPiped() {
+		piped, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read piped input: %w", err)
+		}
+		input.Piped = strings.TrimSpace(string(piped))
+	}
+
+	opts.template = name
+	output, err := executePrompt(input, opts)
+	return deliver(output, err, opts)
+}
+
+// tplListCommand prints the configured templates and roles.
+func tplListCommand() error {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+	if len(config.Templates) == 0 && len(config.Roles) == 0 && len(config.Fragments) == 0 {
+		fmt.Println("No templates or roles configured.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tDESCRIPTION\tSOURCE")
+	for _, name := range slices.Sorted(maps.Keys(config.Templates)) {
+		tpl := config.Templates[name]
+		fmt.Fprintf(w, "template\t%s\t%s\t%s\n", name, tpl.Description, tpl.Source)
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Roles)) {
+		role := config.Roles[name]
+		fmt.Fprintf(w, "role\t%s\t%s\t%s\n", name, role.Description, role.Source)
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Fragments)) {
+		fmt.Fprintf(w, "fragment\t%s\t\t\n", name)
+	}
+	return w.Flush()
+}
+
+// tplShowCommand prints a template as configured, or with --resolved as it
+// is sent: with the templates it extends merged in and includes expanded.
+func tplShowCommand(args []string) error {
+	name, resolved := "", false
+	for _, arg := range args {
+		switch {
+		case arg == "--resolved":
+			resolved = true
+		case name == "":
+			name = arg
+		default:
+			return fmt.Errorf("usage: ai-cli tpl show <name> [--resolved]")
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("usage: ai-cli tpl show <name> [--resolved]")
+	}
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	tpl, ok := config.Templates[name]
+	if !ok {
+		return fmt.Errorf("unknown template: %s (see 'ai-cli tpl list')", name)
+	}
+	if resolved {
+		if tpl, err = resolveTemplate(config, name); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(tpl, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// tplImportCommand merges templates and roles from a file or URL into the
+// configuration. Entries imported earlier from the same source are updated;
+// other existing entries are only replaced with --force.
+func tplImportCommand(args []string, opts *options) error {
+	source := ""
+	force := false
+	for _, arg := range args {
+		switch {
+		case arg == "--force":
+			force = true
+		case source == "":
+			source = arg
+		default:
+			return fmt.Errorf("usage: ai-cli tpl import <file|url> [--force]")
+		}
+	}
+	if source == "" {
+		return fmt.Errorf("usage: ai-cli tpl import <file|url> [--force]")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("not initialized: run once in interactive mode to configure")
+		}
+		return err
+	}
+
+	library, source, err := readTemplateLibrary(config, opts, source)
+	if err != nil {
+		return err
+	}
+	if len(library.Templates) == 0 && len(library.Roles) == 0 && len(library.Fragments) == 0 {
+		return fmt.Errorf("%s contains no templates or roles", source)
+	}
+
+	conflicts := 0
+	report := func(kind, name, existingSource string, exists bool) {
+		switch {
+		case !exists:
+			fmt.Printf("Added %s %s\n", kind, name)
+		case existingSource == source:
+			fmt.Printf("Updated %s %s\n", kind, name)
+		case force:
+			fmt.Printf("Overwrote %s %s\n", kind, name)
+		default:
+			fmt.Printf("Would overwrite %s %s\n", kind, name)
+			conflicts++
+		}
+	}
+
+	templates := make(map[string]Template)
+	for name, tpl := range config.Templates {
+		templates[name] = tpl
+	}
+	for _, name := range slices.Sorted(maps.Keys(library.Templates)) {
+		existing, exists := config.Templates[name]
+		report("template", name, existing.Source, exists)
+		tpl := library.Templates[name]
+		tpl.Source = source
+		templates[name] = tpl
+	}
+	roles := make(map[string]Role)
+	for name, role := range config.Roles {
+		roles[name] = role
+	}
+	for _, name := range slices.Sorted(maps.Keys(library.Roles)) {
+		existing, exists := config.Roles[name]
+		report("role", name, existing.Source, exists)
+		role := library.Roles[name]
+		role.Source = source
+		roles[name] = role
+	}
+	// fragments record no source; importing the same text again is an update
+	fragments := make(map[string]string)
+	for name, fragment := range config.Fragments {
+		fragments[name] = fragment
+	}
+	for _, name := range slices.Sorted(maps.Keys(library.Fragments)) {
+		existing, exists := config.Fragments[name]
+		existingSource := ""
+		if existing == library.Fragments[name] {
+			existingSource = source
+		}
+		report("fragment", name, existingSource, exists)
+		fragments[name] = library.Fragments[name]
+	}
+
+	if conflicts > 0 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("%d existing entries would be overwritten, nothing was imported (use --force to overwrite them)", conflicts)}
+	}
+
+	config.Templates, config.Roles, config.Fragments = templates, roles, fragments
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d templates, %d roles and %d fragments from %s\n", len(library.Templates), len(library.Roles), len(library.Fragments), source)
+	return nil
+}
+
+// readTemplateLibrary reads and validates a library from a local file or an
+// http(s) URL. It also returns the source as it is recorded on the entries.
+func readTemplateLibrary(config *Config, opts *options, source string) (*templateLibrary, string, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if isOffline(config, opts) {
+			return nil, "", fmt.Errorf("offline mode: importing from URLs not allowed")
+		}
+		text, _, err := fetchURL(source)
+		if err != nil {
+			return nil, "", err
+		}
+		data = []byte(text)
+	} else {
+		path, err := filepath.Abs(source)
+		if err != nil {
+			return nil, "", err
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, "", fmt.Errorf("failed to read templates: %w", err)
+		}
+		source = path
+	}
+
+	var library templateLibrary
+	if err := json.Unmarshal(data, &library); err != nil {
+		return nil, "", fmt.Errorf("invalid template file %s: %w", source, err)
+	}
+	if err := library.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid template file %s: %w", source, err)
+	}
+	return &library, source, nil
+}
+
+// tplExportCommand writes the local templates and roles in the import
+// format, without their sources.
+func tplExportCommand(args []string, opts *options) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ai-cli tpl export [-o file]")
+	}
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	library := templateLibrary{Templates: make(map[string]Template), Roles: make(map[string]Role), Fragments: config.Fragments}
+	for name, tpl := range config.Templates {
+		tpl.Source = ""
+		library.Templates[name] = tpl
+	}
+	for name, role := range config.Roles {
+		role.Source, role.BakedModel, role.BakedFrom = "", "", ""
+		library.Roles[name] = role
+	}
+
+	data, err := json.MarshalIndent(library, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(string(data)+"\n", opts.outputFiles)
+}
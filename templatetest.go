@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TemplateTest is an example run of a template with assertions on the
+// answer.
+type TemplateTest struct {
+	Input  string              `json:"input,omitempty"` // the words after the template name
+	Piped  string              `json:"piped,omitempty"` // data as if piped in
+	Expect []TemplateAssertion `json:"expect"`
+}
+
+// TemplateAssertion checks an answer. Exactly one field is set.
+type TemplateAssertion struct {
+	Contains   string         `json:"contains,omitempty"`
+	Regex      string         `json:"regex,omitempty"`
+	JSONSchema map[string]any `json:"json_schema,omitempty"`
+}
+
+// validate rejects assertions that check nothing or several things, and
+// invalid regular expressions.
+func (a TemplateAssertion) validate() error {
+	set := 0
+	for _, ok := range []bool{a.Contains != "", a.Regex != "", a.JSONSchema != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("an assertion needs exactly one of contains, regex or json_schema")
+	}
+	if a.Regex != "" {
+		if _, err := regexp.Compile(a.Regex); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", a.Regex, err)
+		}
+	}
+	return nil
+}
+
+func (a TemplateAssertion) String() string {
+	switch {
+	case a.Contains != "":
+		return fmt.Sprintf("contains %q", a.Contains)
+	case a.Regex != "":
+		return fmt.Sprintf("matches /%s/", a.Regex)
+	default:
+		return "is valid against the JSON schema"
+	}
+}
+
+// check returns why the answer fails the assertion, or "" if it passes.
+func (a TemplateAssertion) check(answer string) string {
+	switch {
+	case a.Contains != "":
+		if !strings.Contains(answer, a.Contains) {
+			return "text not found"
+		}
+	case a.Regex != "":
+		if !regexp.MustCompile(a.Regex).MatchString(answer) {
+			return "no match"
+		}
+	default:
+		var value any
+		if err := json.Unmarshal([]byte(stripJSONFence(answer)), &value); err != nil {
+			return fmt.Sprintf("not JSON: %v", err)
+		}
+		if err := checkJSONSchema(a.JSONSchema, value, "$"); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// stripJSONFence removes a Markdown code fence around a JSON answer.
+func stripJSONFence(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if match := codeFencePattern.FindStringSubmatch(answer); match != nil && strings.HasPrefix(answer, "```") {
+		return match[1]
+	}
+	return answer
+}
+
+// checkJSONSchema validates value against the commonly used part of JSON
+// Schema: type, enum, properties, required and items.
+func checkJSONSchema(schema map[string]any, value any, path string) error {
+	if want, ok := schema["type"].(string); ok && !jsonTypeMatches(want, value) {
+		return fmt.Errorf("%s: expected %s", path, want)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(v any) bool { return fmt.Sprint(v) == fmt.Sprint(value) }) {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := v[fmt.Sprint(name)]; !ok {
+					return fmt.Errorf("%s: missing property %q", path, name)
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]any); ok {
+			for _, name := range slices.Sorted(maps.Keys(properties)) {
+				sub, ok := properties[name].(map[string]any)
+				field, present := v[name]
+				if !ok || !present {
+					continue
+				}
+				if err := checkJSONSchema(sub, field, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := checkJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(want string, value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return want == "object"
+	case []any:
+		return want == "array"
+	case string:
+		return want == "string"
+	case float64:
+		return want == "number" || want == "integer" && v == float64(int64(v))
+	case bool:
+		return want == "boolean"
+	case nil:
+		return want == "null"
+	}
+	return false
+}
+
+// tplTestCommand runs the tests of one or all templates against the
+// configured model, or the one given with --model, and fails if any
+// assertion does.
+func tplTestCommand(args []string, opts *options) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: ai-cli tpl test [name] [--model <model>]")
+	}
+	if err := ensureConfigExists(); err != nil {
+		return err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	names := slices.Sorted(maps.Keys(config.Templates))
+	if len(args) == 1 {
+		if _, ok := config.Templates[args[0]]; !ok {
+			return fmt.Errorf("unknown template: %s (see 'ai-cli tpl list')", args[0])
+		}
+		names = args
+	}
+
+	// answers are collected, not printed
+	opts.noStream = true
+	passed, failed := 0, 0
+	for _, name := range names {
+		tpl, err := resolveTemplate(config, name)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed += max(1, len(config.Templates[name].Tests))
+			continue
+		}
+		for i, test := range tpl.Tests {
+			opts.template = name
+			input := userInput{Prompt: expandTemplate(tpl, test.Input), Piped: test.Piped}
+			answer, err := executePrompt(input, opts)
+			if err != nil {
+				fmt.Printf("FAIL %s #%d: %v\n", name, i+1, err)
+				failed += len(test.Expect)
+				continue
+			}
+
+			ok := true
+			for _, assertion := range test.Expect {
+				if reason := assertion.check(answer); reason != "" {
+					fmt.Printf("FAIL %s #%d: %s (%s)\n", name, i+1, assertion, reason)
+					failed++
+					ok = false
+				} else {
+					fmt.Printf("PASS %s #%d: %s\n", name, i+1, assertion)
+					passed++
+				}
+			}
+			if !ok {
+				fmt.Printf("  Output:\n%s\n", indent(strings.TrimSpace(answer), "    "))
+			}
+		}
+	}
+
+	if passed+failed == 0 {
+		fmt.Println("No template tests defined.")
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return &exitError{code: exitFailure}
+	}
+	return nil
+}
+
+// indent prefixes every line of text.
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// thinkingTickerDelay is how long a stream may stay silent before the
+// ticker appears, so quick answers don't flicker.
+const thinkingTickerDelay = 2 * time.Second
+
+// thinkingDisplay shows on stderr what happens before the answer of a
+// reasoning model starts: with --show-thinking the reasoning the provider
+// streams, dimmed, otherwise a "thinking… 42s" ticker on a terminal. The
+// reasoning is never part of the answer, so it can't reach -o files or
+// pipes.
+type thinkingDisplay struct {
+	show   bool // print the reasoning
+	ticker bool // stderr is a terminal to tick on
+
+	mu         sync.Mutex
+	start      time.Time
+	stop       chan struct{}
+	tickerLine bool // the ticker is on screen
+	thought    bool // reasoning was printed
+	answering  bool // the answer has started
+}
+
+func newThinkingDisplay(show bool) *thinkingDisplay {
+	return &thinkingDisplay{show: show, ticker: isTerminal(os.Stderr)}
+}
+
+// begin starts the display for a stream the provider accepted.
+func (t *thinkingDisplay) begin() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start, t.thought, t.answering = time.Now(), false, false
+	if t.ticker {
+		t.stop = make(chan struct{})
+		go t.tick(t.stop)
+	}
+}
+
+func (t *thinkingDisplay) tick(stop chan struct{}) {
+	timer := time.NewTimer(thinkingTickerDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		t.mu.Lock()
+		if !t.answering && !t.thought {
+			fmt.Fprint(os.Stderr, "\r\033[K"+styled(os.Stderr, styleDim, fmt.Sprintf("thinking… %ds", int(time.Since(t.start).Seconds()))))
+			t.tickerLine = true
+		}
+		t.mu.Unlock()
+		timer.Reset(time.Second)
+	}
+}
+
+// clearTicker removes the ticker from the screen. t.mu must be held.
+func (t *thinkingDisplay) clearTicker() {
+	if t.tickerLine {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		t.tickerLine = false
+	}
+}
+
+// reasoning shows a piece of the model's reasoning with --show-thinking.
+func (t *thinkingDisplay) reasoning(text string) {
+	if t == nil || !t.show || text == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clearTicker()
+	t.thought = true
+	fmt.Fprint(os.Stderr, styled(os.Stderr, styleDim, text))
+}
+
+// answer ends the display as the answer starts.
+func (t *thinkingDisplay) answer() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.answering {
+		return
+	}
+	t.answering = true
+	t.clearTicker()
+	if t.thought {
+		fmt.Fprint(os.Stderr, "\n\n")
+	}
+}
+
+// end stops the display when the stream is over.
+func (t *thinkingDisplay) end() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+	t.clearTicker()
+	if t.thought && !t.answering {
+		fmt.Fprintln(os.Stderr)
+	}
+}
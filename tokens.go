@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// charsPerToken is the rough number of characters per token used for
+// estimates before a request is sent.
+const charsPerToken = 4
+
+// estimateTokens roughly estimates the number of tokens in text.
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// estimateMessageTokens roughly estimates the prompt tokens of messages.
+func estimateMessageTokens(messages []OpenAIMessage) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content)
+	}
+	return total
+}
+
+// tokenCount is a number of tokens, counted with the model's tokenizer or
+// estimated.
+type tokenCount struct {
+	n     int
+	exact bool
+}
+
+// String formats the count for messages, estimates with a "~".
+func (c tokenCount) String() string {
+	if c.exact {
+		return formatTokenCount(c.n)
+	}
+	return "~" + formatTokenCount(c.n)
+}
+
+// countMessageTokens counts the prompt tokens of req with the tokenizer of
+// its model where the provider offers one, which Ollama does with
+// /api/tokenize in recent versions, and estimates them otherwise. The
+// tokens the chat template adds around the messages are not included.
+func countMessageTokens(req *chatRequest) tokenCount {
+	if req.Provider == Ollama {
+		if n, err := ollamaTokenize(req.Model, req.Messages); err == nil {
+			return tokenCount{n, true}
+		}
+	}
+	return tokenCount{estimateMessageTokens(req.Messages), false}
+}
+
+// ollamaTokenizeMissing remembers the Ollama hosts without /api/tokenize,
+// so they are asked only once.
+var ollamaTokenizeMissing sync.Map
+
+// ollamaTokenize counts the tokens of the messages with the model's
+// tokenizer.
+func ollamaTokenize(model string, messages []OpenAIMessage) (int, error) {
+	host := ollamaHostFor(model)
+	if _, missing := ollamaTokenizeMissing.Load(host); missing {
+		return 0, fmt.Errorf("ollama at %s can't tokenize", host)
+	}
+	var content strings.Builder
+	for _, msg := range messages {
+		content.WriteString(msg.Content)
+		content.WriteString("\n")
+	}
+	jsonData, err := json.Marshal(map[string]string{"model": model, "content": content.String()})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", host+"/api/tokenize", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		ollamaTokenizeMissing.Store(host, true)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("ollama tokenize: %s", resp.Status)
+	}
+
+	var tokenized struct {
+		Tokens []int `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenized); err != nil {
+		return 0, err
+	}
+	return len(tokenized.Tokens), nil
+}
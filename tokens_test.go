@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"Hello, world!", 4},
+		{strings.Repeat("x", 4000), 1000},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenCountString(t *testing.T) {
+	if got := (tokenCount{n: 350_000, exact: true}).String(); strings.HasPrefix(got, "~") {
+		t.Errorf("exact count = %q, want it without ~", got)
+	}
+	if got := (tokenCount{n: 350_000}).String(); !strings.HasPrefix(got, "~") {
+		t.Errorf("estimate = %q, want it marked with ~", got)
+	}
+}
+
+// ollamaTokenizer serves /api/tokenize with a token per word, or 404 if
+// missing, and counts the requests.
+func ollamaTokenizer(t *testing.T, missing bool) *int {
+	t.Helper()
+	requests := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tokenize" {
+			http.NotFound(w, r)
+			return
+		}
+		*requests++
+		if missing {
+			http.NotFound(w, r)
+			return
+		}
+		var in struct{ Model, Content string }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Model == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		tokens := make([]int, len(strings.Fields(in.Content)))
+		json.NewEncoder(w).Encode(map[string][]int{"tokens": tokens})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OLLAMA_HOST", srv.URL)
+	return requests
+}
+
+func TestCountMessageTokens(t *testing.T) {
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "What is the capital of France?"},
+	}
+
+	t.Run("ollama tokenizer", func(t *testing.T) {
+		requests := ollamaTokenizer(t, false)
+		got := countMessageTokens(&chatRequest{Provider: Ollama, Model: "llama3.2", Messages: messages})
+		if got != (tokenCount{n: 8, exact: true}) || *requests != 1 {
+			t.Errorf("count = %+v after %d requests, want 8 exact tokens", got, *requests)
+		}
+	})
+	t.Run("ollama without tokenize", func(t *testing.T) {
+		requests := ollamaTokenizer(t, true)
+		req := &chatRequest{Provider: Ollama, Model: "llama3.2", Messages: messages}
+		for range 3 {
+			if got := countMessageTokens(req); got != (tokenCount{n: 3 + 8}) {
+				t.Errorf("count = %+v, want the estimate of 11 tokens", got)
+			}
+		}
+		if *requests != 1 {
+			t.Errorf("asked the host %d times, want once", *requests)
+		}
+	})
+	t.Run("openai", func(t *testing.T) {
+		requests := ollamaTokenizer(t, false)
+		got := countMessageTokens(&chatRequest{Provider: OpenAI, Model: "gpt-5-mini", Messages: messages})
+		if got != (tokenCount{n: 11}) || *requests != 0 {
+			t.Errorf("count = %+v after %d Ollama requests, want the estimate of 11 tokens", got, *requests)
+		}
+	})
+}
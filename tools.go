@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxToolIterations caps how many rounds of tool calls a single request
+	// may take before it is aborted.
+	maxToolIterations = 10
+	// maxToolResultBytes limits how much output of a tool is fed back.
+	maxToolResultBytes = 64 << 10
+	toolCommandTimeout = 2 * time.Minute
+)
+
+// toolDefinition advertises a tool in the format shared by the OpenAI and
+// Ollama APIs.
+type toolDefinition struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// toolCall is a tool invocation requested by the model. Arguments is a JSON
+// object encoded as a string.
+type toolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// builtinTool is a tool ai-cli can run on the model's behalf.
+type builtinTool struct {
+	description string
+	parameter   string // the single string parameter
+	paramDesc   string
+	run         func(arg string, opts *options) (string, error)
+}
+
+var builtinTools = map[string]builtinTool{
+	"read_file": {
+		description: "Read a file, or list a directory, below the current working directory.",
+		parameter:   "path",
+		paramDesc:   "Path relative to the current working directory, e.g. \".\" or \"src/main.go\"",
+		run:         readFileTool,
+	},
+	"run_command": {
+		description: "Run a shell command in the current working directory and return its output. The user must confirm every command.",
+		parameter:   "command",
+		paramDesc:   "The shell command to run",
+		run:         runCommandTool,
+	},
+	"fetch_url": {
+		description: "Fetch a web page and return its readable text.",
+		parameter:   "url",
+		paramDesc:   "The http or https URL to fetch",
+		run:         fetchURLTool,
+	},
+}
+
+// toolNames returns the names of all built-in tools, sorted.
+func toolNames() []string {
+	var names []string
+	for name := range builtinTools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateTools checks the --tools names against the built-in tools and
+// the configured MCP servers.
+func validateTools(config *Config, opts *options) error {
+	for _, name := range opts.tools {
+		if _, ok := builtinTools[name]; ok {
+			continue
+		}
+		if _, ok := config.MCPServers[name]; ok {
+			continue
+		}
+		available := toolNames()
+		for server := range config.MCPServers {
+			available = append(available, server)
+		}
+		slices.Sort(available)
+		return &exitError{code: exitUsage, err: fmt.Errorf("unknown tool: %s (available: %s)", name, strings.Join(available, ", "))}
+	}
+	return nil
+}
+
+// requestTools describes the tools selected with --tools to the model,
+// starting the MCP servers they need.
+func requestTools(config *Config, opts *options) []toolDefinition {
+	builtins, servers := opts.tools, []string(nil)
+	if opts.allTools {
+		builtins = toolNames()
+		for name := range config.MCPServers {
+			servers = append(servers, name)
+		}
+		slices.Sort(servers)
+	} else {
+		builtins = nil
+		for _, name := range opts.tools {
+			if _, ok := builtinTools[name]; ok {
+				builtins = append(builtins, name)
+			} else if _, ok := config.MCPServers[name]; ok {
+				servers = append(servers, name)
+			}
+		}
+	}
+
+	defs := toolDefinitions(builtins)
+	if len(servers) > 0 {
+		defs = append(defs, mcpToolDefinitions(startMCPServers(config, opts, servers), servers)...)
+	}
+	return defs
+}
+
+// toolDefinitions describes the named built-in tools to the model.
+func toolDefinitions(names []string) []toolDefinition {
+	var defs []toolDefinition
+	for _, name := range names {
+		defs = append(defs, builtinTools[name].definition(name))
+	}
+	return defs
+}
+
+// definition describes the tool to the model under the given name.
+func (t builtinTool) definition(name string) toolDefinition {
+	return toolDefinition{
+		Type: "function",
+		Function: toolFunction{
+			Name:        name,
+			Description: t.description,
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					t.parameter: map[string]string{"type": "string", "description": t.paramDesc},
+				},
+				"required": []string{t.parameter},
+			},
+		},
+	}
+}
+
+// continueWithTools runs the tools the model asked for and sends the results
+// back until the model gives a final answer.
+func continueWithTools(req *chatRequest, result *completion, opts *options) (*completion, error) {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	for range maxToolIterations {
+		if len(result.ToolCalls) == 0 {
+			return result, nil
+		}
+
+		req.Messages = append(req.Messages, OpenAIMessage{Role: "assistant", Content: result.Content, ToolCalls: result.ToolCalls})
+		for _, call := range result.ToolCalls {
+			req.Messages = append(req.Messages, OpenAIMessage{
+				Role:       "tool",
+				Content:    runToolCall(req, call, opts),
+				ToolCallID: call.ID,
+			})
+		}
+
+		// tool output such as file contents is subject to the same checks
+		// as the prompt itself, and each round to the budget
+		if result, err = sendSideRequest(config, req, opts, nil); err != nil {
+			return nil, err
+		}
+	}
+	// the answer to the last round's results may well be final
+	if len(result.ToolCalls) == 0 {
+		return result, nil
+	}
+	return nil, fmt.Errorf("gave up after %d rounds of tool calls", maxToolIterations)
+}
+
+// runToolCall runs one tool call and returns its result for the model.
+// Failures are reported to the model so it can try something else.
+func runToolCall(req *chatRequest, call toolCall, opts *options) string {
+	name := call.Function.Name
+	if !slices.ContainsFunc(req.Tools, func(d toolDefinition) bool { return d.Function.Name == name }) {
+		return fmt.Sprintf("error: unknown tool %q", name)
+	}
+	tool, ok := builtinTools[name]
+	if name == webSearchToolName {
+		tool, ok = webSearchTool, true
+	}
+	if !ok {
+		output, ok, err := runMCPToolCall(call)
+		if !ok {
+			return fmt.Sprintf("error: unknown tool %q", name)
+		}
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		output, _ = truncateText(output, maxToolResultBytes)
+		return output
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+		return fmt.Sprintf("error: invalid arguments: %v", err)
+	}
+	arg, _ := args[tool.parameter].(string)
+	if arg == "" {
+		return fmt.Sprintf("error: missing argument %q", tool.parameter)
+	}
+
+	notef("Tool: %s %s\n", name, arg)
+	output, err := tool.run(arg, opts)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	output, _ = truncateText(output, maxToolResultBytes)
+	return output
+}
+
+// readFileTool returns a file's content or a directory listing. Paths must
+// stay below the working directory, also through symlinks.
+func readFileTool(path string, opts *options) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(cwd, path))
+	if err != nil {
+		return "", fmt.Errorf("%s does not exist", path)
+	}
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", path)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			b.WriteString(name + "\n")
+		}
+		return b.String(), nil
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%s is a binary file", path)
+	}
+	return string(data), nil
+}
+
+// runCommandTool runs a shell command after the user confirmed it.
+func runCommandTool(command string, opts *options) (string, error) {
+	if !isInteractive() {
+		return "", fmt.Errorf("commands need confirmation in a terminal, command not run")
+	}
+	if !confirmf("Run command: %s\nAllow? [y/N]: ", command) {
+		return "", fmt.Errorf("the user declined to run the command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	output, err := cmd.CombinedOutput()
+	result := string(output)
+	if err != nil {
+		result += fmt.Sprintf("\n[%v]", err)
+	}
+	return result, nil
+}
+
+// fetchURLTool returns the readable text of a web page.
+func fetchURLTool(url string, opts *options) (string, error) {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return "", err
+	}
+	if isOffline(config, opts) {
+		return "", fmt.Errorf("offline mode: fetching URLs not allowed")
+	}
+	text, _, err := fetchURL(url)
+	return text, err
+}
+
+// confirmf asks a yes/no question on stderr; only "y" or "yes" confirm.
+func confirmf(format string, args ...any) bool {
+	notef(format, args...)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// toolsCommand lists the built-in tools and those of every configured MCP
+// server.
+func toolsCommand(args []string, opts *options) error {
+	if len(args) != 1 || args[0] != "list" {
+		return fmt.Errorf("usage: ai-cli tools list")
+	}
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Built-in:")
+	for _, name := range toolNames() {
+		fmt.Printf("  %-24s %s\n", name, builtinTools[name].description)
+	}
+
+	var servers []string
+	for name := range config.MCPServers {
+		servers = append(servers, name)
+	}
+	slices.Sort(servers)
+	clients := startMCPServers(config, opts, servers)
+	for _, server := range servers {
+		fmt.Printf("\nMCP server %s:\n", server)
+		client, ok := clients[server]
+		if !ok {
+			fmt.Println("  (not available, see the warning above)")
+			continue
+		}
+		if len(client.tools) == 0 {
+			fmt.Println("  (no tools)")
+		}
+		for _, tool := range client.tools {
+			fmt.Printf("  %-24s %s\n", server+mcpToolSeparator+tool.Name, tool.Description)
+		}
+	}
+	return nil
+}
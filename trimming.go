@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultHistoryReserve is how many tokens of the context window are
+	// kept free for the answer.
+	defaultHistoryReserve = 4096
+	// defaultContextWindow is assumed for models whose window is unknown.
+	defaultContextWindow = 8192
+)
+
+// contextWindow returns the context window of the request's model in
+// tokens: the configured context_window, or the window of its capabilities.
+func contextWindow(config *Config, req *chatRequest) int {
+	if config.ContextWindow > 0 {
+		return config.ContextWindow
+	}
+	if caps, _ := modelCapabilities(config, req.Provider, req.Model); caps.ContextWindow > 0 {
+		return caps.ContextWindow
+	}
+	return defaultContextWindow
+}
+
+// historyBudget is how many prompt tokens a conversation may use.
+func historyBudget(config *Config, req *chatRequest) int {
+	window := contextWindow(config, req)
+	reserve := config.HistoryReserve
+	if reserve <= 0 {
+		reserve = defaultHistoryReserve
+	}
+	// small windows keep at least half of themselves for the prompt
+	return max(window-reserve, window/2)
+}
+
+// fitSession drops the oldest exchanges of the session until the system
+// messages, the history and the new prompt fit the model's context window.
+// With history_strategy "summarize" the dropped exchanges are replaced by a
+// summary instead. The system messages are never touched.
+func fitSession(config *Config, req *chatRequest, system []OpenAIMessage, s *session, prompt []OpenAIMessage, opts *options) error {
+	budget := historyBudget(config, req)
+	size := func() int {
+		return estimateMessageTokens(system) + estimateTokens(s.Summary) + estimateMessageTokens(s.Messages) + estimateMessageTokens(prompt)
+	}
+	if size() <= budget {
+		return nil
+	}
+
+	summarize := config.HistoryStrategy == "summarize"
+	// leave room for the summary that replaces the dropped exchanges
+	target := budget
+	if summarize {
+		target = budget * 3 / 4
+	}
+
+	var dropped []OpenAIMessage
+	for len(s.Messages) > 0 && size() > target {
+		// an exchange is a user message and everything up to the next one
+		end := 1
+		for end < len(s.Messages) && s.Messages[end].Role != "user" {
+			end++
+		}
+		dropped = append(dropped, s.Messages[:end]...)
+		s.Messages = s.Messages[end:]
+	}
+	exchanges := countExchanges(dropped)
+
+	if summarize && len(dropped) > 0 {
+		if opts.dryRun {
+			notef("Note: the %d oldest exchanges would be summarized to fit the context window\n", exchanges)
+			return nil
+		}
+		summary, err := summarizeHistory(config, req, s.Summary, dropped, budget, opts)
+		if err == nil {
+			s.Summary = summary
+			notef("Note: summarized the %d oldest exchanges to fit the context window\n", exchanges)
+			return nil
+		}
+		notef("Warning: failed to summarize the conversation (%v), dropping the oldest exchanges instead\n", err)
+		s.Summary = ""
+	}
+
+	if exchanges > 0 {
+		notef("Note: dropped the %d oldest exchanges to fit the context window\n", exchanges)
+	}
+	if size() > budget {
+		notef("Warning: the prompt alone exceeds the context window of %s (~%d tokens)\n", req.Model, budget)
+	}
+	return nil
+}
+
+func countExchanges(messages []OpenAIMessage) int {
+	n := 0
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			n++
+		}
+	}
+	return n
+}
+
+// summarizeHistory asks the request's model to summarize the dropped
+// exchanges, together with an earlier summary. The history is scrubbed and
+// moderated like the prompt, see sendSideRequest.
+func summarizeHistory(config *Config, req *chatRequest, previous string, dropped []OpenAIMessage, budget int, opts *options) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Earlier summary:\n%s\n\n", previous)
+	}
+	for _, msg := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+	text, _ := truncateText(transcript.String(), budget*charsPerToken/2)
+
+	summaryReq := &chatRequest{
+		Provider: req.Provider,
+		Model:    req.Model,
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: "Summarize the following conversation in a few short paragraphs. Keep facts, decisions, names and open questions needed to continue it. Reply with the summary only."},
+			{Role: "user", Content: text},
+		},
+		Tags: req.Tags,
+		User: req.User,
+	}
+	result, err := sendSideRequest(config, summaryReq, opts, nil)
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(result.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
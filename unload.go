@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// unloadCommand frees the memory of Ollama models without restarting
+// Ollama: of the named model, of the one model loaded, or with --all of
+// every loaded model, on every instance that has it in memory.
+func unloadCommand(args []string) error {
+	all := false
+	var names []string
+	for _, arg := range args {
+		switch {
+		case arg == "--all":
+			all = true
+		case strings.HasPrefix(arg, "-"):
+			return &exitError{code: exitUsage, err: fmt.Errorf("unknown unload flag: %s", arg)}
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) > 1 || (all && len(names) > 0) {
+		return &exitError{code: exitUsage, err: fmt.Errorf("usage: ai-cli unload [model|--all]")}
+	}
+
+	model := ""
+	if len(names) == 1 {
+		config, err := loadConfigOrDefault()
+		if err != nil {
+			return err
+		}
+		provider, name := config.resolveModel(names[0])
+		if provider != "" && provider != Ollama {
+			return &exitError{code: exitUsage, err: fmt.Errorf("%s is a model of %s; only Ollama models can be unloaded", names[0], provider)}
+		}
+		model = name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelDetailsTimeout)
+	defer cancel()
+	hosts := ollamaHosts()
+	type hostModel struct {
+		host OllamaHost
+		ollamaLoadedModel
+	}
+	var loaded []hostModel
+	for _, host := range hosts {
+		models, err := fetchLoadedModels(ctx, host.URL)
+		if err != nil {
+			if len(hosts) == 1 {
+				return err
+			}
+			notef("Warning: %v\n", err)
+			continue
+		}
+		for _, m := range models {
+			if model == "" || m.Name == model || m.Name == model+":latest" {
+				loaded = append(loaded, hostModel{host, m})
+			}
+		}
+	}
+
+	switch {
+	case len(loaded) == 0 && model != "":
+		fmt.Printf("%s isn't loaded.\n", model)
+		return nil
+	case len(loaded) == 0:
+		fmt.Println("No models loaded.")
+		return nil
+	case model == "" && !all && len(loaded) > 1:
+		var names []string
+		for _, m := range loaded {
+			names = append(names, m.Name)
+		}
+		return &exitError{code: exitUsage, err: fmt.Errorf("several models are loaded (%s); name one or use --all", strings.Join(names, ", "))}
+	}
+
+	var freed, freedVRAM int64
+	var failed int
+	for _, m := range loaded {
+		if err := unloadOllamaModel(ctx, m.host.URL, m.Name); err != nil {
+			notef("Warning: failed to unload %s: %v\n", m.Name, err)
+			failed++
+			continue
+		}
+		where := ""
+		if len(hosts) > 1 {
+			where = " on " + m.host.Name
+		}
+		fmt.Printf("Unloaded %s%s, freeing %s (%s VRAM)\n", m.Name, where, formatBytes(int(m.Size)), formatBytes(int(m.SizeVRAM)))
+		freed += m.Size
+		freedVRAM += m.SizeVRAM
+	}
+	if len(loaded)-failed > 1 {
+		fmt.Printf("Freed %s in total (%s VRAM)\n", formatBytes(int(freed)), formatBytes(int(freedVRAM)))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to unload %d of %d models", failed, len(loaded))
+	}
+	return nil
+}
+
+// unloadOllamaModel has the Ollama at host drop model from memory: a
+// request without a prompt and a keep_alive of 0 unloads it right away.
+func unloadOllamaModel(ctx context.Context, host, model string) error {
+	body, err := json.Marshal(map[string]any{"model": model, "keep_alive": 0})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", host+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama unload: %s", resp.Status)
+	}
+	return nil
+}
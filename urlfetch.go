@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	urlFetchTimeout = 15 * time.Second
+	// maxURLDownloadBytes caps how much of a page is downloaded at all.
+	maxURLDownloadBytes = 10 << 20
+	// defaultURLMaxBytes is how much extracted text of one page is added to
+	// the prompt unless url_max_bytes is set.
+	defaultURLMaxBytes = 32 << 10
+)
+
+// contextSource is additional content for a prompt, such as a fetched page.
+type contextSource struct {
+	Name    string // where the content came from, e.g. the URL
+	Content string
+}
+
+// fetchURLs fetches every --url page as a context source. HTML is reduced to
+// its readable text, other text is included as is and binary content is
+// rejected.
+func fetchURLs(config *Config, opts *options) ([]contextSource, error) {
+	if isOffline(config, opts) {
+		return nil, fmt.Errorf("offline mode: --url not allowed")
+	}
+
+	maxBytes := config.URLMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultURLMaxBytes
+	}
+
+	var sources []contextSource
+	for _, url := range opts.urls {
+		text, fetched, err := fetchURL(url)
+		if err != nil {
+			return nil, err
+		}
+		text, truncated := truncateText(text, maxBytes)
+
+		if opts.verbose || opts.dryRun {
+			note := ""
+			if truncated {
+				note = fmt.Sprintf(", truncated to %s", formatBytes(maxBytes))
+			}
+			notef("Fetched %s: %s downloaded, %s text%s\n", url, formatBytes(fetched), formatBytes(len(text)), note)
+		}
+		sources = append(sources, contextSource{Name: url, Content: text})
+	}
+	return sources, nil
+}
+
+// fetchURL downloads url and returns its text and the downloaded size.
+func fetchURL(url string) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), urlFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid --url %s: %w", url, err)
+	}
+	req.Header.Set("Accept", "text/html, text/*;q=0.9, application/json;q=0.9, */*;q=0.1")
+	req.Header.Set("User-Agent", "ai-cli")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxURLDownloadBytes))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text, err := htmlToText(bytes.NewReader(body))
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read HTML from %s: %w", url, err)
+		}
+		return text, len(body), nil
+	case isTextMediaType(mediaType) && utf8.Valid(body):
+		return string(body), len(body), nil
+	default:
+		return "", 0, fmt.Errorf("%s is not a text page (content type %s)", url, mediaType)
+	}
+}
+
+// isTextMediaType reports whether content of the media type is readable text.
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-yaml", "application/yaml", "application/toml":
+		return true
+	}
+	return false
+}
+
+// truncateText shortens text to at most maxBytes without splitting a UTF-8
+// character.
+func truncateText(text string, maxBytes int) (string, bool) {
+	if len(text) <= maxBytes {
+		return text, false
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "\n[truncated]\n", true
+}
+
+// formatBytes formats a size for humans, e.g. "12.3 KB".
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
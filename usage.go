@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	usageLogFileName = "usage.jsonl"
+	// budgetWarnRatio is the share of the monthly budget after which a
+	// warning is printed.
+	budgetWarnRatio = 0.8
+)
+
+// modelPrice is the price in USD per million tokens.
+type modelPrice struct {
+	Input       float64
+	CachedInput float64 // prompt tokens read from the prompt cache
+	Output      float64
+}
+
+// openAIPrices lists the prices of the built-in OpenAI models.
+var openAIPrices = map[string]modelPrice{
+	"gpt-5-nano": {Input: 0.05, CachedInput: 0.005, Output: 0.40},
+	"gpt-5-mini": {Input: 0.25, CachedInput: 0.025, Output: 2.00},
+	"gpt-5.2":    {Input: 1.75, CachedInput: 0.175, Output: 14.00},
+}
+
+// usageRecord is one line of the usage log.
+type usageRecord struct {
+	Time             time.Time `json:"time"`
+	Provider         Provider  `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CachedTokens     int       `json:"cached_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	Tags             []string  `json:"tags,omitempty"`
+	User             string    `json:"user,omitempty"`
+}
+
+func getUsageLogPath() string {
+	return filepath.Join(getStateDir(), usageLogFileName)
+}
+
+// estimateCost returns the estimated cost in USD of a request. Local
+// providers and models without a known price cost nothing.
+func estimateCost(provider Provider, model string, promptTokens, completionTokens int) float64 {
+	return estimateCachedCost(provider, model, promptTokens, 0, completionTokens)
+}
+
+// estimateCachedCost is estimateCost for a prompt of which cachedTokens were
+// read from the prompt cache.
+func estimateCachedCost(provider Provider, model string, promptTokens, cachedTokens, completionTokens int) float64 {
+	if provider != OpenAI {
+		return 0
+	}
+	price, ok := openAIPrices[model]
+	if !ok {
+		return 0
+	}
+	noteOutdatedCatalog()
+	uncached := promptTokens - cachedTokens
+	return (float64(uncached)*price.Input + float64(cachedTokens)*price.CachedInput + float64(completionTokens)*price.Output) / 1_000_000
+}
+
+// completionCost returns the estimated cost of result.
+func completionCost(req *chatRequest, result *completion) float64 {
+	return estimateCachedCost(req.Provider, req.Model, result.PromptTokens, result.CachedTokens, result.CompletionTokens)
+}
+
+func recordUsage(req *chatRequest, result *completion) error {
+	if stateDisabled() {
+		return nil
+	}
+	return appendJSONLine(getUsageLogPath(), usageRecord{
+		Time:             time.Now(),
+		Provider:         req.Provider,
+		Model:            req.Model,
+		PromptTokens:     result.PromptTokens,
+		CachedTokens:     result.CachedTokens,
+		CompletionTokens: result.CompletionTokens,
+		CostUSD:          completionCost(req, result),
+		Tags:             req.Tags,
+		User:             req.User,
+	})
+}
+
+// loadUsage reads all usage records at or after since.
+func loadUsage(since time.Time) ([]usageRecord, error) {
+	if stateDisabled() {
+		return nil, nil
+	}
+	f, err := os.Open(getUsageLogPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []usageRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record usageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // skip lines from interrupted writes
+		}
+		if !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// monthToDateSpend returns the estimated spend of the current month.
+func monthToDateSpend() (float64, error) {
+	records, err := loadUsage(startOfMonth(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, record := range records {
+		total += record.CostUSD
+	}
+	return total, nil
+}
+
+// checkBudget enforces the monthly budget for paid providers. Above
+// budgetWarnRatio a warning is printed, above the budget the request is
+// refused unless overBudget is set. Local requests are always allowed.
+func checkBudget(config *Config, provider Provider, overBudget bool) error {
+	if config.BudgetUSD <= 0 || provider.isLocal() {
+		return nil
+	}
+
+	spent, err := monthToDateSpend()
+	if err != nil {
+		return fmt.Errorf("failed to read usage log: %w", err)
+	}
+
+	switch {
+	case spent >= config.BudgetUSD && !overBudget:
+		return &exitError{
+			code: exitBudgetExceeded,
+			err: fmt.Errorf("monthly budget exceeded: $%.2f of $%.2f spent (use --over-budget to send anyway, or use a local model)",
+				spent, config.BudgetUSD),
+		}
+	case spent >= config.BudgetUSD*budgetWarnRatio:
+		notef("Warning: $%.2f of the $%.2f monthly budget spent (%.0f%%)\n",
+			spent, config.BudgetUSD, spent/config.BudgetUSD*100)
+	}
+	return nil
+}
+
+// usageCommand prints the usage of the current month per model, or with
+// --by-tag per tag. A request with several tags counts for each of them.
+func usageCommand(args []string) error {
+	byTag := len(args) == 1 && args[0] == "--by-tag"
+	if len(args) > 0 && !byTag {
+		return fmt.Errorf("usage: ai-cli usage [--by-tag]")
+	}
+
+	now := time.Now()
+	records, err := loadUsage(startOfMonth(now))
+	if err != nil {
+		return err
+	}
+
+	type totals struct {
+		requests         int
+		promptTokens     int
+		cachedTokens     int
+		completionTokens int
+		cost             float64
+	}
+	perKey := make(map[string]*totals)
+	var sum totals
+	for _, record := range records {
+		keys := []string{fmt.Sprintf("[%s] %s", record.Provider, record.Model)}
+		if byTag {
+			keys = record.Tags
+			if len(keys) == 0 {
+				keys = []string{"(untagged)"}
+			}
+		}
+		all := []*totals{&sum}
+		for _, key := range keys {
+			t, ok := perKey[key]
+			if !ok {
+				t = &totals{}
+				perKey[key] = t
+			}
+			all = append(all, t)
+		}
+		for _, t := range all {
+			t.requests++
+			t.promptTokens += record.PromptTokens
+			t.cachedTokens += record.CachedTokens
+			t.completionTokens += record.CompletionTokens
+			t.cost += record.CostUSD
+		}
+	}
+
+	var keys []string
+	for key := range perKey {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	column := "MODEL"
+	if byTag {
+		column = "TAG"
+	}
+	fmt.Printf("Usage for %s (estimated)\n\n", now.Format("January 2006"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, column+"\tREQUESTS\tPROMPT TOK\tCACHED TOK\tOUTPUT TOK\tCOST")
+	for _, key := range keys {
+		t := perKey[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t$%.4f\n", key, t.requests, t.promptTokens, t.cachedTokens, t.completionTokens, t.cost)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\t$%.4f\n", sum.requests, sum.promptTokens, sum.cachedTokens, sum.completionTokens, sum.cost)
+	w.Flush()
+
+	config, err := loadConfig()
+	if err == nil && config.BudgetUSD > 0 {
+		fmt.Printf("\nBudget: $%.2f, remaining: $%.2f\n", config.BudgetUSD, max(config.BudgetUSD-sum.cost, 0))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// watchInterval is how often the --watch files are checked. Polling
+	// needs no platform support and sees every editor's way of saving.
+	watchInterval = 500 * time.Millisecond
+	// watchSettle is how long the files must stay unchanged after a change
+	// before the prompt runs again, so a burst of saves runs it once.
+	watchSettle = 300 * time.Millisecond
+)
+
+// watchPrompt runs input whenever the content of a -f file changes, until
+// interrupted. Each run starts on a cleared screen with a timestamp; a
+// failed run is reported and the watch goes on.
+func watchPrompt(input userInput, opts *options) error {
+	if len(opts.files) == 0 {
+		return &exitError{code: exitUsage, err: fmt.Errorf("--watch needs the files to watch, given with -f")}
+	}
+	if isPiped() {
+		return &exitError{code: exitUsage, err: fmt.Errorf("--watch can't be combined with piped input, attach the file with -f instead")}
+	}
+	// the runs are independent, not turns of the project session
+	opts.autoSession = false
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	hashes := hashFiles(opts.files)
+	for {
+		if isTerminal(os.Stdout) {
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Println(styled(os.Stdout, styleDim, "=== "+time.Now().Format("15:04:05")+" ==="))
+		run := *opts
+		output, err := executePrompt(input, &run)
+		if err := deliver(output, err, &run); err != nil {
+			printError(err, &run)
+		}
+		notef("Watching %s for changes (Ctrl-C to stop)\n", strings.Join(opts.files, ", "))
+
+		for changed := false; !changed; {
+			select {
+			case <-signals:
+				return nil
+			case <-time.After(watchInterval):
+			}
+			current := hashFiles(opts.files)
+			if slices.Equal(current, hashes) {
+				continue
+			}
+			// wait for the writes to settle
+			for {
+				time.Sleep(watchSettle)
+				settled := hashFiles(opts.files)
+				if slices.Equal(settled, current) {
+					break
+				}
+				current = settled
+			}
+			hashes, changed = current, true
+		}
+	}
+}
+
+// hashFiles returns a hash of the content of every file. A file that can't
+// be read hashes as empty, so its reappearance counts as a change.
+func hashFiles(paths []string) []string {
+	hashes := make([]string, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		hashes[i] = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+	return hashes
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	webSearchToolName     = "web_search"
+	webSearchTimeout      = 20 * time.Second
+	defaultWebSearchCount = 5
+	braveSearchURL        = "https://api.search.brave.com/res/v1/web/search"
+)
+
+// webSearchInstruction makes the model cite what it found, so the sources
+// can be listed after the answer.
+const webSearchInstruction = "Search the web to answer. Cite the URL of every source you use in the answer."
+
+var (
+	// urlPattern finds the URLs cited in an answer.
+	urlPattern = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+	// htmlTagPattern matches the highlighting in Brave's snippets.
+	htmlTagPattern = regexp.MustCompile(`<[^>]+>`)
+)
+
+// WebSearch configures the search backend --web-search uses for models
+// without a hosted search tool.
+type WebSearch struct {
+	Backend string `json:"backend"`           // "searxng" or "brave"
+	URL     string `json:"url,omitempty"`     // the SearxNG instance
+	Results int    `json:"results,omitempty"` // results per search, default 5
+}
+
+func validateWebSearch(search *WebSearch) error {
+	if search == nil {
+		return nil
+	}
+	switch search.Backend {
+	case "searxng":
+		if search.URL == "" {
+			return fmt.Errorf("web_search: the searxng backend needs a url")
+		}
+	case "brave":
+	default:
+		return fmt.Errorf("web_search: backend must be searxng or brave")
+	}
+	return nil
+}
+
+// addWebSearch lets the model of req search the web: with the hosted tool
+// of the OpenAI Responses API, or else with the configured search backend.
+func addWebSearch(config *Config, req *chatRequest, opts *options) error {
+	if isOffline(config, opts) {
+		return fmt.Errorf("offline mode: --web-search not allowed")
+	}
+	switch {
+	case req.Provider == OpenAI && config.OpenAIAPI == "responses":
+		req.WebSearch = true
+	case config.WebSearch != nil:
+		req.Tools = append(req.Tools, webSearchTool.definition(webSearchToolName))
+	case req.Provider == OpenAI:
+		return &exitError{code: exitUsage, err: fmt.Errorf(`--web-search needs the OpenAI Responses API: set "openai_api": "responses" in the configuration, or configure a "web_search" backend`)}
+	default:
+		return &exitError{code: exitUsage, err: fmt.Errorf(`--web-search with %s needs a search backend: add "web_search": {"backend": "searxng", "url": "https://searx.example.org"} or {"backend": "brave"} with BRAVE_API_KEY to the configuration`, req.Provider)}
+	}
+
+	req.Messages = addSystemInstruction(req.Messages, webSearchInstruction)
+	return nil
+}
+
+// webSearchTool is offered to the model with a search backend. It is not
+// one of the --tools since it needs the backend configured.
+var webSearchTool = builtinTool{
+	description: "Search the web and return the titles, URLs and snippets of the top results.",
+	parameter:   "query",
+	paramDesc:   "The search query",
+	run:         runWebSearch,
+}
+
+// searchResult is one hit of the search backend.
+type searchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// runWebSearch runs a search with the configured backend and formats the
+// results for the model.
+func runWebSearch(query string, opts *options) (string, error) {
+	config, err := loadConfigOrDefault()
+	if err != nil {
+		return "", err
+	}
+	if config.WebSearch == nil {
+		return "", fmt.Errorf("no web_search backend configured")
+	}
+	if isOffline(config, opts) {
+		return "", fmt.Errorf("offline mode: web search not allowed")
+	}
+
+	results, err := searchWeb(config.WebSearch, query)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No results.", nil
+	}
+	var b strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&b, "%d. %s\n%s\n%s\n\n", i+1, r.Title, r.URL, r.Snippet)
+	}
+	return b.String(), nil
+}
+
+func searchWeb(search *WebSearch, query string) ([]searchResult, error) {
+	count := search.Results
+	if count <= 0 {
+		count = defaultWebSearchCount
+	}
+
+	var endpoint string
+	header := http.Header{}
+	params := url.Values{"q": {query}}
+	switch search.Backend {
+	case "searxng":
+		endpoint = strings.TrimSuffix(search.URL, "/") + "/search"
+		params.Set("format", "json")
+	case "brave":
+		apiKey := os.Getenv("BRAVE_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("BRAVE_API_KEY environment variable not set")
+		}
+		endpoint = braveSearchURL
+		params.Set("count", fmt.Sprint(count))
+		header.Set("X-Subscription-Token", apiKey)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webSearchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ai-cli")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("web search failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("web search failed: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxURLDownloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("web search failed: %w", err)
+	}
+
+	// SearxNG lists the results at the top level, Brave under "web"
+	var parsed struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse search results: %w", err)
+	}
+
+	var results []searchResult
+	for _, r := range parsed.Results {
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	for _, r := range parsed.Web.Results {
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: htmlTagPattern.ReplaceAllString(r.Description, "")})
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+	return results, nil
+}
+
+// citedSources returns the sources of an answer: the citations reported by
+// the provider followed by the URLs in the text, without duplicates.
+func citedSources(result *completion) []string {
+	var sources []string
+	for _, source := range append(slices.Clone(result.Citations), urlPattern.FindAllString(result.Content, -1)...) {
+		source = strings.TrimRight(source, ".,;:!?")
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// printSources lists the sources after the answer. Without any, the answer
+// may come from the model's memory alone, which is worth a warning.
+func printSources(sources []string, w io.Writer) {
+	if len(sources) == 0 {
+		notef("Warning: the answer cites no sources\n")
+		return
+	}
+	fmt.Fprintln(w, "\nSources:")
+	for _, source := range sources {
+		fmt.Fprintf(w, "- %s\n", source)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// projectConfigFileName is the per-project settings file in the project
+// root. Only settings that can't send data anywhere are read from it.
+const projectConfigFileName = ".ai-cli.json"
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// projectConfig holds the settings a project can override.
+type projectConfig struct {
+	AutoSession *bool `json:"auto_session,omitempty"`
+}
+
+// projectRoot returns the root of the git repository containing the working
+// directory, or the working directory itself outside of a repository.
+func projectRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return cwd, nil
+		}
+	}
+}
+
+// projectSessionName derives the session of a project from its root, e.g.
+// "ai-cli-3f2a1b9c". The hash keeps projects with the same name apart.
+func projectSessionName(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	base := unsafeNameChars.ReplaceAllString(filepath.Base(root), "_")
+	return base + "-" + hex.EncodeToString(sum[:4])
+}
+
+// autoSessionRoot returns the project whose session continues
+// automatically, or "" if auto_session is off globally or for the project.
+func autoSessionRoot(config *Config) (string, error) {
+	if !config.AutoSession {
+		return "", nil
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, projectConfigFileName))
+	if err != nil {
+		return root, nil
+	}
+	var project projectConfig
+	if err := json.Unmarshal(data, &project); err != nil {
+		return "", fmt.Errorf("invalid project config %s: %w", filepath.Join(root, projectConfigFileName), err)
+	}
+	if project.AutoSession != nil && !*project.AutoSession {
+		return "", nil
+	}
+	return root, nil
+}